@@ -1,12 +1,29 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/ramiroschettino/jwt-auth-api/internal/activity"
 	"github.com/ramiroschettino/jwt-auth-api/internal/api"
+	"github.com/ramiroschettino/jwt-auth-api/internal/breached"
+	"github.com/ramiroschettino/jwt-auth-api/internal/cache"
 	"github.com/ramiroschettino/jwt-auth-api/internal/config"
+	"github.com/ramiroschettino/jwt-auth-api/internal/devices"
+	"github.com/ramiroschettino/jwt-auth-api/internal/geoip"
+	"github.com/ramiroschettino/jwt-auth-api/internal/mail"
+	"github.com/ramiroschettino/jwt-auth-api/internal/maintenance"
 	"github.com/ramiroschettino/jwt-auth-api/internal/models"
+	"github.com/ramiroschettino/jwt-auth-api/internal/passhash"
 	"github.com/ramiroschettino/jwt-auth-api/internal/repositories"
+	"github.com/ramiroschettino/jwt-auth-api/internal/resp"
 	"github.com/ramiroschettino/jwt-auth-api/internal/services"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -23,21 +40,247 @@ func main() {
 		log.Fatal("Error al conectar a la base de datos: ", err)
 	}
 
-	if err := db.AutoMigrate(&models.User{}, &models.Note{}, &models.InvalidToken{}, &models.Session{}); err != nil {
+	if err := db.AutoMigrate(&models.User{}, &models.Note{}, &models.InvalidToken{}, &models.Session{}, &models.Device{}, &models.AuthEvent{}, &models.LoginFailure{}, &models.TOTPSecret{}, &models.RecoveryCode{}, &models.WebAuthnCredential{}, &models.PasswordResetToken{}); err != nil {
 		log.Fatal("Error en la migración de la base de datos: ", err)
 	}
+	// Las sesiones de antes de la columna jti se completan para que sus tokens
+	// sigan siendo válidos
+	if n, err := repositories.BackfillJTIs(context.Background(), db); err != nil {
+		log.Fatal("Error al completar los jti de las sesiones existentes: ", err)
+	} else if n > 0 {
+		log.Printf("Se completó el jti de %d sesiones y tokens revocados", n)
+	}
+
+	userRepo := repositories.NewUserRepository(db).WithQueryTimeout(cfg.DBQueryTimeout)
+	noteRepo := repositories.NewNoteRepository(db).WithQueryTimeout(cfg.DBQueryTimeout)
+
+	var sessionRepo repositories.SessionStore
+	switch cfg.SessionStore {
+	case "memory":
+		sessionRepo = repositories.NewMemorySessionStore()
+	case "redis":
+		redisClient := resp.NewClient(resp.Options{
+			Addr:     cfg.RedisAddr,
+			Password: cfg.RedisPassword,
+			DB:       cfg.RedisDB,
+			Timeout:  cfg.RedisTimeout,
+			PoolSize: cfg.RedisPoolSize,
+		})
+		defer redisClient.Close()
+		sessionRepo = repositories.NewRedisSessionStore(redisClient, cfg.RedisKeyPrefix)
+	default:
+		sessionRepo = repositories.NewSessionRepository(db).WithQueryTimeout(cfg.DBQueryTimeout)
+	}
+
+	eventRepo := repositories.NewAuthEventRepository(db).WithQueryTimeout(cfg.DBQueryTimeout)
+
+	lockoutRepo := repositories.NewLockoutRepository(db).WithQueryTimeout(cfg.DBQueryTimeout)
+
+	authService := services.NewAuthService(userRepo, sessionRepo, cfg).
+		WithEventLog(eventRepo).
+		WithLockout(lockoutRepo, services.LockoutPolicy{
+			UserThreshold: cfg.LockoutUserThreshold,
+			IPThreshold:   cfg.LockoutIPThreshold,
+			BaseDuration:  cfg.LockoutBaseDuration,
+			MaxDuration:   cfg.LockoutMaxDuration,
+			Window:        cfg.LockoutWindow,
+		})
+
+	switch cfg.PasswordHash {
+	case "bcrypt":
+		authService.WithPasswordHasher(passhash.NewBcrypt(cfg.BcryptCost))
+	default:
+		authService.WithPasswordHasher(passhash.NewArgon2id(passhash.Argon2idParams{
+			Memory:      uint32(cfg.Argon2Memory),
+			Iterations:  uint32(cfg.Argon2Iterations),
+			Parallelism: uint8(cfg.Argon2Parallelism),
+		}))
+	}
+
+	passwordPolicy := services.PasswordPolicy{
+		MinLength:        cfg.PasswordMinLength,
+		MaxBytes:         cfg.PasswordMaxBytes,
+		RequiredClasses:  cfg.PasswordRequiredClasses,
+		DisallowUsername: cfg.PasswordDisallowUsername,
+		BreachedMinCount: cfg.BreachedPasswordsMinCount,
+	}
+	if cfg.BreachedPasswordsDir != "" {
+		corpus, err := breached.Open(cfg.BreachedPasswordsDir)
+		if err != nil {
+			log.Fatal("Error al abrir el corpus de contraseñas filtradas: ", err)
+		}
+		passwordPolicy.Breached = corpus
+	}
+	authService.WithPasswordPolicy(passwordPolicy)
+
+	mfaRepo := repositories.NewMFARepository(db).WithQueryTimeout(cfg.DBQueryTimeout)
+	authService.WithMFA(mfaRepo, services.MFAPolicy{
+		Issuer:        cfg.MFAIssuer,
+		RequiredRoles: cfg.MFARequiredRoles,
+		ChallengeTTL:  cfg.MFAChallengeTTL,
+	})
+
+	if cfg.WebAuthnRPID != "" {
+		wa, err := webauthn.New(&webauthn.Config{
+			RPID:          cfg.WebAuthnRPID,
+			RPDisplayName: cfg.WebAuthnRPName,
+			RPOrigins:     cfg.WebAuthnRPOrigins,
+		})
+		if err != nil {
+			log.Fatal("Error en la configuración de WebAuthn: ", err)
+		}
+		passkeyRepo := repositories.NewWebAuthnRepository(db).WithQueryTimeout(cfg.DBQueryTimeout)
+		authService.WithWebAuthn(wa, passkeyRepo)
+	}
+
+	var resetRepo *repositories.PasswordResetRepository
+	var mailSender mail.Mailer
+	switch cfg.Mailer {
+	case "smtp":
+		mailSender = mail.NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom)
+	case "file":
+		mailSender = mail.NewFileMailer(cfg.MailDropDir, cfg.MailFrom)
+	}
+	if mailSender != nil {
+		authService.WithEmailVerification(services.EmailVerification{
+			Mailer:  mailSender,
+			LinkURL: cfg.EmailVerificationURL,
+			TTL:     cfg.EmailVerificationTTL,
+			Policy:  cfg.EmailVerificationPolicy,
+		})
+
+		if cfg.MagicLinkEnabled {
+			authService.WithMagicLink(services.MagicLink{
+				Mailer:     mailSender,
+				LinkURL:    cfg.MagicLinkURL,
+				TTL:        cfg.MagicLinkTTL,
+				BindDevice: cfg.MagicLinkBindDevice,
+			})
+		}
+
+		resetRepo = repositories.NewPasswordResetRepository(db).WithQueryTimeout(cfg.DBQueryTimeout)
+		authService.WithPasswordReset(resetRepo, services.PasswordReset{
+			Mailer:  mailSender,
+			LinkURL: cfg.PasswordResetURL,
+			TTL:     cfg.PasswordResetTTL,
+		})
+	}
+
+	if cfg.RegistrationEnumerationSafe {
+		authService.WithEnumerationSafeRegistration(services.LogRegistrationNotifier{})
+	}
+
+	if cfg.DeviceRecognitionEnabled {
+		var notifier devices.Notifier
+		switch cfg.DeviceNotifier {
+		case "file":
+			notifier = devices.NewFileNotifier(cfg.DeviceNotifyFile)
+		case "log":
+			notifier = devices.LogNotifier{}
+		}
+		deviceRepo := repositories.NewDeviceRepository(db).WithQueryTimeout(cfg.DBQueryTimeout)
+		authService.WithDeviceRecognition(deviceRepo, notifier)
+	}
+
+	if cfg.GeoIPCityDB != "" || cfg.GeoIPASNDB != "" {
+		geo, err := geoip.Open(cfg.GeoIPCityDB, cfg.GeoIPASNDB)
+		if err != nil {
+			log.Fatal("Error al abrir la base GeoIP: ", err)
+		}
+		defer geo.Close()
+		authService.WithGeoIP(geo)
+
+		if cfg.ImpossibleTravelSpeedKmh > 0 {
+			authService.WithImpossibleTravelHook(cfg.ImpossibleTravelSpeedKmh, func(ctx context.Context, t geoip.Travel) {
+				log.Printf("Viaje imposible del usuario %d: %s (%s) -> %s (%s), %.0f km a %.0f km/h",
+					t.UserID, t.Previous.IP, t.Previous.Location.Country, t.Current.IP, t.Current.Location.Country,
+					t.DistanceKm, t.SpeedKmh)
+			})
+		}
+	}
+
+	if cfg.RevocationCacheEnabled {
+		revocations := cache.NewRevocationCache(userRepo, sessionRepo, cache.Options{
+			BloomCapacity:    cfg.RevocationBloomCapacity,
+			SessionCacheSize: cfg.RevocationCacheSize,
+			ResyncInterval:   cfg.RevocationResyncInterval,
+		})
+		if err := revocations.Start(context.Background()); err != nil {
+			log.Fatal("Error al cargar la caché de revocaciones: ", err)
+		}
+		defer revocations.Stop()
+		authService.WithRevocationCache(revocations)
+	}
+
+	activityAgg := activity.NewAggregator(sessionRepo, activity.Options{
+		FlushInterval: cfg.ActivityFlushInterval,
+		Granularity:   cfg.ActivityGranularity,
+	})
+	activityAgg.Start()
+	authService.WithActivityAggregator(activityAgg)
+
+	if cfg.MaintenanceEnabled {
+		opts := maintenance.Options{
+			Interval:  cfg.MaintenanceInterval,
+			BatchSize: cfg.MaintenanceBatchSize,
+			Locker:    maintenance.NewAdvisoryLock(db, cfg.MaintenanceLockKey),
+
+			Events:         eventRepo,
+			EventRetention: cfg.AuthEventRetention,
+
+			Lockouts:   lockoutRepo,
+			LockoutTTL: cfg.LockoutWindow + cfg.LockoutMaxDuration,
+		}
+		if resetRepo != nil {
+			opts.PasswordResets = resetRepo
+		}
+		worker := maintenance.NewWorker(userRepo, sessionRepo, opts)
+		worker.Start()
+		defer worker.Stop()
+	}
 
-	userRepo := repositories.NewUserRepository(db)
-	noteRepo := repositories.NewNoteRepository(db)
-	sessionRepo := repositories.NewSessionRepository(db)
-	authService := services.NewAuthService(userRepo, sessionRepo, cfg)
 	noteService := services.NewNoteService(noteRepo)
 
-	handler := api.NewAPIHandler(authService, noteService)
+	handler := api.NewAPIHandler(authService, noteService).
+		WithTrustedProxies(cfg.TrustedProxies).
+		WithRateLimits(cfg.RateLimitEnabled, cfg.RateLimits)
 	router := api.NewRouter(handler)
+	server := api.NewServer(":"+cfg.Port, router)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	log.Printf("Servidor escuchando en :%s", cfg.Port)
-	if err := api.ListenAndServe(":"+cfg.Port, router); err != nil {
-		log.Fatal("Error al iniciar el servidor: ", err)
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Printf("Servidor escuchando en :%s", cfg.Port)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
+
+	var failed bool
+	select {
+	case err := <-serverErr:
+		log.Print("Error al iniciar el servidor: ", err)
+		failed = true
+	case <-ctx.Done():
+		log.Print("Apagando el servidor...")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Print("Error al apagar el servidor: ", err)
+		}
+	}
+
+	// Los correos se envían fuera de los requests: esperar los pendientes
+	authService.WaitMail()
+
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelFlush()
+	if err := activityAgg.Stop(flushCtx); err != nil {
+		log.Print("Error al guardar la actividad pendiente: ", err)
+	}
+	if failed {
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,167 @@
+package activity
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ramiroschettino/jwt-auth-api/internal/repositories"
+)
+
+// Aggregator junta en memoria la última actividad de cada sesión y la escribe
+// en lote cada cierto intervalo, en lugar de hacer un UPDATE por request.
+//
+// Los instantes se truncan a Granularity: dentro de esa ventana varios
+// requests de la misma sesión producen una sola escritura, y todas las
+// sesiones que caen en la misma ventana se actualizan con un único UPDATE.
+type Aggregator struct {
+	sessionRepo repositories.SessionStore
+	interval    time.Duration
+	granularity time.Duration
+
+	mu      sync.Mutex
+	pending map[uint]time.Time
+	written map[uint]time.Time
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+type Options struct {
+	// FlushInterval es cada cuánto se escriben las actividades pendientes
+	FlushInterval time.Duration
+	// Granularity es la resolución mínima con la que se guarda LastActivity
+	Granularity time.Duration
+}
+
+func NewAggregator(sessionRepo repositories.SessionStore, opts Options) *Aggregator {
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = 30 * time.Second
+	}
+	if opts.Granularity <= 0 {
+		opts.Granularity = time.Minute
+	}
+	return &Aggregator{
+		sessionRepo: sessionRepo,
+		interval:    opts.FlushInterval,
+		granularity: opts.Granularity,
+		pending:     make(map[uint]time.Time),
+		written:     make(map[uint]time.Time),
+		stop:        make(chan struct{}),
+	}
+}
+
+// Touch registra actividad de la sesión; no accede a la base
+func (a *Aggregator) Touch(sessionID uint, at time.Time) {
+	at = at.Truncate(a.granularity)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if last, ok := a.written[sessionID]; ok && !at.After(last) {
+		return
+	}
+	if last, ok := a.pending[sessionID]; ok && !at.After(last) {
+		return
+	}
+	a.pending[sessionID] = at
+}
+
+// LastSeen devuelve la última actividad conocida en memoria, escrita o no
+func (a *Aggregator) LastSeen(sessionID uint) (time.Time, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if at, ok := a.pending[sessionID]; ok {
+		return at, true
+	}
+	at, ok := a.written[sessionID]
+	return at, ok
+}
+
+// Flush escribe las actividades pendientes, un UPDATE por ventana de tiempo
+func (a *Aggregator) Flush(ctx context.Context) error {
+	a.mu.Lock()
+	pending := a.pending
+	a.pending = make(map[uint]time.Time)
+	a.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	batches := make(map[time.Time][]uint)
+	for id, at := range pending {
+		batches[at] = append(batches[at], id)
+	}
+
+	var firstErr error
+	for at, ids := range batches {
+		if err := a.sessionRepo.UpdateLastActivityBatch(ctx, ids, at); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			// Devolver a pendientes para reintentar en el próximo flush
+			a.mu.Lock()
+			for _, id := range ids {
+				if cur, ok := a.pending[id]; !ok || at.After(cur) {
+					a.pending[id] = at
+				}
+			}
+			a.mu.Unlock()
+			continue
+		}
+
+		a.mu.Lock()
+		for _, id := range ids {
+			a.written[id] = at
+		}
+		a.mu.Unlock()
+	}
+
+	a.forgetStale()
+	return firstErr
+}
+
+// forgetStale descarta las marcas de escritura que ya no pueden evitar un
+// UPDATE para que el mapa no crezca con sesiones inactivas
+func (a *Aggregator) forgetStale() {
+	cutoff := time.Now().Add(-2 * a.granularity)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for id, at := range a.written {
+		if at.Before(cutoff) {
+			delete(a.written, id)
+		}
+	}
+}
+
+// Start lanza el flush periódico en segundo plano
+func (a *Aggregator) Start() {
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		ticker := time.NewTicker(a.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := a.Flush(context.Background()); err != nil {
+					log.Printf("Error al guardar la actividad de sesiones: %v", err)
+				}
+			case <-a.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop detiene el flush periódico y escribe lo que quede pendiente
+func (a *Aggregator) Stop(ctx context.Context) error {
+	a.stopOnce.Do(func() { close(a.stop) })
+	a.wg.Wait()
+	return a.Flush(ctx)
+}
@@ -0,0 +1,80 @@
+package activity
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/ramiroschettino/jwt-auth-api/internal/models"
+	"github.com/ramiroschettino/jwt-auth-api/internal/repositories"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestAggregator(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.Session{}))
+
+	var updates int
+	db.Callback().Update().After("gorm:update").Register("test:count", func(*gorm.DB) { updates++ })
+
+	start := time.Now().Add(-time.Hour)
+	sessions := make([]models.Session, 3)
+	for i := range sessions {
+		sessions[i] = models.Session{
+			UserID:       1,
+			Token:        string(rune('a' + i)),
+			LastActivity: start,
+			ExpiresAt:    time.Now().Add(time.Hour),
+			IsActive:     true,
+		}
+		require.NoError(t, db.Create(&sessions[i]).Error)
+	}
+
+	sessionRepo := repositories.NewSessionRepository(db)
+	agg := NewAggregator(sessionRepo, Options{FlushInterval: time.Hour, Granularity: time.Minute})
+
+	t.Run("coalesce varios requests en un UPDATE", func(t *testing.T) {
+		now := time.Now()
+		for i := 0; i < 50; i++ {
+			for _, sess := range sessions {
+				agg.Touch(sess.ID, now)
+			}
+		}
+		assert.Equal(t, 0, updates)
+
+		require.NoError(t, agg.Flush(ctx))
+		assert.Equal(t, 1, updates)
+
+		var stored models.Session
+		require.NoError(t, db.First(&stored, sessions[0].ID).Error)
+		assert.WithinDuration(t, now.Truncate(time.Minute), stored.LastActivity, time.Second)
+	})
+
+	t.Run("no reescribe dentro de la misma ventana", func(t *testing.T) {
+		updates = 0
+		agg.Touch(sessions[0].ID, time.Now())
+		require.NoError(t, agg.Flush(ctx))
+		assert.Equal(t, 0, updates)
+	})
+
+	t.Run("LastSeen refleja lo pendiente", func(t *testing.T) {
+		later := time.Now().Add(5 * time.Minute)
+		agg.Touch(sessions[1].ID, later)
+		seen, ok := agg.LastSeen(sessions[1].ID)
+		assert.True(t, ok)
+		assert.Equal(t, later.Truncate(time.Minute), seen)
+	})
+
+	t.Run("Stop escribe lo pendiente", func(t *testing.T) {
+		updates = 0
+		agg.Start()
+		require.NoError(t, agg.Stop(ctx))
+		assert.Equal(t, 1, updates)
+	})
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RequireRole deja pasar sólo a usuarios autenticados con el rol indicado;
+// va después de JWTAuthMiddleware
+func RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if current, _ := r.Context().Value(ctxRole).(string); current != role {
+				WriteError(w, NewAPIError(http.StatusForbidden, "se requiere el rol "+role))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// AdminUnlock levanta el bloqueo por logins fallidos de un usuario, de una
+// IP o de ambos
+func (h *APIHandler) AdminUnlock(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Username string `json:"username"`
+		IP       string `json:"ip"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || (req.Username == "" && req.IP == "") {
+		WriteError(w, NewAPIError(http.StatusBadRequest, "se requiere username o ip"))
+		return
+	}
+
+	if req.Username != "" {
+		if err := h.AuthService.UnlockAccount(r.Context(), req.Username); err != nil {
+			WriteError(w, MapError(err))
+			return
+		}
+	}
+	if req.IP != "" {
+		if err := h.AuthService.UnlockIP(r.Context(), req.IP); err != nil {
+			WriteError(w, MapError(err))
+			return
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Unlocked"})
+}
+
+// setRetryAfter informa en segundos enteros, redondeando hacia arriba,
+// cuándo puede reintentar el cliente
+func setRetryAfter(w http.ResponseWriter, d time.Duration) {
+	seconds := int(math.Ceil(d.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+}
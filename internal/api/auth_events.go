@@ -0,0 +1,171 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	apperrors "github.com/ramiroschettino/jwt-auth-api/internal/errors"
+	"github.com/ramiroschettino/jwt-auth-api/internal/models"
+	"github.com/ramiroschettino/jwt-auth-api/internal/repositories"
+)
+
+// Tamaño de página por defecto y máximo de las consultas del log
+const (
+	defaultEventsLimit = 50
+	maxEventsLimit     = 200
+)
+
+type authEventResponse struct {
+	ID        uint      `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    *uint     `json:"user_id,omitempty"`
+	Username  string    `json:"username"`
+	Type      string    `json:"type"`
+	Success   bool      `json:"success"`
+	Reason    string    `json:"reason,omitempty"`
+	Method    string    `json:"method,omitempty"`
+	MFA       bool      `json:"mfa"`
+	SessionID *uint     `json:"session_id,omitempty"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Country   string    `json:"country,omitempty"`
+	City      string    `json:"city,omitempty"`
+	ASN       uint      `json:"asn,omitempty"`
+}
+
+func newAuthEventResponse(event models.AuthEvent) authEventResponse {
+	return authEventResponse{
+		ID:        event.ID,
+		CreatedAt: event.CreatedAt,
+		UserID:    event.UserID,
+		Username:  event.Username,
+		Type:      event.Type,
+		Success:   event.Success,
+		Reason:    event.Reason,
+		Method:    event.Method,
+		MFA:       event.MFA,
+		SessionID: event.SessionID,
+		IP:        event.IP,
+		UserAgent: event.UserAgent,
+		Country:   event.Country,
+		City:      event.City,
+		ASN:       event.ASN,
+	}
+}
+
+// LoginHistory lista los intentos de login del usuario autenticado
+func (h *APIHandler) LoginHistory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(ctxUserID).(uint)
+	if !ok {
+		WriteError(w, MapError(apperrors.ErrUnauthorized))
+		return
+	}
+
+	query := r.URL.Query()
+	limit, err := parseLimit(query.Get("limit"))
+	if err != nil {
+		WriteError(w, NewAPIError(http.StatusBadRequest, "limit inválido"))
+		return
+	}
+	before, err := parseUintParam(query.Get("before"))
+	if err != nil {
+		WriteError(w, NewAPIError(http.StatusBadRequest, "before inválido"))
+		return
+	}
+
+	events, err := h.AuthService.LoginHistory(r.Context(), userID, before, limit)
+	if err != nil {
+		WriteError(w, MapError(err))
+		return
+	}
+	writeEvents(w, events)
+}
+
+// AdminAuthEvents consulta el log de autenticación de todos los usuarios.
+// Filtros: user_id, username, ip, type, success, since, until (RFC 3339),
+// before y limit.
+func (h *APIHandler) AdminAuthEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := repositories.AuthEventFilter{
+		Username: query.Get("username"),
+		IP:       query.Get("ip"),
+		Type:     query.Get("type"),
+	}
+
+	var err error
+	if filter.Limit, err = parseLimit(query.Get("limit")); err != nil {
+		WriteError(w, NewAPIError(http.StatusBadRequest, "limit inválido"))
+		return
+	}
+	if filter.BeforeID, err = parseUintParam(query.Get("before")); err != nil {
+		WriteError(w, NewAPIError(http.StatusBadRequest, "before inválido"))
+		return
+	}
+	if filter.UserID, err = parseUintParam(query.Get("user_id")); err != nil {
+		WriteError(w, NewAPIError(http.StatusBadRequest, "user_id inválido"))
+		return
+	}
+	if value := query.Get("success"); value != "" {
+		success, err := strconv.ParseBool(value)
+		if err != nil {
+			WriteError(w, NewAPIError(http.StatusBadRequest, "success inválido"))
+			return
+		}
+		filter.Success = &success
+	}
+	if filter.Since, err = parseTimeParam(query.Get("since")); err != nil {
+		WriteError(w, NewAPIError(http.StatusBadRequest, "since inválido"))
+		return
+	}
+	if filter.Until, err = parseTimeParam(query.Get("until")); err != nil {
+		WriteError(w, NewAPIError(http.StatusBadRequest, "until inválido"))
+		return
+	}
+
+	events, err := h.AuthService.QueryAuthEvents(r.Context(), filter)
+	if err != nil {
+		WriteError(w, MapError(err))
+		return
+	}
+	writeEvents(w, events)
+}
+
+func writeEvents(w http.ResponseWriter, events []models.AuthEvent) {
+	resp := make([]authEventResponse, 0, len(events))
+	for _, event := range events {
+		resp = append(resp, newAuthEventResponse(event))
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func parseLimit(value string) (int, error) {
+	if value == "" {
+		return defaultEventsLimit, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit <= 0 {
+		return 0, strconv.ErrSyntax
+	}
+	if limit > maxEventsLimit {
+		limit = maxEventsLimit
+	}
+	return limit, nil
+}
+
+func parseUintParam(value string) (uint, error) {
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(value, 10, 64)
+	return uint(n), err
+}
+
+func parseTimeParam(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+const ctxClientIP ctxKey = "client_ip"
+
+// ClientIPResolver obtiene la IP real del cliente. Los headers
+// X-Forwarded-For y Forwarded sólo se tienen en cuenta cuando la conexión
+// viene de un proxy de confianza, y se recorren de derecha a izquierda
+// saltando proxies de confianza: el primer salto que no lo es es el cliente.
+// Los saltos a la izquierda de ese punto los escribe el propio cliente y no
+// se usan nunca.
+type ClientIPResolver struct {
+	trusted []netip.Prefix
+}
+
+// NewClientIPResolver crea un resolver que confía en los proxies dentro de
+// los rangos indicados; sin rangos se usa siempre la IP de la conexión
+func NewClientIPResolver(trustedProxies []netip.Prefix) *ClientIPResolver {
+	return &ClientIPResolver{trusted: trustedProxies}
+}
+
+// Middleware resuelve la IP una sola vez por request, la guarda en el
+// contexto y la deja en r.RemoteAddr para que el logger registre la real.
+// Debe instalarse antes que middleware.Logger.
+func (c *ClientIPResolver) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := c.Resolve(r)
+		r.RemoteAddr = ip
+		ctx := context.WithValue(r.Context(), ctxClientIP, ip)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Resolve devuelve la IP del cliente normalizada (sin puerto ni zona), lo
+// que garantiza que entra en la columna varchar(45) de sesiones
+func (c *ClientIPResolver) Resolve(r *http.Request) string {
+	remote, ok := parseHop(r.RemoteAddr)
+	if !ok {
+		return r.RemoteAddr
+	}
+	if !c.isTrusted(remote) {
+		return remote.String()
+	}
+
+	// Forwarded (RFC 7239) tiene prioridad sobre X-Forwarded-For
+	hops := forwardedFor(r.Header.Values("Forwarded"))
+	if hops == nil {
+		hops = splitList(r.Header.Values("X-Forwarded-For"))
+	}
+
+	ip := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, ok := parseHop(hops[i])
+		if !ok {
+			// Un salto ilegible corta la cadena: nos quedamos con el último
+			// proxy de confianza en lugar de adivinar
+			break
+		}
+		ip = hop
+		if !c.isTrusted(hop) {
+			break
+		}
+	}
+	return ip.String()
+}
+
+func (c *ClientIPResolver) isTrusted(ip netip.Addr) bool {
+	for _, prefix := range c.trusted {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP devuelve la IP que resolvió el middleware; si no corrió, la de la
+// conexión
+func clientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(ctxClientIP).(string); ok {
+		return ip
+	}
+	return NewClientIPResolver(nil).Resolve(r)
+}
+
+// parseHop interpreta "ip", "ip:puerto", "[ipv6]" o "[ipv6]:puerto"
+func parseHop(value string) (netip.Addr, bool) {
+	value = strings.TrimSpace(value)
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.WithZone("").Unmap(), true
+}
+
+// splitList une los valores de un header repetido en una sola lista separada
+// por comas, respetando el orden
+func splitList(values []string) []string {
+	var items []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			items = append(items, strings.TrimSpace(item))
+		}
+	}
+	return items
+}
+
+// forwardedFor extrae los parámetros for= de los elementos de Forwarded.
+// Los elementos sin for= o con identificadores ofuscados ("unknown",
+// "_secreto") quedan como valores ilegibles y cortan la cadena.
+func forwardedFor(values []string) []string {
+	var hops []string
+	for _, element := range splitList(values) {
+		if element == "" {
+			continue
+		}
+		hop := ""
+		for _, pair := range strings.Split(element, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if ok && strings.EqualFold(key, "for") {
+				hop = strings.Trim(value, `"`)
+			}
+		}
+		hops = append(hops, hop)
+	}
+	return hops
+}
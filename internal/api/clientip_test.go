@@ -0,0 +1,86 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientIPResolver(t *testing.T) {
+	resolver := NewClientIPResolver([]netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("2001:db8:cafe::/48"),
+	})
+
+	tests := []struct {
+		name      string
+		remote    string
+		xff       []string
+		forwarded []string
+		want      string
+	}{
+		{name: "sin proxy", remote: "203.0.113.7:5000", want: "203.0.113.7"},
+		{name: "header de un cliente no confiable", remote: "203.0.113.7:5000", xff: []string{"1.2.3.4"}, want: "203.0.113.7"},
+		{name: "un proxy", remote: "10.0.0.1:5000", xff: []string{"198.51.100.9"}, want: "198.51.100.9"},
+		{name: "cadena de proxies", remote: "10.0.0.1:5000", xff: []string{"198.51.100.9, 10.0.0.2"}, want: "198.51.100.9"},
+		{name: "valor falsificado a la izquierda", remote: "10.0.0.1:5000", xff: []string{"6.6.6.6, 198.51.100.9"}, want: "198.51.100.9"},
+		{name: "header repetido", remote: "10.0.0.1:5000", xff: []string{"6.6.6.6", "198.51.100.9, 10.0.0.2"}, want: "198.51.100.9"},
+		{name: "sólo proxies", remote: "10.0.0.1:5000", xff: []string{"10.0.0.3, 10.0.0.2"}, want: "10.0.0.3"},
+		{name: "salto ilegible", remote: "10.0.0.1:5000", xff: []string{"198.51.100.9, basura"}, want: "10.0.0.1"},
+		{name: "ipv6", remote: "[2001:db8:cafe::1]:443", xff: []string{"2001:db8::17"}, want: "2001:db8::17"},
+		{name: "ipv4 mapeada", remote: "[::ffff:10.0.0.1]:443", xff: []string{"198.51.100.9"}, want: "198.51.100.9"},
+		{
+			name:      "forwarded",
+			remote:    "10.0.0.1:5000",
+			forwarded: []string{`for=6.6.6.6, for="[2001:db8::17]:4711";proto=https, for=10.0.0.2;by=10.0.0.1`},
+			xff:       []string{"1.2.3.4"},
+			want:      "2001:db8::17",
+		},
+		{name: "forwarded ofuscado", remote: "10.0.0.1:5000", forwarded: []string{"for=_hidden, for=10.0.0.2"}, want: "10.0.0.2"},
+		{name: "forwarded con mayúsculas", remote: "10.0.0.1:5000", forwarded: []string{"For=198.51.100.9"}, want: "198.51.100.9"},
+		{
+			name:   "lista larga",
+			remote: "10.0.0.1:5000",
+			xff:    []string{strings.Repeat("198.51.100.9, ", 20) + "203.0.113.7"},
+			want:   "203.0.113.7",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remote
+			for _, v := range tt.xff {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			for _, v := range tt.forwarded {
+				r.Header.Add("Forwarded", v)
+			}
+			got := resolver.Resolve(r)
+			assert.Equal(t, tt.want, got)
+			assert.LessOrEqual(t, len(got), 45)
+		})
+	}
+}
+
+func TestClientIPMiddleware(t *testing.T) {
+	resolver := NewClientIPResolver([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")})
+
+	var seen, remote string
+	handler := resolver.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = clientIP(r)
+		remote = r.RemoteAddr
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.1:5000"
+	r.Header.Set("X-Forwarded-For", "198.51.100.9")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	assert.Equal(t, "198.51.100.9", seen)
+	assert.Equal(t, "198.51.100.9", remote)
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	apperrors "github.com/ramiroschettino/jwt-auth-api/internal/errors"
+)
+
+// RequireVerifiedEmail responde 403 (email_not_verified) si la política de
+// verificación restringe las cuentas sin verificar y la del usuario lo está.
+// Va después de JWTAuthMiddleware.
+func (h *APIHandler) RequireVerifiedEmail(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(ctxUserID).(uint)
+		if !ok {
+			WriteError(w, MapError(apperrors.ErrUnauthorized))
+			return
+		}
+		if err := h.AuthService.RequireVerifiedEmail(r.Context(), userID); err != nil {
+			WriteError(w, MapError(err))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// VerifyEmail consume el token de un link de verificación, que la página del
+// link envía como {"token": "..."}. Sólo acepta POST para que el token no
+// quede en la URL que registra el log de requests.
+func (h *APIHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		WriteError(w, MapError(apperrors.ErrVerificationLinkInvalid))
+		return
+	}
+
+	if err := h.AuthService.VerifyEmail(r.Context(), req.Token); err != nil {
+		WriteError(w, MapError(err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Email verified"})
+}
+
+// RequestEmailVerification reenvía el link de verificación a quien no puede
+// iniciar sesión por tener el email sin verificar. Responde lo mismo si el
+// usuario no existe o la contraseña es incorrecta.
+func (h *APIHandler) RequestEmailVerification(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Email    string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Username == "" || req.Password == "" {
+		WriteError(w, MapError(apperrors.ErrInvalidUser))
+		return
+	}
+
+	err := h.AuthService.RequestEmailVerification(r.Context(), req.Username, req.Password, req.Email, clientIP(r))
+	if err != nil {
+		writeLoginError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "If the credentials are valid, a verification email was sent"})
+}
+
+// EmailStatus devuelve el email del usuario autenticado y si está verificado
+func (h *APIHandler) EmailStatus(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(ctxUserID).(uint)
+	if !ok {
+		WriteError(w, MapError(apperrors.ErrUnauthorized))
+		return
+	}
+
+	email, verified, err := h.AuthService.EmailStatus(r.Context(), userID)
+	if err != nil {
+		WriteError(w, MapError(err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"email": email, "verified": verified})
+}
+
+// ChangeEmail reemplaza el email del usuario autenticado y envía el link de
+// verificación a la dirección nueva
+func (h *APIHandler) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(ctxUserID).(uint)
+	if !ok {
+		WriteError(w, MapError(apperrors.ErrUnauthorized))
+		return
+	}
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, MapError(apperrors.ErrInvalidEmail))
+		return
+	}
+
+	if err := h.AuthService.ChangeEmail(r.Context(), userID, req.Email); err != nil {
+		WriteError(w, MapError(err))
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Verification email sent"})
+}
+
+// ResendEmailVerification vuelve a enviar el link de verificación
+func (h *APIHandler) ResendEmailVerification(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(ctxUserID).(uint)
+	if !ok {
+		WriteError(w, MapError(apperrors.ErrUnauthorized))
+		return
+	}
+
+	if err := h.AuthService.ResendEmailVerification(r.Context(), userID); err != nil {
+		WriteError(w, MapError(err))
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Verification email sent"})
+}
@@ -1,15 +1,22 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	apperrors "github.com/ramiroschettino/jwt-auth-api/internal/errors"
+	"github.com/ramiroschettino/jwt-auth-api/internal/services"
 )
 
 type APIError struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
+	// ErrorCode distingue casos que comparten el mismo status HTTP
+	ErrorCode string `json:"error_code,omitempty"`
+	// Violations lista las reglas de la política de contraseñas incumplidas
+	Violations []services.PasswordViolation `json:"violations,omitempty"`
 }
 
 func NewAPIError(code int, message string) *APIError {
@@ -19,6 +26,12 @@ func NewAPIError(code int, message string) *APIError {
 	}
 }
 
+// WithErrorCode agrega un código legible por máquina a la respuesta
+func (e *APIError) WithErrorCode(code string) *APIError {
+	e.ErrorCode = code
+	return e
+}
+
 func WriteError(w http.ResponseWriter, err *APIError) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(err.Code)
@@ -26,7 +39,68 @@ func WriteError(w http.ResponseWriter, err *APIError) {
 }
 
 func MapError(err error) *APIError {
+	var policyErr *services.PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		apiErr := NewAPIError(http.StatusBadRequest, apperrors.ErrWeakPassword.Error()).WithErrorCode("weak_password")
+		apiErr.Violations = policyErr.Violations
+		return apiErr
+	}
+
 	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return NewAPIError(http.StatusGatewayTimeout, "request timed out")
+	case errors.Is(err, context.Canceled):
+		return NewAPIError(http.StatusServiceUnavailable, "request canceled")
+	case errors.Is(err, apperrors.ErrSessionNotFound):
+		return NewAPIError(http.StatusNotFound, err.Error())
+	case errors.Is(err, apperrors.ErrSessionLimitReached):
+		return NewAPIError(http.StatusConflict, err.Error()).WithErrorCode("session_limit_reached")
+	case errors.Is(err, apperrors.ErrSessionIdleExpired):
+		return NewAPIError(http.StatusUnauthorized, err.Error()).WithErrorCode("session_idle_expired")
+	case errors.Is(err, apperrors.ErrSessionAbsoluteExpired):
+		return NewAPIError(http.StatusUnauthorized, err.Error()).WithErrorCode("session_absolute_expired")
+	case errors.Is(err, apperrors.ErrAccountLocked):
+		return NewAPIError(http.StatusTooManyRequests, err.Error()).WithErrorCode("account_locked")
+	case errors.Is(err, apperrors.ErrRateLimited):
+		return NewAPIError(http.StatusTooManyRequests, err.Error()).WithErrorCode("rate_limited")
+	case errors.Is(err, apperrors.ErrInvalidMFACode):
+		return NewAPIError(http.StatusUnauthorized, err.Error()).WithErrorCode("invalid_mfa_code")
+	case errors.Is(err, apperrors.ErrMFAChallengeInvalid):
+		return NewAPIError(http.StatusUnauthorized, err.Error()).WithErrorCode("invalid_mfa_challenge")
+	case errors.Is(err, apperrors.ErrMFANotEnrolled):
+		return NewAPIError(http.StatusBadRequest, err.Error()).WithErrorCode("mfa_not_enrolled")
+	case errors.Is(err, apperrors.ErrMFAAlreadyEnabled):
+		return NewAPIError(http.StatusConflict, err.Error()).WithErrorCode("mfa_already_enabled")
+	case errors.Is(err, apperrors.ErrWebAuthnDisabled):
+		return NewAPIError(http.StatusNotFound, err.Error()).WithErrorCode("webauthn_disabled")
+	case errors.Is(err, apperrors.ErrPasskeyInvalid):
+		return NewAPIError(http.StatusUnauthorized, err.Error()).WithErrorCode("invalid_passkey")
+	case errors.Is(err, apperrors.ErrPasskeyNotFound):
+		return NewAPIError(http.StatusNotFound, err.Error())
+	case errors.Is(err, apperrors.ErrInvalidEmail):
+		return NewAPIError(http.StatusBadRequest, err.Error()).WithErrorCode("invalid_email")
+	case errors.Is(err, apperrors.ErrEmailTaken):
+		return NewAPIError(http.StatusConflict, err.Error()).WithErrorCode("email_taken")
+	case errors.Is(err, apperrors.ErrEmailMissing):
+		return NewAPIError(http.StatusBadRequest, err.Error()).WithErrorCode("email_missing")
+	case errors.Is(err, apperrors.ErrEmailNotVerified):
+		return NewAPIError(http.StatusForbidden, err.Error()).WithErrorCode("email_not_verified")
+	case errors.Is(err, apperrors.ErrEmailVerificationDisabled):
+		return NewAPIError(http.StatusNotFound, err.Error()).WithErrorCode("email_verification_disabled")
+	case errors.Is(err, apperrors.ErrVerificationLinkInvalid):
+		return NewAPIError(http.StatusBadRequest, err.Error()).WithErrorCode("invalid_verification_link")
+	case errors.Is(err, apperrors.ErrPasswordResetDisabled):
+		return NewAPIError(http.StatusNotFound, err.Error()).WithErrorCode("password_reset_disabled")
+	case errors.Is(err, apperrors.ErrResetTokenInvalid):
+		return NewAPIError(http.StatusBadRequest, err.Error()).WithErrorCode("invalid_reset_token")
+	case errors.Is(err, apperrors.ErrWeakPassword):
+		return NewAPIError(http.StatusBadRequest, err.Error()).WithErrorCode("weak_password")
+	case errors.Is(err, apperrors.ErrMagicLinkDisabled):
+		return NewAPIError(http.StatusNotFound, err.Error()).WithErrorCode("magic_link_disabled")
+	case errors.Is(err, apperrors.ErrMagicLinkInvalid):
+		return NewAPIError(http.StatusUnauthorized, err.Error()).WithErrorCode("invalid_magic_link")
+	case errors.Is(err, apperrors.ErrCurrentPasswordInvalid):
+		return NewAPIError(http.StatusForbidden, err.Error()).WithErrorCode("invalid_current_password")
 	case apperrors.IsAuthError(err):
 		return NewAPIError(http.StatusUnauthorized, err.Error())
 	case apperrors.IsTokenError(err):
@@ -3,27 +3,51 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"net/netip"
+	"strconv"
+	"time"
 
+	"github.com/go-chi/chi/v5"
 	apperrors "github.com/ramiroschettino/jwt-auth-api/internal/errors"
+	"github.com/ramiroschettino/jwt-auth-api/internal/models"
+	"github.com/ramiroschettino/jwt-auth-api/internal/ratelimit"
 	"github.com/ramiroschettino/jwt-auth-api/internal/services"
 )
 
 type ctxKey string
 
 const (
-	ctxUserID   ctxKey = "user_id"
-	ctxUsername ctxKey = "username"
-	ctxRole     ctxKey = "role"
+	ctxUserID    ctxKey = "user_id"
+	ctxUsername  ctxKey = "username"
+	ctxRole      ctxKey = "role"
+	ctxSessionID ctxKey = "session_id"
 )
 
 type APIHandler struct {
 	AuthService *services.AuthService
 	NoteService *services.NoteService
+	ClientIP    *ClientIPResolver
+	RateLimits  *RateLimiter
 }
 
 func NewAPIHandler(auth *services.AuthService, note *services.NoteService) *APIHandler {
-	return &APIHandler{AuthService: auth, NoteService: note}
+	return &APIHandler{AuthService: auth, NoteService: note, ClientIP: NewClientIPResolver(nil), RateLimits: NewRateLimiter(true, nil)}
+}
+
+// WithTrustedProxies indica desde qué proxies se aceptan X-Forwarded-For y
+// Forwarded para obtener la IP del cliente
+func (h *APIHandler) WithTrustedProxies(trusted []netip.Prefix) *APIHandler {
+	h.ClientIP = NewClientIPResolver(trusted)
+	return h
+}
+
+// WithRateLimits activa o desactiva los límites por ruta y pisa, por
+// nombre, los declarados en el router
+func (h *APIHandler) WithRateLimits(enabled bool, overrides map[string]ratelimit.Limit) *APIHandler {
+	h.RateLimits = NewRateLimiter(enabled, overrides)
+	return h
 }
 
 func (h *APIHandler) Register(w http.ResponseWriter, r *http.Request) {
@@ -31,6 +55,7 @@ func (h *APIHandler) Register(w http.ResponseWriter, r *http.Request) {
 		Username string `json:"username"`
 		Password string `json:"password"`
 		Role     string `json:"role"`
+		Email    string `json:"email"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		WriteError(w, MapError(apperrors.ErrInvalidUser))
@@ -42,19 +67,27 @@ func (h *APIHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := h.AuthService.Register(req.Username, req.Password, req.Role)
+	user, err := h.AuthService.RegisterWithEmail(r.Context(), req.Username, req.Password, req.Role, req.Email)
 	if err != nil {
 		WriteError(w, MapError(err))
 		return
 	}
+	// En modo seguro la respuesta es la misma exista o no el usuario
+	if h.AuthService.EnumerationSafeRegistration() {
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{"message": "Registration received"})
+		return
+	}
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(user)
 }
 
 func (h *APIHandler) Login(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
+		Username           string `json:"username"`
+		Password           string `json:"password"`
+		TerminateSessionID uint   `json:"terminate_session_id"`
+		DeviceID           string `json:"device_id"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		WriteError(w, MapError(apperrors.ErrInvalidUser))
@@ -67,20 +100,41 @@ func (h *APIHandler) Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	userAgent := r.Header.Get("User-Agent")
-	ip := r.RemoteAddr
-	if fwdIP := r.Header.Get("X-Forwarded-For"); fwdIP != "" {
-		ip = fwdIP
-	}
+	ip := clientIP(r)
 
-	token, err := h.AuthService.Login(req.Username, req.Password, userAgent, ip)
+	token, err := h.AuthService.LoginWithOptions(r.Context(), req.Username, req.Password, userAgent, ip, services.LoginOptions{
+		TerminateSessionID: req.TerminateSessionID,
+		DeviceID:           req.DeviceID,
+	})
 	if err != nil {
-		WriteError(w, MapError(err))
+		writeLoginError(w, err)
 		return
 	}
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"token": token})
 }
 
+// writeLoginError responde a un login que no emitió token; los casos que el
+// cliente puede resolver (elegir sesión, segundo factor, esperar) llevan los
+// datos para hacerlo
+func writeLoginError(w http.ResponseWriter, err error) {
+	var limitErr *services.SessionLimitError
+	if errors.As(err, &limitErr) && limitErr.Policy == services.SessionPolicyChoose {
+		writeSessionChoice(w, limitErr)
+		return
+	}
+	var mfaErr *services.MFARequiredError
+	if errors.As(err, &mfaErr) {
+		writeMFAChallenge(w, mfaErr)
+		return
+	}
+	var lockedErr *services.LockedError
+	if errors.As(err, &lockedErr) {
+		setRetryAfter(w, lockedErr.RetryAfter)
+	}
+	WriteError(w, MapError(err))
+}
+
 func (h *APIHandler) JWTAuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		tokenStr := r.Header.Get("Authorization")
@@ -92,14 +146,16 @@ func (h *APIHandler) JWTAuthMiddleware(next http.Handler) http.Handler {
 			tokenStr = tokenStr[7:]
 		}
 
-		userID, role, err := h.AuthService.ValidateToken(tokenStr)
+		claims, err := h.AuthService.Authenticate(r.Context(), tokenStr)
 		if err != nil {
 			WriteError(w, MapError(err))
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), ctxUserID, userID)
-		ctx = context.WithValue(ctx, ctxRole, role)
+		ctx := context.WithValue(r.Context(), ctxUserID, claims.UserID)
+		ctx = context.WithValue(ctx, ctxUsername, claims.Username)
+		ctx = context.WithValue(ctx, ctxRole, claims.Role)
+		ctx = context.WithValue(ctx, ctxSessionID, claims.SessionID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -127,7 +183,7 @@ func (h *APIHandler) CreateNote(w http.ResponseWriter, r *http.Request) {
 		WriteError(w, MapError(apperrors.ErrUnauthorized))
 		return
 	}
-	note, err := h.NoteService.CreateNote(req.Title, req.Content, userID)
+	note, err := h.NoteService.CreateNote(r.Context(), req.Title, req.Content, userID)
 	if err != nil {
 		WriteError(w, MapError(err))
 		return
@@ -143,7 +199,7 @@ func (h *APIHandler) GetNotes(w http.ResponseWriter, r *http.Request) {
 		WriteError(w, MapError(apperrors.ErrUnauthorized))
 		return
 	}
-	notes, err := h.NoteService.GetNotesByUserID(userID)
+	notes, err := h.NoteService.GetNotesByUserID(r.Context(), userID)
 	if err != nil {
 		WriteError(w, MapError(err))
 		return
@@ -158,7 +214,7 @@ func (h *APIHandler) Logout(w http.ResponseWriter, r *http.Request) {
 		tokenStr = tokenStr[7:]
 	}
 
-	if err := h.AuthService.Logout(tokenStr); err != nil {
+	if err := h.AuthService.Logout(r.Context(), tokenStr); err != nil {
 		WriteError(w, MapError(err))
 		return
 	}
@@ -166,3 +222,114 @@ func (h *APIHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Successfully logged out"})
 }
+
+type sessionResponse struct {
+	ID           uint      `json:"id"`
+	UserAgent    string    `json:"user_agent"`
+	IP           string    `json:"ip"`
+	Country      string    `json:"country,omitempty"`
+	City         string    `json:"city,omitempty"`
+	ASN          uint      `json:"asn,omitempty"`
+	ASOrg        string    `json:"as_org,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	LastActivity time.Time `json:"last_activity"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	NewDevice    bool      `json:"new_device"`
+	Current      bool      `json:"current"`
+}
+
+func newSessionResponse(sess models.Session, currentID uint) sessionResponse {
+	return sessionResponse{
+		ID:           sess.ID,
+		UserAgent:    sess.UserAgent,
+		IP:           sess.IP,
+		Country:      sess.Country,
+		City:         sess.City,
+		ASN:          sess.ASN,
+		ASOrg:        sess.ASOrg,
+		CreatedAt:    sess.CreatedAt,
+		LastActivity: sess.LastActivity,
+		ExpiresAt:    sess.ExpiresAt,
+		NewDevice:    sess.NewDevice,
+		Current:      sess.ID == currentID,
+	}
+}
+
+// writeSessionChoice responde 409 con las sesiones activas para que el
+// cliente repita el login indicando terminate_session_id
+func writeSessionChoice(w http.ResponseWriter, limitErr *services.SessionLimitError) {
+	sessions := make([]sessionResponse, 0, len(limitErr.Sessions))
+	for _, sess := range limitErr.Sessions {
+		sessions = append(sessions, newSessionResponse(sess, 0))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(struct {
+		*APIError
+		Sessions []sessionResponse `json:"sessions"`
+	}{
+		APIError: MapError(limitErr),
+		Sessions: sessions,
+	})
+}
+
+func (h *APIHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(ctxUserID).(uint)
+	if !ok {
+		WriteError(w, MapError(apperrors.ErrUnauthorized))
+		return
+	}
+	currentID, _ := r.Context().Value(ctxSessionID).(uint)
+
+	sessions, err := h.AuthService.ListSessions(r.Context(), userID)
+	if err != nil {
+		WriteError(w, MapError(err))
+		return
+	}
+
+	resp := make([]sessionResponse, 0, len(sessions))
+	for _, sess := range sessions {
+		resp = append(resp, newSessionResponse(sess, currentID))
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (h *APIHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(ctxUserID).(uint)
+	if !ok {
+		WriteError(w, MapError(apperrors.ErrUnauthorized))
+		return
+	}
+
+	sessionID, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteError(w, MapError(apperrors.ErrSessionNotFound))
+		return
+	}
+
+	if err := h.AuthService.RevokeSession(r.Context(), userID, uint(sessionID)); err != nil {
+		WriteError(w, MapError(err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Session revoked"})
+}
+
+func (h *APIHandler) RevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(ctxUserID).(uint)
+	if !ok {
+		WriteError(w, MapError(apperrors.ErrUnauthorized))
+		return
+	}
+	currentID, _ := r.Context().Value(ctxSessionID).(uint)
+
+	revoked, err := h.AuthService.RevokeOtherSessions(r.Context(), userID, currentID)
+	if err != nil {
+		WriteError(w, MapError(err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]int{"revoked": revoked})
+}
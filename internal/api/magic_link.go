@@ -0,0 +1,81 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	apperrors "github.com/ramiroschettino/jwt-auth-api/internal/errors"
+	"github.com/ramiroschettino/jwt-auth-api/internal/services"
+)
+
+// magicLinkCookie guarda el secreto que ata el link al navegador que lo
+// pidió; sólo viaja a las rutas de /login/magic
+const (
+	magicLinkCookie     = "magic_link_device"
+	magicLinkCookiePath = "/login/magic"
+)
+
+// RequestMagicLink envía un link de login si el email corresponde a una
+// cuenta. La respuesta es siempre la misma para no revelar cuáles existen.
+func (h *APIHandler) RequestMagicLink(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, MapError(apperrors.ErrInvalidEmail))
+		return
+	}
+
+	binding, err := h.AuthService.RequestMagicLink(r.Context(), req.Email)
+	if err != nil {
+		WriteError(w, MapError(err))
+		return
+	}
+	if binding != "" {
+		http.SetCookie(w, &http.Cookie{
+			Name:     magicLinkCookie,
+			Value:    binding,
+			Path:     magicLinkCookiePath,
+			MaxAge:   int(h.AuthService.MagicLinkTTL().Seconds()),
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "If the account exists, a login link was sent"})
+}
+
+// MagicLinkLogin consume el token del link, que la página del link envía
+// como {"token": "..."}, y responde como POST /login. Sólo acepta POST: un
+// GET lo dispararía cualquier scanner de correo o prefetch que abra el link,
+// y el token quedaría en la URL que registra el log de requests.
+func (h *APIHandler) MagicLinkLogin(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token              string `json:"token"`
+		TerminateSessionID uint   `json:"terminate_session_id"`
+		DeviceID           string `json:"device_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		WriteError(w, MapError(apperrors.ErrMagicLinkInvalid))
+		return
+	}
+	var binding string
+	if cookie, err := r.Cookie(magicLinkCookie); err == nil {
+		binding = cookie.Value
+	}
+
+	token, err := h.AuthService.FinishMagicLink(r.Context(), req.Token, binding, r.Header.Get("User-Agent"), clientIP(r), services.LoginOptions{
+		TerminateSessionID: req.TerminateSessionID,
+		DeviceID:           req.DeviceID,
+	})
+	if err != nil {
+		writeLoginError(w, err)
+		return
+	}
+	if binding != "" {
+		http.SetCookie(w, &http.Cookie{Name: magicLinkCookie, Path: magicLinkCookiePath, MaxAge: -1, HttpOnly: true})
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"token": token})
+}
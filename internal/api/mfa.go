@@ -0,0 +1,185 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	apperrors "github.com/ramiroschettino/jwt-auth-api/internal/errors"
+	"github.com/ramiroschettino/jwt-auth-api/internal/mfa"
+	"github.com/ramiroschettino/jwt-auth-api/internal/services"
+)
+
+type totpEnrollmentResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+	// QRCode es el PNG del QR; encoding/json lo manda en base64
+	QRCode []byte `json:"qr_png"`
+}
+
+func writeTOTPEnrollment(w http.ResponseWriter, key *mfa.TOTPKey) {
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(totpEnrollmentResponse{Secret: key.Secret, URI: key.URI, QRCode: key.QRCode})
+}
+
+func writeRecoveryCodes(w http.ResponseWriter, codes []string) {
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string][]string{"recovery_codes": codes})
+}
+
+// writeMFAChallenge responde a un login por contraseña correcto al que le
+// falta el segundo factor
+func writeMFAChallenge(w http.ResponseWriter, mfaErr *services.MFARequiredError) {
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(struct {
+		MFARequired        bool      `json:"mfa_required"`
+		EnrollmentRequired bool      `json:"enrollment_required"`
+		Methods            []string  `json:"methods"`
+		ChallengeToken     string    `json:"challenge_token"`
+		ExpiresAt          time.Time `json:"expires_at"`
+	}{
+		MFARequired:        true,
+		EnrollmentRequired: mfaErr.Enroll,
+		Methods:            nonNil(mfaErr.Methods),
+		ChallengeToken:     mfaErr.Challenge,
+		ExpiresAt:          mfaErr.ExpiresAt,
+	})
+}
+
+// LoginMFA completa el login con el challenge y un código TOTP o de
+// recuperación
+func (h *APIHandler) LoginMFA(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ChallengeToken     string `json:"challenge_token"`
+		Code               string `json:"code"`
+		RecoveryCode       string `json:"recovery_code"`
+		TerminateSessionID uint   `json:"terminate_session_id"`
+		DeviceID           string `json:"device_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ChallengeToken == "" {
+		WriteError(w, MapError(apperrors.ErrMFAChallengeInvalid))
+		return
+	}
+	if req.Code == "" && req.RecoveryCode == "" {
+		WriteError(w, MapError(apperrors.ErrInvalidMFACode))
+		return
+	}
+
+	result, err := h.AuthService.CompleteMFALogin(r.Context(), req.ChallengeToken, req.Code, req.RecoveryCode,
+		r.Header.Get("User-Agent"), clientIP(r), services.LoginOptions{
+			TerminateSessionID: req.TerminateSessionID,
+			DeviceID:           req.DeviceID,
+		})
+	if err != nil {
+		writeLoginError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(struct {
+		Token         string   `json:"token"`
+		RecoveryCodes []string `json:"recovery_codes,omitempty"`
+	}{result.Token, result.RecoveryCodes})
+}
+
+// LoginMFAEnroll genera el secreto TOTP de un usuario cuyo rol exige segundo
+// factor y que todavía no lo configuró; se confirma con LoginMFA
+func (h *APIHandler) LoginMFAEnroll(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ChallengeToken string `json:"challenge_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ChallengeToken == "" {
+		WriteError(w, MapError(apperrors.ErrMFAChallengeInvalid))
+		return
+	}
+
+	key, err := h.AuthService.EnrollTOTPWithChallenge(r.Context(), req.ChallengeToken)
+	if err != nil {
+		WriteError(w, MapError(err))
+		return
+	}
+	writeTOTPEnrollment(w, key)
+}
+
+// MFAStatus informa si el usuario autenticado tiene segundo factor
+func (h *APIHandler) MFAStatus(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(ctxUserID).(uint)
+	if !ok {
+		WriteError(w, MapError(apperrors.ErrUnauthorized))
+		return
+	}
+	role, _ := r.Context().Value(ctxRole).(string)
+
+	status, err := h.AuthService.MFAStatus(r.Context(), userID, role)
+	if err != nil {
+		WriteError(w, MapError(err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"enabled":                  status.Enabled,
+		"methods":                  nonNil(status.Methods),
+		"required":                 status.Required,
+		"recovery_codes_remaining": status.RecoveryCodesRemaining,
+	})
+}
+
+// EnrollTOTP genera un secreto TOTP pendiente de confirmación
+func (h *APIHandler) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(ctxUserID).(uint)
+	if !ok {
+		WriteError(w, MapError(apperrors.ErrUnauthorized))
+		return
+	}
+	username, _ := r.Context().Value(ctxUsername).(string)
+
+	key, err := h.AuthService.EnrollTOTP(r.Context(), userID, username)
+	if err != nil {
+		WriteError(w, MapError(err))
+		return
+	}
+	writeTOTPEnrollment(w, key)
+}
+
+// ConfirmTOTP activa el secreto pendiente y devuelve los códigos de
+// recuperación
+func (h *APIHandler) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	h.withMFACode(w, r, h.AuthService.ConfirmTOTP)
+}
+
+// RegenerateRecoveryCodes reemplaza los códigos de recuperación
+func (h *APIHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	h.withMFACode(w, r, h.AuthService.RegenerateRecoveryCodes)
+}
+
+// withMFACode lee el código TOTP del body y responde con los códigos de
+// recuperación que devuelve action
+func (h *APIHandler) withMFACode(w http.ResponseWriter, r *http.Request, action func(ctx context.Context, userID uint, code string) ([]string, error)) {
+	userID, ok := r.Context().Value(ctxUserID).(uint)
+	if !ok {
+		WriteError(w, MapError(apperrors.ErrUnauthorized))
+		return
+	}
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		WriteError(w, MapError(apperrors.ErrInvalidMFACode))
+		return
+	}
+
+	codes, err := action(r.Context(), userID, req.Code)
+	if err != nil {
+		WriteError(w, MapError(err))
+		return
+	}
+	writeRecoveryCodes(w, codes)
+}
+
+// nonNil hace que una lista vacía se serialice como [] y no como null
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
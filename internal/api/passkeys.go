@@ -0,0 +1,219 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	apperrors "github.com/ramiroschettino/jwt-auth-api/internal/errors"
+	"github.com/ramiroschettino/jwt-auth-api/internal/models"
+	"github.com/ramiroschettino/jwt-auth-api/internal/services"
+)
+
+type passkeyResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	Synced     bool       `json:"synced"`
+}
+
+func newPasskeyResponse(c models.WebAuthnCredential) passkeyResponse {
+	return passkeyResponse{
+		ID:         c.ID,
+		Name:       c.Name,
+		CreatedAt:  c.CreatedAt,
+		LastUsedAt: c.LastUsedAt,
+		Synced:     c.BackupState,
+	}
+}
+
+// writePasskeyCeremony devuelve las opciones para navigator.credentials y el
+// token que el cliente tiene que mandar con la respuesta del autenticador
+func writePasskeyCeremony(w http.ResponseWriter, ceremony *services.PasskeyCeremony) {
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(struct {
+		Options       interface{} `json:"options"`
+		CeremonyToken string      `json:"ceremony_token"`
+	}{ceremony.Options, ceremony.Token})
+}
+
+// passkeyRequest es el body con el que se termina una ceremonia; Credential
+// es el PublicKeyCredential serializado tal como lo arma el navegador
+type passkeyRequest struct {
+	ChallengeToken     string          `json:"challenge_token"`
+	CeremonyToken      string          `json:"ceremony_token"`
+	Name               string          `json:"name"`
+	Credential         json.RawMessage `json:"credential"`
+	TerminateSessionID uint            `json:"terminate_session_id"`
+	DeviceID           string          `json:"device_id"`
+}
+
+func decodePasskeyRequest(r *http.Request) (*passkeyRequest, error) {
+	var req passkeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.CeremonyToken == "" || len(req.Credential) == 0 {
+		return nil, apperrors.ErrPasskeyInvalid
+	}
+	return &req, nil
+}
+
+// BeginPasskeyRegistration devuelve las opciones para crear una passkey
+func (h *APIHandler) BeginPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(ctxUserID).(uint)
+	if !ok {
+		WriteError(w, MapError(apperrors.ErrUnauthorized))
+		return
+	}
+
+	ceremony, err := h.AuthService.BeginPasskeyRegistration(r.Context(), userID)
+	if err != nil {
+		WriteError(w, MapError(err))
+		return
+	}
+	writePasskeyCeremony(w, ceremony)
+}
+
+// FinishPasskeyRegistration verifica y guarda la passkey creada
+func (h *APIHandler) FinishPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(ctxUserID).(uint)
+	if !ok {
+		WriteError(w, MapError(apperrors.ErrUnauthorized))
+		return
+	}
+	req, err := decodePasskeyRequest(r)
+	if err != nil {
+		WriteError(w, MapError(err))
+		return
+	}
+	if req.Name == "" || len(req.Name) > 100 {
+		WriteError(w, NewAPIError(http.StatusBadRequest, "passkey name must have between 1 and 100 characters"))
+		return
+	}
+
+	credential, err := h.AuthService.FinishPasskeyRegistration(r.Context(), userID, req.CeremonyToken, req.Name, req.Credential)
+	if err != nil {
+		WriteError(w, MapError(err))
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newPasskeyResponse(*credential))
+}
+
+// ListPasskeys lista las passkeys del usuario autenticado
+func (h *APIHandler) ListPasskeys(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(ctxUserID).(uint)
+	if !ok {
+		WriteError(w, MapError(apperrors.ErrUnauthorized))
+		return
+	}
+
+	credentials, err := h.AuthService.ListPasskeys(r.Context(), userID)
+	if err != nil {
+		WriteError(w, MapError(err))
+		return
+	}
+	resp := make([]passkeyResponse, 0, len(credentials))
+	for _, c := range credentials {
+		resp = append(resp, newPasskeyResponse(c))
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// DeletePasskey borra una passkey del usuario autenticado
+func (h *APIHandler) DeletePasskey(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(ctxUserID).(uint)
+	if !ok {
+		WriteError(w, MapError(apperrors.ErrUnauthorized))
+		return
+	}
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteError(w, MapError(apperrors.ErrPasskeyNotFound))
+		return
+	}
+
+	if err := h.AuthService.DeletePasskey(r.Context(), userID, uint(id)); err != nil {
+		WriteError(w, MapError(err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Passkey deleted"})
+}
+
+// BeginPasskeyLogin devuelve las opciones de un login sin contraseña
+func (h *APIHandler) BeginPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	ceremony, err := h.AuthService.BeginPasskeyLogin(r.Context())
+	if err != nil {
+		WriteError(w, MapError(err))
+		return
+	}
+	writePasskeyCeremony(w, ceremony)
+}
+
+// PasskeyLogin abre una sesión con la respuesta del autenticador
+func (h *APIHandler) PasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	req, err := decodePasskeyRequest(r)
+	if err != nil {
+		WriteError(w, MapError(err))
+		return
+	}
+
+	token, err := h.AuthService.FinishPasskeyLogin(r.Context(), req.CeremonyToken, req.Credential,
+		r.Header.Get("User-Agent"), clientIP(r), services.LoginOptions{
+			TerminateSessionID: req.TerminateSessionID,
+			DeviceID:           req.DeviceID,
+		})
+	if err != nil {
+		writeLoginError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"token": token})
+}
+
+// BeginPasskeySecondFactor devuelve las opciones para completar con una
+// passkey un login que pidió segundo factor
+func (h *APIHandler) BeginPasskeySecondFactor(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ChallengeToken string `json:"challenge_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ChallengeToken == "" {
+		WriteError(w, MapError(apperrors.ErrMFAChallengeInvalid))
+		return
+	}
+
+	ceremony, err := h.AuthService.BeginPasskeySecondFactor(r.Context(), req.ChallengeToken)
+	if err != nil {
+		WriteError(w, MapError(err))
+		return
+	}
+	writePasskeyCeremony(w, ceremony)
+}
+
+// LoginMFAPasskey es LoginMFA con una passkey en lugar de un código
+func (h *APIHandler) LoginMFAPasskey(w http.ResponseWriter, r *http.Request) {
+	req, err := decodePasskeyRequest(r)
+	if err != nil {
+		WriteError(w, MapError(err))
+		return
+	}
+	if req.ChallengeToken == "" {
+		WriteError(w, MapError(apperrors.ErrMFAChallengeInvalid))
+		return
+	}
+
+	result, err := h.AuthService.FinishPasskeySecondFactor(r.Context(), req.ChallengeToken, req.CeremonyToken, req.Credential,
+		r.Header.Get("User-Agent"), clientIP(r), services.LoginOptions{
+			TerminateSessionID: req.TerminateSessionID,
+			DeviceID:           req.DeviceID,
+		})
+	if err != nil {
+		writeLoginError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"token": result.Token})
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	apperrors "github.com/ramiroschettino/jwt-auth-api/internal/errors"
+)
+
+// ForgotPassword envía un link de recuperación si el email corresponde a una
+// cuenta. La respuesta es siempre la misma para no revelar cuáles existen.
+func (h *APIHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, MapError(apperrors.ErrInvalidEmail))
+		return
+	}
+
+	if err := h.AuthService.RequestPasswordReset(r.Context(), req.Email); err != nil {
+		WriteError(w, MapError(err))
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "If the account exists, a reset link was sent"})
+}
+
+// ResetPassword consume el token del link y fija la contraseña nueva; todas
+// las sesiones del usuario quedan cerradas
+func (h *APIHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, MapError(apperrors.ErrResetTokenInvalid))
+		return
+	}
+
+	if err := h.AuthService.ResetPassword(r.Context(), req.Token, req.Password, r.Header.Get("User-Agent"), clientIP(r)); err != nil {
+		WriteError(w, MapError(err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password updated"})
+}
+
+// ChangePassword cambia la contraseña del usuario autenticado. La sesión del
+// request sigue abierta; las demás se cierran.
+func (h *APIHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(ctxUserID).(uint)
+	if !ok {
+		WriteError(w, MapError(apperrors.ErrUnauthorized))
+		return
+	}
+	currentID, _ := r.Context().Value(ctxSessionID).(uint)
+
+	var req struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, NewAPIError(http.StatusBadRequest, "invalid request body"))
+		return
+	}
+
+	err := h.AuthService.ChangePassword(r.Context(), userID, currentID, req.CurrentPassword, req.NewPassword,
+		r.Header.Get("User-Agent"), clientIP(r))
+	if err != nil {
+		WriteError(w, MapError(err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password updated"})
+}
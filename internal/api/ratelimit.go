@@ -0,0 +1,105 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+
+	apperrors "github.com/ramiroschettino/jwt-auth-api/internal/errors"
+	"github.com/ramiroschettino/jwt-auth-api/internal/ratelimit"
+)
+
+// apiClientHeader identifica al cliente de la API (una integración, no un
+// usuario). No está autenticado: sólo debería usarse como clave detrás de un
+// gateway que lo valide.
+const apiClientHeader = "X-API-Client"
+
+// RateLimitKey elige la clave del balde para un request
+type RateLimitKey func(r *http.Request) string
+
+// KeyByIP limita por IP del cliente
+func KeyByIP(r *http.Request) string {
+	return "ip:" + clientIP(r)
+}
+
+// KeyByUser limita por usuario autenticado; sin usuario en el contexto cae
+// a la IP. Va después de JWTAuthMiddleware.
+func KeyByUser(r *http.Request) string {
+	if userID, ok := r.Context().Value(ctxUserID).(uint); ok {
+		return fmt.Sprintf("user:%d", userID)
+	}
+	return KeyByIP(r)
+}
+
+// KeyByAPIClient limita por el header X-API-Client y, si no viene, por
+// usuario o IP
+func KeyByAPIClient(r *http.Request) string {
+	if client := r.Header.Get(apiClientHeader); client != "" {
+		return "client:" + client
+	}
+	return KeyByUser(r)
+}
+
+// RateLimiter crea un limitador token bucket por ruta. Los límites se
+// declaran en el router y pueden pisarse por nombre desde la configuración.
+type RateLimiter struct {
+	enabled   bool
+	overrides map[string]ratelimit.Limit
+
+	mu       sync.Mutex
+	limiters map[string]*ratelimit.Limiter
+}
+
+func NewRateLimiter(enabled bool, overrides map[string]ratelimit.Limit) *RateLimiter {
+	return &RateLimiter{
+		enabled:   enabled,
+		overrides: overrides,
+		limiters:  make(map[string]*ratelimit.Limiter),
+	}
+}
+
+// limiter devuelve el limitador de la ruta name, creándolo la primera vez.
+// Rutas con el mismo nombre comparten baldes.
+func (rl *RateLimiter) limiter(name string, limit ratelimit.Limit) *ratelimit.Limiter {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if limiter, ok := rl.limiters[name]; ok {
+		return limiter
+	}
+	if override, ok := rl.overrides[name]; ok {
+		limit = override
+	}
+	limiter := ratelimit.NewLimiter(limit)
+	rl.limiters[name] = limiter
+	return limiter
+}
+
+// Limit devuelve un middleware que aplica limit por cada clave de key.
+// Informa el estado del balde en los headers RateLimit-Limit,
+// RateLimit-Remaining y RateLimit-Reset y, al agotarse, responde 429 con
+// Retry-After.
+func (rl *RateLimiter) Limit(name string, limit ratelimit.Limit, key RateLimitKey) func(http.Handler) http.Handler {
+	if !rl.enabled {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	limiter := rl.limiter(name, limit)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			result := limiter.Allow(key(r))
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil(result.Reset.Seconds()))))
+			if !result.Allowed {
+				setRetryAfter(w, result.RetryAfter)
+				WriteError(w, MapError(apperrors.ErrRateLimited))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ramiroschettino/jwt-auth-api/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiter(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	limiter := NewRateLimiter(true, map[string]ratelimit.Limit{"login": ratelimit.PerPeriod(1, time.Minute)})
+	handler := limiter.Limit("login", ratelimit.PerPeriod(100, time.Minute), KeyByIP)(ok)
+
+	request := func(remote string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/login", nil)
+		req.RemoteAddr = remote
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// El override de la configuración pisa el límite del router
+	rec := request("203.0.113.7:5000")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "0", rec.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "60", rec.Header().Get("RateLimit-Reset"))
+
+	rec = request("203.0.113.7:6000")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "60", rec.Header().Get("Retry-After"))
+	var apiErr APIError
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&apiErr))
+	assert.Equal(t, "rate_limited", apiErr.ErrorCode)
+
+	// Otra IP tiene su propio balde
+	assert.Equal(t, http.StatusOK, request("198.51.100.9:5000").Code)
+
+	// Desactivado no limita ni agrega headers
+	disabled := NewRateLimiter(false, nil).Limit("login", ratelimit.PerPeriod(1, time.Minute), KeyByIP)(ok)
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		disabled.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/login", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, rec.Header().Get("RateLimit-Limit"))
+	}
+}
+
+func TestRateLimitKeys(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/notes", nil)
+	req.RemoteAddr = "203.0.113.7:5000"
+	assert.Equal(t, "ip:203.0.113.7", KeyByIP(req))
+	assert.Equal(t, "ip:203.0.113.7", KeyByUser(req))
+
+	req = req.WithContext(context.WithValue(req.Context(), ctxUserID, uint(42)))
+	assert.Equal(t, "user:42", KeyByUser(req))
+	assert.Equal(t, "user:42", KeyByAPIClient(req))
+
+	req.Header.Set(apiClientHeader, "billing")
+	assert.Equal(t, "client:billing", KeyByAPIClient(req))
+}
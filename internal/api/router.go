@@ -2,24 +2,84 @@ package api
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/ramiroschettino/jwt-auth-api/internal/ratelimit"
+)
+
+// Límites por ruta; RATE_LIMITS los pisa por nombre
+var (
+	registerLimit   = ratelimit.PerPeriod(10, time.Hour)
+	loginLimit      = ratelimit.PerPeriod(20, time.Minute)
+	mfaLimit        = ratelimit.PerPeriod(10, time.Minute)
+	emailSendLimit  = ratelimit.PerPeriod(5, time.Hour)
+	forgotLimit     = ratelimit.PerPeriod(5, time.Hour)
+	createNoteLimit = ratelimit.PerPeriod(30, time.Minute)
+	apiLimit        = ratelimit.PerPeriod(120, time.Minute)
 )
 
 func NewRouter(handler *APIHandler) *chi.Mux {
 	r := chi.NewRouter()
+	r.Use(handler.ClientIP.Middleware)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 
-	r.Post("/register", handler.Register)
-	r.Post("/login", handler.Login)
+	limit := handler.RateLimits.Limit
+
+	r.With(limit("register", registerLimit, KeyByIP)).Post("/register", handler.Register)
+	r.With(limit("login", loginLimit, KeyByIP)).Post("/login", handler.Login)
+	r.With(limit("login_mfa", mfaLimit, KeyByIP)).Post("/login/mfa", handler.LoginMFA)
+	r.With(limit("login_mfa", mfaLimit, KeyByIP)).Post("/login/mfa/enroll", handler.LoginMFAEnroll)
+	r.With(limit("login_mfa", mfaLimit, KeyByIP)).Post("/login/mfa/passkey/options", handler.BeginPasskeySecondFactor)
+	r.With(limit("login_mfa", mfaLimit, KeyByIP)).Post("/login/mfa/passkey", handler.LoginMFAPasskey)
+	r.With(limit("login", loginLimit, KeyByIP)).Post("/login/passkey/options", handler.BeginPasskeyLogin)
+	r.With(limit("login", loginLimit, KeyByIP)).Post("/login/passkey", handler.PasskeyLogin)
+	r.With(limit("magic_link", forgotLimit, KeyByIP)).Post("/login/magic", handler.RequestMagicLink)
+	r.With(limit("login", loginLimit, KeyByIP)).Post("/login/magic/verify", handler.MagicLinkLogin)
+	r.With(limit("verify_email", mfaLimit, KeyByIP)).Post("/email/verify", handler.VerifyEmail)
+	r.With(limit("verification_request", forgotLimit, KeyByIP)).Post("/email/verification", handler.RequestEmailVerification)
+	r.With(limit("password_forgot", forgotLimit, KeyByIP)).Post("/password/forgot", handler.ForgotPassword)
+	r.With(limit("password_reset", mfaLimit, KeyByIP)).Post("/password/reset", handler.ResetPassword)
 
 	r.Group(func(r chi.Router) {
 		r.Use(handler.JWTAuthMiddleware)
+		r.Use(limit("api", apiLimit, KeyByUser))
 		r.Post("/logout", handler.Logout)
-		r.Post("/notes", handler.CreateNote)
-		r.Get("/notes", handler.GetNotes)
+		r.Group(func(r chi.Router) {
+			r.Use(handler.RequireVerifiedEmail)
+			r.With(limit("create_note", createNoteLimit, KeyByUser)).Post("/notes", handler.CreateNote)
+			r.Get("/notes", handler.GetNotes)
+		})
+
+		r.Get("/sessions", handler.ListSessions)
+		r.Post("/sessions/revoke-others", handler.RevokeOtherSessions)
+		r.Delete("/sessions/{id}", handler.RevokeSession)
+
+		r.Get("/me/login-history", handler.LoginHistory)
+
+		r.With(limit("password_change", mfaLimit, KeyByUser)).Put("/me/password", handler.ChangePassword)
+
+		r.Get("/me/mfa", handler.MFAStatus)
+		r.Post("/me/mfa/totp", handler.EnrollTOTP)
+		r.With(limit("mfa_code", mfaLimit, KeyByUser)).Post("/me/mfa/totp/confirm", handler.ConfirmTOTP)
+		r.With(limit("mfa_code", mfaLimit, KeyByUser)).Post("/me/mfa/recovery-codes", handler.RegenerateRecoveryCodes)
+
+		r.Get("/me/email", handler.EmailStatus)
+		r.With(limit("email_send", emailSendLimit, KeyByUser)).Put("/me/email", handler.ChangeEmail)
+		r.With(limit("email_send", emailSendLimit, KeyByUser)).Post("/me/email/verification", handler.ResendEmailVerification)
+
+		r.Get("/me/passkeys", handler.ListPasskeys)
+		r.Post("/me/passkeys/register/options", handler.BeginPasskeyRegistration)
+		r.Post("/me/passkeys/register", handler.FinishPasskeyRegistration)
+		r.Delete("/me/passkeys/{id}", handler.DeletePasskey)
+
+		r.Group(func(r chi.Router) {
+			r.Use(RequireRole("admin"))
+			r.Get("/admin/auth-events", handler.AdminAuthEvents)
+			r.Post("/admin/lockouts/unlock", handler.AdminUnlock)
+		})
 	})
 
 	r.Get("/swagger", func(w http.ResponseWriter, r *http.Request) {
@@ -55,6 +115,6 @@ func NewRouter(handler *APIHandler) *chi.Mux {
 	return r
 }
 
-func ListenAndServe(addr string, handler http.Handler) error {
-	return http.ListenAndServe(addr, handler)
+func NewServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{Addr: addr, Handler: handler}
 }
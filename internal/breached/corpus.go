@@ -0,0 +1,75 @@
+// Package breached consulta una copia local de contraseñas filtradas con el
+// formato de rangos de k-anonimato de Have I Been Pwned: un archivo por
+// prefijo de 5 caracteres del SHA-1 (ej. 5BAA6.txt) con líneas SUFIJO:CUENTA.
+// Sólo se lee el archivo del prefijo, así que no hace falta cargar el corpus
+// en memoria.
+package breached
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// prefixLength es la cantidad de caracteres hex del SHA-1 que nombra cada
+// archivo del corpus
+const prefixLength = 5
+
+// Corpus es un directorio de archivos de rango
+type Corpus struct {
+	dir string
+}
+
+// Open valida que dir exista y sea un directorio
+func Open(dir string) (*Corpus, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s no es un directorio", dir)
+	}
+	return &Corpus{dir: dir}, nil
+}
+
+// Count devuelve cuántas veces aparece la contraseña en el corpus (0 si no
+// está). Un prefijo sin archivo cuenta como ninguna aparición.
+func (c *Corpus) Count(ctx context.Context, password string) (int, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:prefixLength], hash[prefixLength:]
+
+	f, err := os.Open(filepath.Join(c.dir, prefix+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		line := strings.TrimSpace(scanner.Text())
+		candidate, count, ok := strings.Cut(line, ":")
+		if !ok || !strings.EqualFold(candidate, suffix) {
+			continue
+		}
+		n, err := strconv.Atoi(count)
+		if err != nil {
+			return 0, fmt.Errorf("línea inválida en %s.txt: %q", prefix, line)
+		}
+		return n, nil
+	}
+	return 0, scanner.Err()
+}
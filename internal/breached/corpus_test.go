@@ -0,0 +1,34 @@
+package breached
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCorpusCount(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	// SHA-1("password") = 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "5BAA6.txt"),
+		[]byte("003D68EB55068C33ACE09247EE4C639306B:3\r\n1E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\r\n"), 0o644))
+
+	corpus, err := Open(dir)
+	require.NoError(t, err)
+
+	count, err := corpus.Count(ctx, "password")
+	require.NoError(t, err)
+	assert.Equal(t, 9545824, count)
+
+	// Mismo prefijo, otro sufijo; y un prefijo sin archivo
+	count, err = corpus.Count(ctx, "correct horse battery staple")
+	require.NoError(t, err)
+	assert.Zero(t, count)
+
+	_, err = Open(filepath.Join(dir, "5BAA6.txt"))
+	assert.Error(t, err, "tiene que ser un directorio")
+}
@@ -0,0 +1,73 @@
+package cache
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+// BloomFilter es un filtro de Bloom simple sobre un bitset. No es seguro para
+// uso concurrente; RevocationCache lo protege con su propio mutex.
+type BloomFilter struct {
+	bits []uint64
+	m    uint64
+	k    uint64
+}
+
+// NewBloomFilter dimensiona el filtro para n elementos con una tasa de falsos
+// positivos p
+func NewBloomFilter(n int, p float64) *BloomFilter {
+	if n < 1 {
+		n = 1
+	}
+	if p <= 0 || p >= 1 {
+		p = 0.01
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+	k := uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &BloomFilter{
+		bits: make([]uint64, (m+63)/64),
+		m:    m,
+		k:    k,
+	}
+}
+
+func (b *BloomFilter) Add(key string) {
+	h1, h2 := hashes(key)
+	for i := uint64(0); i < b.k; i++ {
+		pos := (h1 + i*h2) % b.m
+		b.bits[pos/64] |= 1 << (pos % 64)
+	}
+}
+
+// Test devuelve false si la clave seguro no fue agregada
+func (b *BloomFilter) Test(key string) bool {
+	h1, h2 := hashes(key)
+	for i := uint64(0); i < b.k; i++ {
+		pos := (h1 + i*h2) % b.m
+		if b.bits[pos/64]&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *BloomFilter) Reset() {
+	for i := range b.bits {
+		b.bits[i] = 0
+	}
+}
+
+// hashes usa doble hashing (Kirsch-Mitzenmacher) a partir de FNV
+func hashes(key string) (uint64, uint64) {
+	a := fnv.New64a()
+	a.Write([]byte(key))
+	b := fnv.New64()
+	b.Write([]byte(key))
+	return a.Sum64(), b.Sum64() | 1
+}
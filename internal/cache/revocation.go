@@ -0,0 +1,242 @@
+package cache
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ramiroschettino/jwt-auth-api/internal/models"
+	"github.com/ramiroschettino/jwt-auth-api/internal/repositories"
+)
+
+// RevocationCache se ubica delante de UserRepository y del SessionStore para
+// evitar consultas en cada request autenticado:
+//   - un filtro de Bloom con los jti revocados: si el filtro dice que un jti no
+//     está, no hace falta consultar invalid_tokens
+//   - un LRU de sesiones activas indexado por jti
+//
+// Las revocaciones hechas por esta instancia se reflejan al instante. Las de
+// otras réplicas se ven recién en el próximo Resync, por lo que el intervalo
+// define la ventana máxima de desfase entre réplicas.
+type RevocationCache struct {
+	userRepo    repositories.UserStore
+	sessionRepo repositories.SessionStore
+
+	mu      sync.RWMutex
+	revoked *BloomFilter
+	// pending guarda los jti revocados mientras corre un Resync, para
+	// agregarlos al filtro nuevo antes de reemplazar el actual (nil si no hay
+	// ningún Resync en curso)
+	pending  []string
+	resyncMu sync.Mutex
+	// loads lleva una generación por jti mientras se lee su sesión de la
+	// base. ForgetSession, Revoke y Resync la incrementan, y la lectura sólo
+	// guarda la sesión en el LRU si la generación no cambió: así no vuelve a
+	// la caché una sesión descartada mientras se leía.
+	loads      map[string]*sessionLoad
+	bloomSize  int
+	bloomFPR   float64
+	sessions   *LRU[string, models.Session]
+	interval   time.Duration
+	stop       chan struct{}
+	stopOnce   sync.Once
+	stopWaiter sync.WaitGroup
+}
+
+type sessionLoad struct {
+	refs int
+	gen  uint64
+}
+
+type Options struct {
+	// BloomCapacity es la cantidad esperada de tokens revocados vigentes
+	BloomCapacity int
+	// BloomFalsePositiveRate es la proporción tolerada de consultas innecesarias
+	BloomFalsePositiveRate float64
+	// SessionCacheSize es la cantidad máxima de sesiones activas en memoria
+	SessionCacheSize int
+	// ResyncInterval es cada cuánto se reconstruye la caché desde la base
+	ResyncInterval time.Duration
+}
+
+func NewRevocationCache(userRepo repositories.UserStore, sessionRepo repositories.SessionStore, opts Options) *RevocationCache {
+	if opts.BloomCapacity <= 0 {
+		opts.BloomCapacity = 100000
+	}
+	if opts.BloomFalsePositiveRate <= 0 {
+		opts.BloomFalsePositiveRate = 0.01
+	}
+	if opts.SessionCacheSize <= 0 {
+		opts.SessionCacheSize = 10000
+	}
+	if opts.ResyncInterval <= 0 {
+		opts.ResyncInterval = time.Minute
+	}
+	return &RevocationCache{
+		userRepo:    userRepo,
+		sessionRepo: sessionRepo,
+		revoked:     NewBloomFilter(opts.BloomCapacity, opts.BloomFalsePositiveRate),
+		bloomSize:   opts.BloomCapacity,
+		bloomFPR:    opts.BloomFalsePositiveRate,
+		sessions:    NewLRU[string, models.Session](opts.SessionCacheSize),
+		loads:       make(map[string]*sessionLoad),
+		interval:    opts.ResyncInterval,
+		stop:        make(chan struct{}),
+	}
+}
+
+// IsTokenRevoked solo consulta la base cuando el filtro de Bloom da positivo
+func (c *RevocationCache) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	c.mu.RLock()
+	maybe := c.revoked.Test(jti)
+	c.mu.RUnlock()
+
+	if !maybe {
+		return false, nil
+	}
+	return c.userRepo.IsTokenRevoked(ctx, jti)
+}
+
+// GetActiveSessionByJTI devuelve la sesión desde memoria si está y no venció
+func (c *RevocationCache) GetActiveSessionByJTI(ctx context.Context, jti string) (*models.Session, error) {
+	if session, ok := c.sessions.Get(jti); ok {
+		if session.IsActive && !session.IsExpired() {
+			return &session, nil
+		}
+		c.sessions.Remove(jti)
+	}
+
+	c.mu.Lock()
+	load, ok := c.loads[jti]
+	if !ok {
+		load = &sessionLoad{}
+		c.loads[jti] = load
+	}
+	load.refs++
+	gen := load.gen
+	c.mu.Unlock()
+
+	session, err := c.sessionRepo.GetActiveSessionByJTI(ctx, jti)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err == nil && load.gen == gen {
+		c.sessions.Add(jti, *session)
+	}
+	load.refs--
+	if load.refs == 0 {
+		delete(c.loads, jti)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// forgetLocked descarta la sesión cacheada y hace que las lecturas en curso
+// de ese jti no la vuelvan a guardar. Requiere c.mu.
+func (c *RevocationCache) forgetLocked(jti string) {
+	if load, ok := c.loads[jti]; ok {
+		load.gen++
+	}
+	c.sessions.Remove(jti)
+}
+
+// Revoke marca el jti como revocado y descarta su sesión cacheada.
+// Se llama después de escribir la revocación en la base.
+func (c *RevocationCache) Revoke(jti string) {
+	if jti == "" {
+		return
+	}
+	c.mu.Lock()
+	c.revoked.Add(jti)
+	if c.pending != nil {
+		c.pending = append(c.pending, jti)
+	}
+	c.forgetLocked(jti)
+	c.mu.Unlock()
+}
+
+// ForgetSession descarta la sesión cacheada sin marcar el jti como revocado,
+// por ejemplo cuando una sesión se desactiva por límite de sesiones
+func (c *RevocationCache) ForgetSession(jti string) {
+	c.mu.Lock()
+	c.forgetLocked(jti)
+	c.mu.Unlock()
+}
+
+// Resync reconstruye el filtro con los jti revocados vigentes y vacía el LRU
+// para tomar los cambios hechos por otras réplicas. Las revocaciones locales
+// hechas mientras se lee la base se suman al filtro nuevo, porque la lectura
+// puede no incluirlas.
+func (c *RevocationCache) Resync(ctx context.Context) error {
+	c.resyncMu.Lock()
+	defer c.resyncMu.Unlock()
+
+	c.mu.Lock()
+	c.pending = []string{}
+	c.mu.Unlock()
+
+	jtis, err := c.userRepo.FindRevokedJTIs(ctx)
+	if err != nil {
+		c.mu.Lock()
+		c.pending = nil
+		c.mu.Unlock()
+		return err
+	}
+
+	size := c.bloomSize
+	if len(jtis) > size {
+		size = len(jtis) * 2
+	}
+	filter := NewBloomFilter(size, c.bloomFPR)
+	for _, jti := range jtis {
+		filter.Add(jti)
+	}
+
+	c.mu.Lock()
+	for _, jti := range c.pending {
+		filter.Add(jti)
+	}
+	c.revoked = filter
+	c.pending = nil
+	for _, load := range c.loads {
+		load.gen++
+	}
+	c.sessions.Purge()
+	c.mu.Unlock()
+	return nil
+}
+
+// Start hace un Resync inicial y luego lo repite cada ResyncInterval
+func (c *RevocationCache) Start(ctx context.Context) error {
+	if err := c.Resync(ctx); err != nil {
+		return err
+	}
+
+	c.stopWaiter.Add(1)
+	go func() {
+		defer c.stopWaiter.Done()
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := c.Resync(ctx); err != nil {
+					log.Printf("Error al resincronizar la caché de revocaciones: %v", err)
+				}
+			case <-c.stop:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (c *RevocationCache) Stop() {
+	c.stopOnce.Do(func() { close(c.stop) })
+	c.stopWaiter.Wait()
+}
@@ -0,0 +1,223 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/ramiroschettino/jwt-auth-api/internal/models"
+	"github.com/ramiroschettino/jwt-auth-api/internal/repositories"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestBloomFilter(t *testing.T) {
+	bf := NewBloomFilter(1000, 0.01)
+	for i := 0; i < 1000; i++ {
+		bf.Add(fmt.Sprintf("jti-%d", i))
+	}
+	for i := 0; i < 1000; i++ {
+		assert.True(t, bf.Test(fmt.Sprintf("jti-%d", i)))
+	}
+
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if bf.Test(fmt.Sprintf("otro-%d", i)) {
+			falsePositives++
+		}
+	}
+	assert.Less(t, falsePositives, 300)
+
+	bf.Reset()
+	assert.False(t, bf.Test("jti-1"))
+}
+
+func TestLRU(t *testing.T) {
+	c := NewLRU[string, int](2)
+	c.Add("a", 1)
+	c.Add("b", 2)
+	_, _ = c.Get("a")
+	c.Add("c", 3)
+
+	_, ok := c.Get("b")
+	assert.False(t, ok, "b era el menos usado y debió descartarse")
+	v, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+
+	c.Remove("a")
+	_, ok = c.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 1, c.Len())
+
+	c.Purge()
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestRevocationCache(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.Session{}, &models.InvalidToken{}))
+
+	var queries int
+	var afterQuery func()
+	db.Callback().Query().After("gorm:query").Register("test:count", func(*gorm.DB) {
+		queries++
+		if afterQuery != nil {
+			afterQuery()
+		}
+	})
+	db.Callback().Row().After("gorm:row").Register("test:count_row", func(*gorm.DB) { queries++ })
+
+	userRepo := repositories.NewUserRepository(db)
+	sessionRepo := repositories.NewSessionRepository(db)
+
+	require.NoError(t, userRepo.InvalidateToken(ctx, "token-viejo", "revocado", time.Now().Add(time.Hour)))
+	require.NoError(t, sessionRepo.CreateSession(ctx, &models.Session{
+		UserID:       1,
+		Token:        "token-activo",
+		JTI:          "activo",
+		LastActivity: time.Now(),
+		ExpiresAt:    time.Now().Add(time.Hour),
+		IsActive:     true,
+	}))
+
+	rc := NewRevocationCache(userRepo, sessionRepo, Options{ResyncInterval: time.Hour})
+	require.NoError(t, rc.Resync(ctx))
+
+	isRevoked := func(jti string) bool {
+		revoked, err := rc.IsTokenRevoked(ctx, jti)
+		require.NoError(t, err)
+		return revoked
+	}
+
+	t.Run("jti no revocado no consulta la base", func(t *testing.T) {
+		queries = 0
+		assert.False(t, isRevoked("activo"))
+		assert.Equal(t, 0, queries)
+	})
+
+	t.Run("jti revocado se confirma en la base", func(t *testing.T) {
+		assert.True(t, isRevoked("revocado"))
+	})
+
+	t.Run("sesión activa queda en el LRU", func(t *testing.T) {
+		session, err := rc.GetActiveSessionByJTI(ctx, "activo")
+		require.NoError(t, err)
+		assert.Equal(t, uint(1), session.UserID)
+
+		queries = 0
+		_, err = rc.GetActiveSessionByJTI(ctx, "activo")
+		require.NoError(t, err)
+		assert.Equal(t, 0, queries)
+	})
+
+	t.Run("Revoke invalida al instante", func(t *testing.T) {
+		require.NoError(t, sessionRepo.DeactivateSession(ctx, "token-activo"))
+		require.NoError(t, userRepo.InvalidateToken(ctx, "token-activo", "activo", time.Now().Add(time.Hour)))
+		rc.Revoke("activo")
+
+		assert.True(t, isRevoked("activo"))
+		_, err := rc.GetActiveSessionByJTI(ctx, "activo")
+		assert.Error(t, err)
+	})
+
+	t.Run("Resync toma revocaciones de otras réplicas", func(t *testing.T) {
+		require.NoError(t, userRepo.InvalidateToken(ctx, "token-remoto", "remoto", time.Now().Add(time.Hour)))
+		assert.False(t, isRevoked("remoto"))
+
+		require.NoError(t, rc.Resync(ctx))
+		assert.True(t, isRevoked("remoto"))
+	})
+
+	t.Run("Resync conserva revocaciones hechas durante la lectura", func(t *testing.T) {
+		// La revocación llega después de que Resync leyó la base, así que
+		// sólo se conserva si se suma al filtro nuevo
+		afterQuery = func() {
+			afterQuery = nil
+			require.NoError(t, userRepo.InvalidateToken(ctx, "token-concurrente", "concurrente", time.Now().Add(time.Hour)))
+			rc.Revoke("concurrente")
+		}
+		require.NoError(t, rc.Resync(ctx))
+		assert.True(t, isRevoked("concurrente"))
+	})
+
+	t.Run("ForgetSession durante la lectura no deja la sesión en el LRU", func(t *testing.T) {
+		require.NoError(t, sessionRepo.CreateSession(ctx, &models.Session{
+			UserID:       2,
+			Token:        "token-olvidado",
+			JTI:          "olvidado",
+			LastActivity: time.Now(),
+			ExpiresAt:    time.Now().Add(time.Hour),
+			IsActive:     true,
+		}))
+
+		// La sesión se desactiva después de que el request la leyó y antes
+		// de que la guarde en el LRU
+		afterQuery = func() {
+			afterQuery = nil
+			require.NoError(t, sessionRepo.DeactivateSession(ctx, "token-olvidado"))
+			rc.ForgetSession("olvidado")
+		}
+		_, err := rc.GetActiveSessionByJTI(ctx, "olvidado")
+		require.NoError(t, err)
+
+		_, err = rc.GetActiveSessionByJTI(ctx, "olvidado")
+		assert.Error(t, err)
+	})
+}
+
+func TestRevocationCacheConcurrentForget(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.Session{}, &models.InvalidToken{}))
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	userRepo := repositories.NewUserRepository(db)
+	sessionRepo := repositories.NewSessionRepository(db)
+	rc := NewRevocationCache(userRepo, sessionRepo, Options{ResyncInterval: time.Hour})
+
+	// Lecturas y desactivaciones en paralelo: al terminar, ninguna sesión
+	// desactivada puede seguir en el LRU
+	for i := 0; i < 50; i++ {
+		jti := fmt.Sprintf("jti-%d", i)
+		token := fmt.Sprintf("token-%d", i)
+		require.NoError(t, sessionRepo.CreateSession(ctx, &models.Session{
+			UserID:       uint(i + 1),
+			Token:        token,
+			JTI:          jti,
+			LastActivity: time.Now(),
+			ExpiresAt:    time.Now().Add(time.Hour),
+			IsActive:     true,
+		}))
+
+		var wg sync.WaitGroup
+		for r := 0; r < 4; r++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				rc.GetActiveSessionByJTI(ctx, jti)
+			}()
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, sessionRepo.DeactivateSession(ctx, token))
+			rc.ForgetSession(jti)
+		}()
+		wg.Wait()
+
+		_, err := rc.GetActiveSessionByJTI(ctx, jti)
+		assert.Error(t, err, jti)
+	}
+}
@@ -2,10 +2,14 @@ package config
 
 import (
 	"fmt"
+	"net/netip"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/ramiroschettino/jwt-auth-api/internal/ratelimit"
 )
 
 type Config struct {
@@ -16,6 +20,148 @@ type Config struct {
 	RefreshExpiration time.Duration
 	Port              string
 	Env               string
+	DBQueryTimeout    time.Duration
+
+	// Proxies de los que se aceptan X-Forwarded-For y Forwarded
+	TrustedProxies []netip.Prefix
+
+	// Vencimiento de sesiones por inactividad, por antigüedad y renovación
+	// deslizante. Un valor cero desactiva el control correspondiente.
+	SessionIdleTimeout time.Duration
+	SessionMaxLifetime time.Duration
+	SessionSliding     bool
+
+	// Límite de sesiones simultáneas (0 = sin límite), por rol y política
+	// al superarlo: "evict_oldest", "reject" o "choose"
+	MaxSessionsPerUser int
+	MaxSessionsByRole  map[string]int
+	SessionLimitPolicy string
+
+	// Bloqueo por logins fallidos: umbrales por usuario y por IP (0 = sin
+	// bloqueo), duración inicial que se duplica con cada falla extra hasta el
+	// máximo, y ventana tras la cual se olvidan las fallas
+	LockoutUserThreshold int
+	LockoutIPThreshold   int
+	LockoutBaseDuration  time.Duration
+	LockoutMaxDuration   time.Duration
+	LockoutWindow        time.Duration
+
+	// Registro que no revela si el usuario ya existe: responde siempre 202 y
+	// avisa al dueño de la cuenta existente
+	RegistrationEnumerationSafe bool
+
+	// Segundo factor TOTP: roles que lo exigen (ej: admin), nombre con el que
+	// aparece en la app de autenticación y vida del challenge del login
+	MFARequiredRoles []string
+	MFAIssuer        string
+	MFAChallengeTTL  time.Duration
+
+	// Passkeys (WebAuthn): se habilitan al definir el RP ID, que es el dominio
+	// del sitio; los orígenes son las URLs desde las que se aceptan
+	// ceremonias (por defecto https://<RP ID>)
+	WebAuthnRPID      string
+	WebAuthnRPName    string
+	WebAuthnRPOrigins []string
+
+	// Envío de correos: Mailer es "smtp", "file" (deja archivos .eml en
+	// MailDropDir, para desarrollo) o "none"
+	Mailer       string
+	MailFrom     string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	MailDropDir  string
+
+	// Verificación de email: URL del link (recibe ?token=), vida del link y
+	// política para cuentas sin verificar ("off", "restrict" o "block")
+	EmailVerificationURL    string
+	EmailVerificationTTL    time.Duration
+	EmailVerificationPolicy string
+
+	// Recuperación de contraseña: URL del link (recibe ?token=) y su vida.
+	// Se habilita sólo si hay un Mailer configurado.
+	PasswordResetURL string
+	PasswordResetTTL time.Duration
+
+	// Hash de contraseñas: PasswordHash es "argon2id" o "bcrypt". Los hashes
+	// de otro algoritmo o con otros parámetros se regeneran en el próximo
+	// login correcto. Argon2Memory va en KiB.
+	PasswordHash      string
+	Argon2Memory      int
+	Argon2Iterations  int
+	Argon2Parallelism int
+	BcryptCost        int
+
+	// Login por link enviado por email (requiere un Mailer): URL del link
+	// (recibe ?token=), vida del link y si sólo sirve en el navegador que lo
+	// pidió
+	MagicLinkEnabled    bool
+	MagicLinkURL        string
+	MagicLinkTTL        time.Duration
+	MagicLinkBindDevice bool
+
+	// Política de contraseñas nuevas: largo mínimo en caracteres, máximo en
+	// bytes, clases requeridas ("lower", "upper", "digit", "symbol") y si se
+	// rechazan las que contienen el usuario. BreachedPasswordsDir es un
+	// directorio de rangos SHA-1 de contraseñas filtradas (vacío = no se
+	// consulta); BreachedPasswordsMinCount es desde cuántas apariciones se
+	// rechaza una contraseña.
+	PasswordMinLength         int
+	PasswordMaxBytes          int
+	PasswordRequiredClasses   []string
+	PasswordDisallowUsername  bool
+	BreachedPasswordsDir      string
+	BreachedPasswordsMinCount int
+
+	// Límites de requests por ruta (token bucket en memoria de cada réplica).
+	// RateLimits pisa por nombre los límites declarados en el router.
+	RateLimitEnabled bool
+	RateLimits       map[string]ratelimit.Limit
+
+	// Reconocimiento de dispositivos y aviso de login desde uno nuevo:
+	// DeviceNotifier es "log", "file" o "none"
+	DeviceRecognitionEnabled bool
+	DeviceNotifier           string
+	DeviceNotifyFile         string
+
+	// Bases GeoIP locales (formato MaxMind DB) y velocidad máxima entre dos
+	// logins a partir de la cual se considera un viaje imposible (0 = no se
+	// controla)
+	GeoIPCityDB              string
+	GeoIPASNDB               string
+	ImpossibleTravelSpeedKmh float64
+
+	// Caché de revocaciones en memoria
+	RevocationCacheEnabled   bool
+	RevocationCacheSize      int
+	RevocationBloomCapacity  int
+	RevocationResyncInterval time.Duration
+
+	// Escritura en lote de la última actividad de sesiones
+	ActivityFlushInterval time.Duration
+	ActivityGranularity   time.Duration
+
+	// Limpieza periódica de sesiones y tokens vencidos. MaintenanceLockKey es
+	// la clave del advisory lock que comparten las réplicas.
+	MaintenanceEnabled   bool
+	MaintenanceInterval  time.Duration
+	MaintenanceBatchSize int
+	MaintenanceLockKey   int64
+
+	// Antigüedad a partir de la cual se purgan los eventos de autenticación
+	// (0 = se guardan para siempre)
+	AuthEventRetention time.Duration
+
+	// Almacenamiento de sesiones: "sql", "memory" o "redis"
+	SessionStore   string
+	RedisAddr      string
+	RedisPassword  string
+	RedisDB        int
+	RedisKeyPrefix string
+	// Conexiones abiertas a Redis como máximo y plazo de cada comando
+	RedisPoolSize int
+	RedisTimeout  time.Duration
 }
 
 func LoadConfig() (*Config, error) {
@@ -41,6 +187,348 @@ func LoadConfig() (*Config, error) {
 		return nil, fmt.Errorf("REFRESH_EXPIRATION inválido: %w", err)
 	}
 
+	queryTimeout, err := parseDuration(os.Getenv("DB_QUERY_TIMEOUT"), 5*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("DB_QUERY_TIMEOUT inválido: %w", err)
+	}
+
+	trustedProxies, err := parsePrefixes(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		return nil, fmt.Errorf("TRUSTED_PROXIES inválido: %w", err)
+	}
+
+	safeRegistration, err := parseBool(os.Getenv("REGISTRATION_ENUMERATION_SAFE"), false)
+	if err != nil {
+		return nil, fmt.Errorf("REGISTRATION_ENUMERATION_SAFE inválido: %w", err)
+	}
+
+	mfaChallengeTTL, err := parseDuration(os.Getenv("MFA_CHALLENGE_TTL"), 5*time.Minute)
+	if err != nil {
+		return nil, fmt.Errorf("MFA_CHALLENGE_TTL inválido: %w", err)
+	}
+
+	mfaIssuer := os.Getenv("MFA_ISSUER")
+	if mfaIssuer == "" {
+		mfaIssuer = "JWT Auth API"
+	}
+
+	webauthnRPID := os.Getenv("WEBAUTHN_RP_ID")
+	webauthnRPName := os.Getenv("WEBAUTHN_RP_NAME")
+	if webauthnRPName == "" {
+		webauthnRPName = mfaIssuer
+	}
+	webauthnOrigins := parseList(os.Getenv("WEBAUTHN_RP_ORIGINS"))
+	if len(webauthnOrigins) == 0 && webauthnRPID != "" {
+		webauthnOrigins = []string{"https://" + webauthnRPID}
+	}
+
+	mailer := os.Getenv("MAILER")
+	if mailer == "" {
+		mailer = "none"
+	}
+	if mailer != "smtp" && mailer != "file" && mailer != "none" {
+		return nil, fmt.Errorf("MAILER inválido: %s", mailer)
+	}
+	if mailer == "smtp" && os.Getenv("SMTP_HOST") == "" {
+		return nil, fmt.Errorf("falta la variable de entorno requerida: SMTP_HOST")
+	}
+	smtpPort, err := parseInt(os.Getenv("SMTP_PORT"), 587)
+	if err != nil {
+		return nil, fmt.Errorf("SMTP_PORT inválido: %w", err)
+	}
+	mailFrom := os.Getenv("MAIL_FROM")
+	if mailFrom == "" {
+		mailFrom = "no-reply@localhost"
+	}
+	mailDropDir := os.Getenv("MAIL_DROP_DIR")
+	if mailDropDir == "" {
+		mailDropDir = "mail"
+	}
+
+	emailVerificationURL := os.Getenv("EMAIL_VERIFICATION_URL")
+	if emailVerificationURL == "" {
+		emailVerificationURL = "http://localhost:" + os.Getenv("PORT") + "/email/verify"
+	}
+	emailVerificationTTL, err := parseDuration(os.Getenv("EMAIL_VERIFICATION_TTL"), 24*time.Hour)
+	if err != nil {
+		return nil, fmt.Errorf("EMAIL_VERIFICATION_TTL inválido: %w", err)
+	}
+	emailPolicy := os.Getenv("EMAIL_VERIFICATION_POLICY")
+	if emailPolicy == "" {
+		emailPolicy = "off"
+	}
+	if emailPolicy != "off" && emailPolicy != "restrict" && emailPolicy != "block" {
+		return nil, fmt.Errorf("EMAIL_VERIFICATION_POLICY inválido: %s", emailPolicy)
+	}
+	if emailPolicy != "off" && mailer == "none" {
+		return nil, fmt.Errorf("EMAIL_VERIFICATION_POLICY=%s requiere definir MAILER", emailPolicy)
+	}
+
+	passwordResetURL := os.Getenv("PASSWORD_RESET_URL")
+	if passwordResetURL == "" {
+		passwordResetURL = "http://localhost:" + os.Getenv("PORT") + "/password/reset"
+	}
+	passwordResetTTL, err := parseDuration(os.Getenv("PASSWORD_RESET_TTL"), time.Hour)
+	if err != nil {
+		return nil, fmt.Errorf("PASSWORD_RESET_TTL inválido: %w", err)
+	}
+
+	magicLinkEnabled, err := parseBool(os.Getenv("MAGIC_LINK_ENABLED"), false)
+	if err != nil {
+		return nil, fmt.Errorf("MAGIC_LINK_ENABLED inválido: %w", err)
+	}
+	if magicLinkEnabled && mailer == "none" {
+		return nil, fmt.Errorf("MAGIC_LINK_ENABLED requiere definir MAILER")
+	}
+	magicLinkURL := os.Getenv("MAGIC_LINK_URL")
+	if magicLinkURL == "" {
+		magicLinkURL = "http://localhost:" + os.Getenv("PORT") + "/login/magic/verify"
+	}
+	magicLinkTTL, err := parseDuration(os.Getenv("MAGIC_LINK_TTL"), 15*time.Minute)
+	if err != nil {
+		return nil, fmt.Errorf("MAGIC_LINK_TTL inválido: %w", err)
+	}
+	magicLinkBindDevice, err := parseBool(os.Getenv("MAGIC_LINK_BIND_DEVICE"), false)
+	if err != nil {
+		return nil, fmt.Errorf("MAGIC_LINK_BIND_DEVICE inválido: %w", err)
+	}
+
+	passwordHash := os.Getenv("PASSWORD_HASH")
+	if passwordHash == "" {
+		passwordHash = "argon2id"
+	}
+	if passwordHash != "argon2id" && passwordHash != "bcrypt" {
+		return nil, fmt.Errorf("PASSWORD_HASH inválido: %s", passwordHash)
+	}
+	argon2Memory, err := parseInt(os.Getenv("ARGON2_MEMORY_KIB"), 64*1024)
+	if err != nil || argon2Memory < 8 {
+		return nil, fmt.Errorf("ARGON2_MEMORY_KIB inválido: %s", os.Getenv("ARGON2_MEMORY_KIB"))
+	}
+	argon2Iterations, err := parseInt(os.Getenv("ARGON2_ITERATIONS"), 3)
+	if err != nil || argon2Iterations < 1 {
+		return nil, fmt.Errorf("ARGON2_ITERATIONS inválido: %s", os.Getenv("ARGON2_ITERATIONS"))
+	}
+	argon2Parallelism, err := parseInt(os.Getenv("ARGON2_PARALLELISM"), 2)
+	if err != nil || argon2Parallelism < 1 || argon2Parallelism > 255 {
+		return nil, fmt.Errorf("ARGON2_PARALLELISM inválido: %s", os.Getenv("ARGON2_PARALLELISM"))
+	}
+	bcryptCost, err := parseInt(os.Getenv("BCRYPT_COST"), 10)
+	if err != nil || bcryptCost < 4 || bcryptCost > 31 {
+		return nil, fmt.Errorf("BCRYPT_COST inválido: %s", os.Getenv("BCRYPT_COST"))
+	}
+
+	passwordMinLength, err := parseInt(os.Getenv("PASSWORD_MIN_LENGTH"), 8)
+	if err != nil {
+		return nil, fmt.Errorf("PASSWORD_MIN_LENGTH inválido: %w", err)
+	}
+	// bcrypt ignora lo que pasa de 72 bytes; con argon2id el límite sólo
+	// evita hashear entradas enormes
+	defaultMaxBytes := 1024
+	if passwordHash == "bcrypt" {
+		defaultMaxBytes = 72
+	}
+	passwordMaxBytes, err := parseInt(os.Getenv("PASSWORD_MAX_BYTES"), defaultMaxBytes)
+	if err != nil {
+		return nil, fmt.Errorf("PASSWORD_MAX_BYTES inválido: %w", err)
+	}
+	// Por debajo del mínimo ninguna contraseña sería válida, y con bcrypt
+	// una de más de 72 bytes haría fallar el hash
+	if passwordMaxBytes <= 0 || passwordMaxBytes < passwordMinLength ||
+		(passwordHash == "bcrypt" && passwordMaxBytes > 72) {
+		return nil, fmt.Errorf("PASSWORD_MAX_BYTES inválido: %d", passwordMaxBytes)
+	}
+	passwordClasses := parseList(os.Getenv("PASSWORD_REQUIRED_CLASSES"))
+	for _, class := range passwordClasses {
+		if class != "lower" && class != "upper" && class != "digit" && class != "symbol" {
+			return nil, fmt.Errorf("PASSWORD_REQUIRED_CLASSES inválido: %s", class)
+		}
+	}
+	passwordDisallowUsername, err := parseBool(os.Getenv("PASSWORD_DISALLOW_USERNAME"), true)
+	if err != nil {
+		return nil, fmt.Errorf("PASSWORD_DISALLOW_USERNAME inválido: %w", err)
+	}
+	breachedMinCount, err := parseInt(os.Getenv("BREACHED_PASSWORDS_MIN_COUNT"), 1)
+	if err != nil {
+		return nil, fmt.Errorf("BREACHED_PASSWORDS_MIN_COUNT inválido: %w", err)
+	}
+
+	rateLimitEnabled, err := parseBool(os.Getenv("RATE_LIMIT_ENABLED"), true)
+	if err != nil {
+		return nil, fmt.Errorf("RATE_LIMIT_ENABLED inválido: %w", err)
+	}
+
+	rateLimits, err := parseRateLimits(os.Getenv("RATE_LIMITS"))
+	if err != nil {
+		return nil, fmt.Errorf("RATE_LIMITS inválido: %w", err)
+	}
+
+	idleTimeout, err := parseDuration(os.Getenv("SESSION_IDLE_TIMEOUT"), 0)
+	if err != nil {
+		return nil, fmt.Errorf("SESSION_IDLE_TIMEOUT inválido: %w", err)
+	}
+
+	maxLifetime, err := parseDuration(os.Getenv("SESSION_MAX_LIFETIME"), 0)
+	if err != nil {
+		return nil, fmt.Errorf("SESSION_MAX_LIFETIME inválido: %w", err)
+	}
+
+	sliding, err := parseBool(os.Getenv("SESSION_SLIDING"), false)
+	if err != nil {
+		return nil, fmt.Errorf("SESSION_SLIDING inválido: %w", err)
+	}
+	if sliding && maxLifetime <= 0 {
+		return nil, fmt.Errorf("SESSION_SLIDING requiere definir SESSION_MAX_LIFETIME")
+	}
+
+	maxSessions, err := parseInt(os.Getenv("MAX_SESSIONS_PER_USER"), 5)
+	if err != nil {
+		return nil, fmt.Errorf("MAX_SESSIONS_PER_USER inválido: %w", err)
+	}
+
+	maxSessionsByRole, err := parseRoleLimits(os.Getenv("MAX_SESSIONS_BY_ROLE"))
+	if err != nil {
+		return nil, fmt.Errorf("MAX_SESSIONS_BY_ROLE inválido: %w", err)
+	}
+
+	sessionPolicy := os.Getenv("SESSION_LIMIT_POLICY")
+	if sessionPolicy == "" {
+		sessionPolicy = "evict_oldest"
+	}
+	if sessionPolicy != "evict_oldest" && sessionPolicy != "reject" && sessionPolicy != "choose" {
+		return nil, fmt.Errorf("SESSION_LIMIT_POLICY inválido: %s", sessionPolicy)
+	}
+
+	lockoutUser, err := parseInt(os.Getenv("LOCKOUT_USER_THRESHOLD"), 5)
+	if err != nil {
+		return nil, fmt.Errorf("LOCKOUT_USER_THRESHOLD inválido: %w", err)
+	}
+
+	lockoutIP, err := parseInt(os.Getenv("LOCKOUT_IP_THRESHOLD"), 20)
+	if err != nil {
+		return nil, fmt.Errorf("LOCKOUT_IP_THRESHOLD inválido: %w", err)
+	}
+
+	lockoutBase, err := parseDuration(os.Getenv("LOCKOUT_BASE_DURATION"), time.Minute)
+	if err != nil {
+		return nil, fmt.Errorf("LOCKOUT_BASE_DURATION inválido: %w", err)
+	}
+
+	lockoutMax, err := parseDuration(os.Getenv("LOCKOUT_MAX_DURATION"), time.Hour)
+	if err != nil {
+		return nil, fmt.Errorf("LOCKOUT_MAX_DURATION inválido: %w", err)
+	}
+
+	lockoutWindow, err := parseDuration(os.Getenv("LOCKOUT_WINDOW"), 15*time.Minute)
+	if err != nil {
+		return nil, fmt.Errorf("LOCKOUT_WINDOW inválido: %w", err)
+	}
+
+	deviceRecognition, err := parseBool(os.Getenv("DEVICE_RECOGNITION_ENABLED"), true)
+	if err != nil {
+		return nil, fmt.Errorf("DEVICE_RECOGNITION_ENABLED inválido: %w", err)
+	}
+
+	deviceNotifier := os.Getenv("DEVICE_NOTIFIER")
+	if deviceNotifier == "" {
+		deviceNotifier = "log"
+	}
+	if deviceNotifier != "log" && deviceNotifier != "file" && deviceNotifier != "none" {
+		return nil, fmt.Errorf("DEVICE_NOTIFIER inválido: %s", deviceNotifier)
+	}
+	if deviceNotifier == "file" && os.Getenv("DEVICE_NOTIFY_FILE") == "" {
+		return nil, fmt.Errorf("falta la variable de entorno requerida: DEVICE_NOTIFY_FILE")
+	}
+
+	travelSpeed, err := parseFloat(os.Getenv("IMPOSSIBLE_TRAVEL_SPEED_KMH"), 1000)
+	if err != nil {
+		return nil, fmt.Errorf("IMPOSSIBLE_TRAVEL_SPEED_KMH inválido: %w", err)
+	}
+
+	revocationCacheEnabled, err := parseBool(os.Getenv("REVOCATION_CACHE_ENABLED"), true)
+	if err != nil {
+		return nil, fmt.Errorf("REVOCATION_CACHE_ENABLED inválido: %w", err)
+	}
+
+	revocationCacheSize, err := parseInt(os.Getenv("REVOCATION_CACHE_SIZE"), 10000)
+	if err != nil {
+		return nil, fmt.Errorf("REVOCATION_CACHE_SIZE inválido: %w", err)
+	}
+
+	revocationBloomCapacity, err := parseInt(os.Getenv("REVOCATION_BLOOM_CAPACITY"), 100000)
+	if err != nil {
+		return nil, fmt.Errorf("REVOCATION_BLOOM_CAPACITY inválido: %w", err)
+	}
+
+	revocationResync, err := parseDuration(os.Getenv("REVOCATION_RESYNC_INTERVAL"), time.Minute)
+	if err != nil {
+		return nil, fmt.Errorf("REVOCATION_RESYNC_INTERVAL inválido: %w", err)
+	}
+
+	activityFlush, err := parseDuration(os.Getenv("ACTIVITY_FLUSH_INTERVAL"), 30*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("ACTIVITY_FLUSH_INTERVAL inválido: %w", err)
+	}
+
+	activityGranularity, err := parseDuration(os.Getenv("ACTIVITY_GRANULARITY"), time.Minute)
+	if err != nil {
+		return nil, fmt.Errorf("ACTIVITY_GRANULARITY inválido: %w", err)
+	}
+
+	maintenanceEnabled, err := parseBool(os.Getenv("MAINTENANCE_ENABLED"), true)
+	if err != nil {
+		return nil, fmt.Errorf("MAINTENANCE_ENABLED inválido: %w", err)
+	}
+
+	maintenanceInterval, err := parseDuration(os.Getenv("MAINTENANCE_INTERVAL"), 10*time.Minute)
+	if err != nil {
+		return nil, fmt.Errorf("MAINTENANCE_INTERVAL inválido: %w", err)
+	}
+
+	maintenanceBatch, err := parseInt(os.Getenv("MAINTENANCE_BATCH_SIZE"), 1000)
+	if err != nil {
+		return nil, fmt.Errorf("MAINTENANCE_BATCH_SIZE inválido: %w", err)
+	}
+
+	maintenanceLockKey, err := parseInt(os.Getenv("MAINTENANCE_LOCK_KEY"), 724101)
+	if err != nil {
+		return nil, fmt.Errorf("MAINTENANCE_LOCK_KEY inválido: %w", err)
+	}
+
+	eventRetention, err := parseDuration(os.Getenv("AUTH_EVENT_RETENTION"), 90*24*time.Hour)
+	if err != nil {
+		return nil, fmt.Errorf("AUTH_EVENT_RETENTION inválido: %w", err)
+	}
+
+	sessionStore := os.Getenv("SESSION_STORE")
+	if sessionStore == "" {
+		sessionStore = "sql"
+	}
+	if sessionStore != "sql" && sessionStore != "memory" && sessionStore != "redis" {
+		return nil, fmt.Errorf("SESSION_STORE inválido: %s", sessionStore)
+	}
+	if sessionStore == "redis" && os.Getenv("REDIS_ADDR") == "" {
+		return nil, fmt.Errorf("falta la variable de entorno requerida: REDIS_ADDR")
+	}
+
+	redisDB, err := parseInt(os.Getenv("REDIS_DB"), 0)
+	if err != nil {
+		return nil, fmt.Errorf("REDIS_DB inválido: %w", err)
+	}
+
+	redisPoolSize, err := parseInt(os.Getenv("REDIS_POOL_SIZE"), 10)
+	if err != nil || redisPoolSize <= 0 {
+		return nil, fmt.Errorf("REDIS_POOL_SIZE inválido: %s", os.Getenv("REDIS_POOL_SIZE"))
+	}
+	redisTimeout, err := parseDuration(os.Getenv("REDIS_TIMEOUT"), time.Second)
+	if err != nil || redisTimeout <= 0 {
+		return nil, fmt.Errorf("REDIS_TIMEOUT inválido: %s", os.Getenv("REDIS_TIMEOUT"))
+	}
+
+	redisPrefix := os.Getenv("REDIS_KEY_PREFIX")
+	if redisPrefix == "" {
+		redisPrefix = "jwtauth:"
+	}
+
 	dsn := fmt.Sprintf(
 		"postgres://%s:%s@%s:%s/%s?sslmode=%s",
 		os.Getenv("DB_USER"),
@@ -59,6 +547,98 @@ func LoadConfig() (*Config, error) {
 		RefreshExpiration: refreshExp,
 		Port:              os.Getenv("PORT"),
 		Env:               os.Getenv("ENV"),
+		DBQueryTimeout:    queryTimeout,
+		TrustedProxies:    trustedProxies,
+
+		SessionIdleTimeout: idleTimeout,
+		SessionMaxLifetime: maxLifetime,
+		SessionSliding:     sliding,
+
+		MaxSessionsPerUser: maxSessions,
+		MaxSessionsByRole:  maxSessionsByRole,
+		SessionLimitPolicy: sessionPolicy,
+
+		LockoutUserThreshold: lockoutUser,
+		LockoutIPThreshold:   lockoutIP,
+		LockoutBaseDuration:  lockoutBase,
+		LockoutMaxDuration:   lockoutMax,
+		LockoutWindow:        lockoutWindow,
+
+		RegistrationEnumerationSafe: safeRegistration,
+
+		MFARequiredRoles: parseList(os.Getenv("MFA_REQUIRED_ROLES")),
+		MFAIssuer:        mfaIssuer,
+		MFAChallengeTTL:  mfaChallengeTTL,
+
+		WebAuthnRPID:      webauthnRPID,
+		WebAuthnRPName:    webauthnRPName,
+		WebAuthnRPOrigins: webauthnOrigins,
+
+		Mailer:       mailer,
+		MailFrom:     mailFrom,
+		SMTPHost:     os.Getenv("SMTP_HOST"),
+		SMTPPort:     smtpPort,
+		SMTPUsername: os.Getenv("SMTP_USERNAME"),
+		SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+		MailDropDir:  mailDropDir,
+
+		EmailVerificationURL:    emailVerificationURL,
+		EmailVerificationTTL:    emailVerificationTTL,
+		EmailVerificationPolicy: emailPolicy,
+
+		PasswordResetURL: passwordResetURL,
+		PasswordResetTTL: passwordResetTTL,
+
+		MagicLinkEnabled:    magicLinkEnabled,
+		MagicLinkURL:        magicLinkURL,
+		MagicLinkTTL:        magicLinkTTL,
+		MagicLinkBindDevice: magicLinkBindDevice,
+
+		PasswordHash:      passwordHash,
+		Argon2Memory:      argon2Memory,
+		Argon2Iterations:  argon2Iterations,
+		Argon2Parallelism: argon2Parallelism,
+		BcryptCost:        bcryptCost,
+
+		PasswordMinLength:         passwordMinLength,
+		PasswordMaxBytes:          passwordMaxBytes,
+		PasswordRequiredClasses:   passwordClasses,
+		PasswordDisallowUsername:  passwordDisallowUsername,
+		BreachedPasswordsDir:      os.Getenv("BREACHED_PASSWORDS_DIR"),
+		BreachedPasswordsMinCount: breachedMinCount,
+
+		RateLimitEnabled: rateLimitEnabled,
+		RateLimits:       rateLimits,
+
+		DeviceRecognitionEnabled: deviceRecognition,
+		DeviceNotifier:           deviceNotifier,
+		DeviceNotifyFile:         os.Getenv("DEVICE_NOTIFY_FILE"),
+
+		GeoIPCityDB:              os.Getenv("GEOIP_CITY_DB"),
+		GeoIPASNDB:               os.Getenv("GEOIP_ASN_DB"),
+		ImpossibleTravelSpeedKmh: travelSpeed,
+
+		RevocationCacheEnabled:   revocationCacheEnabled,
+		RevocationCacheSize:      revocationCacheSize,
+		RevocationBloomCapacity:  revocationBloomCapacity,
+		RevocationResyncInterval: revocationResync,
+
+		ActivityFlushInterval: activityFlush,
+		ActivityGranularity:   activityGranularity,
+
+		MaintenanceEnabled:   maintenanceEnabled,
+		MaintenanceInterval:  maintenanceInterval,
+		MaintenanceBatchSize: maintenanceBatch,
+		MaintenanceLockKey:   int64(maintenanceLockKey),
+		AuthEventRetention:   eventRetention,
+
+		SessionStore:   sessionStore,
+		RedisAddr:      os.Getenv("REDIS_ADDR"),
+		RedisPassword:  os.Getenv("REDIS_PASSWORD"),
+		RedisDB:        redisDB,
+		RedisKeyPrefix: redisPrefix,
+		RedisPoolSize:  redisPoolSize,
+		RedisTimeout:   redisTimeout,
 	}, nil
 }
 
@@ -72,3 +652,119 @@ func parseDuration(value string, defaultDuration time.Duration) (time.Duration,
 	}
 	return d, nil
 }
+
+func parseInt(value string, defaultValue int) (int, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return defaultValue, fmt.Errorf("error al parsear entero: %w", err)
+	}
+	return n, nil
+}
+
+func parseFloat(value string, defaultValue float64) (float64, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return defaultValue, fmt.Errorf("error al parsear número: %w", err)
+	}
+	return f, nil
+}
+
+func parseBool(value string, defaultValue bool) (bool, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return defaultValue, fmt.Errorf("error al parsear booleano: %w", err)
+	}
+	return b, nil
+}
+
+// parseRoleLimits interpreta una lista "rol=n,rol=n"
+func parseRoleLimits(value string) (map[string]int, error) {
+	limits := make(map[string]int)
+	if value == "" {
+		return limits, nil
+	}
+	for _, pair := range strings.Split(value, ",") {
+		role, n, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || role == "" {
+			return nil, fmt.Errorf("se esperaba rol=n y llegó %q", pair)
+		}
+		limit, err := strconv.Atoi(n)
+		if err != nil {
+			return nil, fmt.Errorf("límite inválido para %s: %w", role, err)
+		}
+		limits[role] = limit
+	}
+	return limits, nil
+}
+
+// parseList separa una lista por comas descartando elementos vacíos
+func parseList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseRateLimits interpreta una lista nombre=n/período separada por comas
+// (ej: login=10/1m,register=5/1h)
+func parseRateLimits(value string) (map[string]ratelimit.Limit, error) {
+	limits := make(map[string]ratelimit.Limit)
+	if value == "" {
+		return limits, nil
+	}
+	for _, pair := range strings.Split(value, ",") {
+		name, spec, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		n, period, okSpec := strings.Cut(spec, "/")
+		if !ok || !okSpec || name == "" {
+			return nil, fmt.Errorf("se esperaba nombre=n/período y llegó %q", pair)
+		}
+		requests, err := strconv.Atoi(n)
+		if err != nil || requests <= 0 {
+			return nil, fmt.Errorf("cantidad inválida para %s: %q", name, n)
+		}
+		duration, err := time.ParseDuration(period)
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("período inválido para %s: %q", name, period)
+		}
+		limits[name] = ratelimit.PerPeriod(requests, duration)
+	}
+	return limits, nil
+}
+
+// parsePrefixes interpreta una lista de rangos CIDR separados por comas; una
+// IP suelta equivale a un rango de un solo host
+func parsePrefixes(value string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			addr, err := netip.ParseAddr(item)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
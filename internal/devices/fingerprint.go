@@ -0,0 +1,51 @@
+// Package devices reconoce los dispositivos desde los que inicia sesión un
+// usuario y avisa cuando aparece uno nuevo.
+package devices
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/netip"
+	"strings"
+)
+
+// Prefijos con los que se agrupan las IPs: una red doméstica o de oficina
+// suele mantenerse dentro de un /24 IPv4 o un /48 IPv6 aunque cambie la IP
+const (
+	ipv4RangeBits = 24
+	ipv6RangeBits = 48
+)
+
+// Fingerprint calcula la huella de un dispositivo. Si el cliente envía su
+// propio identificador de dispositivo se usa ese, porque sobrevive a cambios
+// de red; si no, se combinan el User-Agent y el rango de la IP.
+func Fingerprint(userAgent, ip, deviceID string) string {
+	var source string
+	if deviceID = strings.TrimSpace(deviceID); deviceID != "" {
+		source = "id|" + deviceID
+	} else {
+		source = "ua|" + strings.TrimSpace(userAgent) + "|" + IPRange(ip)
+	}
+	sum := sha256.Sum256([]byte(source))
+	return hex.EncodeToString(sum[:])
+}
+
+// IPRange devuelve el rango de red al que pertenece ip, o ip tal cual si no
+// es una dirección válida
+func IPRange(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+	addr = addr.Unmap()
+
+	bits := ipv6RangeBits
+	if addr.Is4() {
+		bits = ipv4RangeBits
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return ip
+	}
+	return prefix.String()
+}
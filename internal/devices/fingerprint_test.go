@@ -0,0 +1,26 @@
+package devices
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIPRange(t *testing.T) {
+	assert.Equal(t, "198.51.100.0/24", IPRange("198.51.100.77"))
+	assert.Equal(t, "198.51.100.0/24", IPRange("::ffff:198.51.100.77"))
+	assert.Equal(t, "2001:db8:cafe::/48", IPRange("2001:db8:cafe:1::17"))
+	assert.Equal(t, "no-es-ip", IPRange("no-es-ip"))
+}
+
+func TestFingerprint(t *testing.T) {
+	base := Fingerprint("Firefox", "198.51.100.1", "")
+	assert.Len(t, base, 64)
+	assert.Equal(t, base, Fingerprint("Firefox", "198.51.100.200", ""))
+	assert.NotEqual(t, base, Fingerprint("Chrome", "198.51.100.1", ""))
+	assert.NotEqual(t, base, Fingerprint("Firefox", "198.51.101.1", ""))
+
+	withID := Fingerprint("Firefox", "198.51.100.1", "device-1")
+	assert.NotEqual(t, base, withID)
+	assert.Equal(t, withID, Fingerprint("Chrome", "203.0.113.9", "device-1"))
+}
@@ -0,0 +1,67 @@
+package devices
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// NewDeviceEvent describe un login desde un dispositivo desconocido
+type NewDeviceEvent struct {
+	UserID      uint      `json:"user_id"`
+	Username    string    `json:"username"`
+	SessionID   uint      `json:"session_id"`
+	Fingerprint string    `json:"fingerprint"`
+	UserAgent   string    `json:"user_agent"`
+	IP          string    `json:"ip"`
+	Country     string    `json:"country,omitempty"`
+	City        string    `json:"city,omitempty"`
+	At          time.Time `json:"at"`
+}
+
+// Notifier entrega el aviso de nuevo dispositivo al usuario (mail, push,
+// cola de eventos...). Un error no impide el login, sólo se registra.
+type Notifier interface {
+	NotifyNewDevice(ctx context.Context, event NewDeviceEvent) error
+}
+
+// LogNotifier escribe el aviso en el log estándar; pensado para desarrollo
+type LogNotifier struct{}
+
+func (LogNotifier) NotifyNewDevice(ctx context.Context, event NewDeviceEvent) error {
+	log.Printf("Nuevo dispositivo para %s (id %d): %s desde %s", event.Username, event.UserID, event.UserAgent, event.IP)
+	return nil
+}
+
+// FileNotifier agrega cada aviso como una línea JSON al final de un archivo
+type FileNotifier struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileNotifier(path string) *FileNotifier {
+	return &FileNotifier{path: path}
+}
+
+func (n *FileNotifier) NotifyNewDevice(ctx context.Context, event NewDeviceEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	f, err := os.OpenFile(n.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -1,6 +1,7 @@
 package errors
 
 import (
+	"context"
 	"errors"
 	"fmt"
 )
@@ -10,12 +11,52 @@ var (
 	ErrInvalidUser     = errors.New("invalid username or password")
 	ErrInvalidPassword = errors.New("invalid password")
 	ErrUserNotFound    = errors.New("user not found")
+	// ErrInvalidCredentials es lo único que ve el cliente de un login
+	// fallido, exista o no el usuario
+	ErrInvalidCredentials = errors.New("invalid credentials")
 
 	ErrTokenInvalid     = errors.New("token is invalid")
 	ErrTokenExpired     = errors.New("token has expired")
 	ErrTokenBlacklisted = errors.New("token has been invalidated")
 	ErrTokenMissing     = errors.New("token is missing")
 
+	ErrSessionIdleExpired     = errors.New("session expired due to inactivity")
+	ErrSessionAbsoluteExpired = errors.New("session reached its maximum lifetime")
+
+	ErrSessionNotFound     = errors.New("session not found")
+	ErrSessionLimitReached = errors.New("maximum number of active sessions reached")
+
+	ErrAccountLocked = errors.New("too many failed login attempts, try again later")
+	ErrRateLimited   = errors.New("too many requests, try again later")
+
+	ErrMFARequired         = errors.New("second factor required")
+	ErrInvalidMFACode      = errors.New("invalid verification code")
+	ErrMFAChallengeInvalid = errors.New("invalid or expired MFA challenge")
+	ErrMFANotEnrolled      = errors.New("two-factor authentication is not enrolled")
+	ErrMFAAlreadyEnabled   = errors.New("two-factor authentication is already enabled")
+
+	ErrWebAuthnDisabled = errors.New("passkeys are not enabled")
+	ErrPasskeyInvalid   = errors.New("passkey verification failed")
+	ErrPasskeyNotFound  = errors.New("passkey not found")
+
+	ErrInvalidEmail            = errors.New("invalid email address")
+	ErrEmailTaken              = errors.New("email already in use")
+	ErrEmailMissing            = errors.New("account has no email address")
+	ErrEmailNotVerified        = errors.New("email address not verified")
+	ErrVerificationLinkInvalid = errors.New("invalid or expired verification link")
+	// ErrEmailVerificationDisabled es un pedido de link sin MAILER configurado
+	ErrEmailVerificationDisabled = errors.New("email verification is not enabled")
+
+	ErrPasswordResetDisabled = errors.New("password reset is not enabled")
+	ErrResetTokenInvalid     = errors.New("invalid or expired reset link")
+	ErrWeakPassword          = errors.New("password is too weak")
+	// ErrCurrentPasswordInvalid es la contraseña actual equivocada al
+	// cambiarla; no es un 401 porque la sesión sigue siendo válida
+	ErrCurrentPasswordInvalid = errors.New("current password is incorrect")
+
+	ErrMagicLinkDisabled = errors.New("login links are not enabled")
+	ErrMagicLinkInvalid  = errors.New("invalid or expired login link")
+
 	ErrUnauthorized = errors.New("unauthorized access")
 	ErrInvalidRole  = errors.New("invalid role")
 )
@@ -28,12 +69,21 @@ func IsTokenError(err error) bool {
 	return errors.Is(err, ErrTokenInvalid) ||
 		errors.Is(err, ErrTokenExpired) ||
 		errors.Is(err, ErrTokenBlacklisted) ||
-		errors.Is(err, ErrTokenMissing)
+		errors.Is(err, ErrTokenMissing) ||
+		errors.Is(err, ErrSessionIdleExpired) ||
+		errors.Is(err, ErrSessionAbsoluteExpired)
 }
 
 func IsAuthError(err error) bool {
 	return errors.Is(err, ErrUserExists) ||
 		errors.Is(err, ErrInvalidUser) ||
 		errors.Is(err, ErrInvalidPassword) ||
-		errors.Is(err, ErrUserNotFound)
+		errors.Is(err, ErrUserNotFound) ||
+		errors.Is(err, ErrInvalidCredentials)
+}
+
+// IsContextError indica si la operación se cortó por el plazo o la
+// cancelación del contexto y no por un error propio de la operación
+func IsContextError(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled)
 }
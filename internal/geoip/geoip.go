@@ -0,0 +1,127 @@
+// Package geoip ubica direcciones IP con bases locales en formato MaxMind DB
+// (GeoLite2/GeoIP2 City y ASN), sin consultar servicios externos.
+package geoip
+
+import (
+	"errors"
+	"net"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// Location es lo que se sabe de una IP. Los campos quedan vacíos cuando la
+// base no tiene el dato.
+type Location struct {
+	Country        string
+	City           string
+	ASN            uint
+	ASOrg          string
+	Latitude       float64
+	Longitude      float64
+	HasCoordinates bool
+	// AccuracyKm es el radio alrededor de las coordenadas en el que la base
+	// ubica la IP (0 si no lo informa)
+	AccuracyKm uint
+}
+
+// Locator ubica una IP; ok es false si ninguna base tiene datos de ella
+type Locator interface {
+	Lookup(ip string) (loc Location, ok bool)
+}
+
+type cityRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Location struct {
+		Latitude  *float64 `maxminddb:"latitude"`
+		Longitude *float64 `maxminddb:"longitude"`
+		Accuracy  uint16   `maxminddb:"accuracy_radius"`
+	} `maxminddb:"location"`
+}
+
+type asnRecord struct {
+	Number uint   `maxminddb:"autonomous_system_number"`
+	Org    string `maxminddb:"autonomous_system_organization"`
+}
+
+// Reader consulta una base City y/o una base ASN
+type Reader struct {
+	city *maxminddb.Reader
+	asn  *maxminddb.Reader
+}
+
+// Open abre las bases indicadas; cualquiera de las dos rutas puede estar vacía
+// pero no ambas
+func Open(cityPath, asnPath string) (*Reader, error) {
+	if cityPath == "" && asnPath == "" {
+		return nil, errors.New("no se indicó ninguna base GeoIP")
+	}
+
+	r := &Reader{}
+	if cityPath != "" {
+		city, err := maxminddb.Open(cityPath)
+		if err != nil {
+			return nil, err
+		}
+		r.city = city
+	}
+	if asnPath != "" {
+		asn, err := maxminddb.Open(asnPath)
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		r.asn = asn
+	}
+	return r, nil
+}
+
+func (r *Reader) Lookup(ip string) (Location, bool) {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return Location{}, false
+	}
+
+	var loc Location
+	var found bool
+	if r.city != nil {
+		var record cityRecord
+		if _, ok, err := r.city.LookupNetwork(addr, &record); err == nil && ok {
+			found = true
+			loc.Country = record.Country.ISOCode
+			loc.City = record.City.Names["en"]
+			if record.Location.Latitude != nil && record.Location.Longitude != nil {
+				loc.Latitude = *record.Location.Latitude
+				loc.Longitude = *record.Location.Longitude
+				loc.HasCoordinates = true
+				loc.AccuracyKm = uint(record.Location.Accuracy)
+			}
+		}
+	}
+	if r.asn != nil {
+		var record asnRecord
+		if _, ok, err := r.asn.LookupNetwork(addr, &record); err == nil && ok {
+			found = true
+			loc.ASN = record.Number
+			loc.ASOrg = record.Org
+		}
+	}
+	return loc, found
+}
+
+func (r *Reader) Close() error {
+	var err error
+	if r.city != nil {
+		err = r.city.Close()
+	}
+	if r.asn != nil {
+		if asnErr := r.asn.Close(); err == nil {
+			err = asnErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,99 @@
+package geoip
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func cityEntry(country, city string, lat, lon float64) map[string]interface{} {
+	return map[string]interface{}{
+		"country":  map[string]interface{}{"iso_code": country},
+		"city":     map[string]interface{}{"names": map[string]interface{}{"en": city}},
+		"location": map[string]interface{}{"latitude": lat, "longitude": lon, "accuracy_radius": uint16(20)},
+	}
+}
+
+func TestReaderLookup(t *testing.T) {
+	cityPath := writeTestDB(t, "GeoIP2-City", map[string]map[string]interface{}{
+		"198.51.100.0/24": cityEntry("AR", "Buenos Aires", -34.6, -58.4),
+		"203.0.113.0/24":  cityEntry("JP", "Tokyo", 35.7, 139.7),
+	})
+	asnPath := writeTestDB(t, "GeoLite2-ASN", map[string]map[string]interface{}{
+		"198.51.0.0/16": {
+			"autonomous_system_number":       uint32(64500),
+			"autonomous_system_organization": "Ejemplo SA",
+		},
+	})
+
+	reader, err := Open(cityPath, asnPath)
+	require.NoError(t, err)
+	defer reader.Close()
+
+	loc, ok := reader.Lookup("198.51.100.7")
+	require.True(t, ok)
+	assert.Equal(t, "AR", loc.Country)
+	assert.Equal(t, "Buenos Aires", loc.City)
+	assert.Equal(t, uint(64500), loc.ASN)
+	assert.Equal(t, "Ejemplo SA", loc.ASOrg)
+	assert.True(t, loc.HasCoordinates)
+	assert.InDelta(t, -34.6, loc.Latitude, 0.001)
+	assert.Equal(t, uint(20), loc.AccuracyKm)
+
+	loc, ok = reader.Lookup("203.0.113.1")
+	require.True(t, ok)
+	assert.Equal(t, "JP", loc.Country)
+	assert.Zero(t, loc.ASN)
+
+	_, ok = reader.Lookup("192.0.2.1")
+	assert.False(t, ok)
+	_, ok = reader.Lookup("no-es-ip")
+	assert.False(t, ok)
+
+	_, err = Open("", "")
+	assert.Error(t, err)
+}
+
+func TestCheckTravel(t *testing.T) {
+	buenosAires := Location{Latitude: -34.6, Longitude: -58.4, HasCoordinates: true}
+	tokyo := Location{Latitude: 35.7, Longitude: 139.7, HasCoordinates: true}
+	now := time.Now()
+
+	assert.InDelta(t, 18400, DistanceKm(buenosAires, tokyo), 200)
+
+	previous := Login{IP: "198.51.100.7", Location: buenosAires, At: now.Add(-time.Hour)}
+	current := Login{IP: "203.0.113.1", Location: tokyo, At: now}
+	travel, ok := CheckTravel(1, previous, current, 1000)
+	require.True(t, ok)
+	assert.Greater(t, travel.SpeedKmh, 1000.0)
+
+	// Con tiempo suficiente el viaje es posible
+	previous.At = now.Add(-48 * time.Hour)
+	_, ok = CheckTravel(1, previous, current, 1000)
+	assert.False(t, ok)
+
+	// Sin coordenadas no se puede juzgar
+	previous.At = now.Add(-time.Hour)
+	previous.Location.HasCoordinates = false
+	_, ok = CheckTravel(1, previous, current, 1000)
+	assert.False(t, ok)
+
+	// Mismo lugar al mismo tiempo
+	_, ok = CheckTravel(1, current, current, 1000)
+	assert.False(t, ok)
+
+	// Centros de ciudades vecinas segundos después: la distancia cabe en la
+	// precisión de la base y no cuenta como viaje
+	laPlata := Location{Latitude: -34.92, Longitude: -57.95, HasCoordinates: true, AccuracyKm: 50}
+	previous = Login{Location: Location{Latitude: -34.6, Longitude: -58.4, HasCoordinates: true, AccuracyKm: 20}, At: now.Add(-time.Second)}
+	_, ok = CheckTravel(1, previous, Login{Location: laPlata, At: now}, 1000)
+	assert.False(t, ok)
+
+	// Con radios chicos la misma distancia sí es un viaje imposible
+	previous.Location.AccuracyKm = 1
+	laPlata.AccuracyKm = 1
+	_, ok = CheckTravel(1, previous, Login{Location: laPlata, At: now}, 1000)
+	assert.True(t, ok)
+}
@@ -0,0 +1,164 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestDB genera una base MaxMind DB IPv4 mínima (registros de 32 bits)
+// con los datos indicados por red, para no depender de archivos binarios
+func writeTestDB(t *testing.T, dbType string, networks map[string]map[string]interface{}) string {
+	t.Helper()
+
+	type node struct{ records [2]int }
+	const (
+		empty = -1
+		child = 0 // los valores >= 0 son índices de nodo
+	)
+	nodes := []node{{records: [2]int{empty, empty}}}
+	dataRefs := map[[2]int]int{} // (nodo, lado) -> índice de dato
+
+	var data bytes.Buffer
+	prefixes := make([]string, 0, len(networks))
+	for prefix := range networks {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	for i, cidr := range prefixes {
+		prefix := netip.MustParsePrefix(cidr)
+		ip := prefix.Addr().As4()
+		offset := data.Len()
+		encodeValue(&data, networks[cidr])
+
+		current := 0
+		for bit := 0; bit < prefix.Bits(); bit++ {
+			side := int(ip[bit/8]>>(7-bit%8)) & 1
+			if bit == prefix.Bits()-1 {
+				dataRefs[[2]int{current, side}] = offset
+				nodes[current].records[side] = empty - 1 - i
+				break
+			}
+			next := nodes[current].records[side]
+			if next < child {
+				nodes = append(nodes, node{records: [2]int{empty, empty}})
+				next = len(nodes) - 1
+				nodes[current].records[side] = next
+			}
+			current = next
+		}
+	}
+
+	nodeCount := len(nodes)
+	var out bytes.Buffer
+	for n, nd := range nodes {
+		for side, rec := range nd.records {
+			var value uint32
+			switch {
+			case rec >= child:
+				value = uint32(rec)
+			case rec == empty:
+				value = uint32(nodeCount)
+			default:
+				value = uint32(nodeCount + 16 + dataRefs[[2]int{n, side}])
+			}
+			binary.Write(&out, binary.BigEndian, value)
+		}
+	}
+	out.Write(make([]byte, 16))
+	out.Write(data.Bytes())
+	out.WriteString("\xAB\xCD\xEFMaxMind.com")
+	encodeValue(&out, map[string]interface{}{
+		"node_count":                  uint32(nodeCount),
+		"record_size":                 uint16(32),
+		"ip_version":                  uint16(4),
+		"database_type":               dbType,
+		"languages":                   []interface{}{"en"},
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(1700000000),
+		"description":                 map[string]interface{}{"en": "test"},
+	})
+
+	path := filepath.Join(t.TempDir(), dbType+".mmdb")
+	require.NoError(t, os.WriteFile(path, out.Bytes(), 0o600))
+	return path
+}
+
+func writeControl(buf *bytes.Buffer, typeNum, size int) {
+	var first byte
+	var extra []byte
+	switch {
+	case size < 29:
+		first = byte(size)
+	case size < 285:
+		first = 29
+		extra = []byte{byte(size - 29)}
+	default:
+		first = 30
+		extra = binary.BigEndian.AppendUint16(nil, uint16(size-285))
+	}
+	if typeNum > 7 {
+		buf.WriteByte(first)
+		buf.WriteByte(byte(typeNum - 7))
+	} else {
+		buf.WriteByte(byte(typeNum<<5) | first)
+	}
+	buf.Write(extra)
+}
+
+func trimmed(b []byte) []byte {
+	for len(b) > 0 && b[0] == 0 {
+		b = b[1:]
+	}
+	return b
+}
+
+func encodeValue(buf *bytes.Buffer, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		writeControl(buf, 2, len(v))
+		buf.WriteString(v)
+	case float64:
+		writeControl(buf, 3, 8)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(v))
+	case uint16:
+		b := trimmed(binary.BigEndian.AppendUint16(nil, v))
+		writeControl(buf, 5, len(b))
+		buf.Write(b)
+	case uint32:
+		b := trimmed(binary.BigEndian.AppendUint32(nil, v))
+		writeControl(buf, 6, len(b))
+		buf.Write(b)
+	case uint64:
+		b := trimmed(binary.BigEndian.AppendUint64(nil, v))
+		writeControl(buf, 9, len(b))
+		buf.Write(b)
+	case map[string]interface{}:
+		writeControl(buf, 7, len(v))
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			encodeValue(buf, k)
+			encodeValue(buf, v[k])
+		}
+	case []interface{}:
+		writeControl(buf, 11, len(v))
+		for _, item := range v {
+			encodeValue(buf, item)
+		}
+	default:
+		panic("tipo no soportado")
+	}
+}
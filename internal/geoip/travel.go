@@ -0,0 +1,78 @@
+package geoip
+
+import (
+	"math"
+	"time"
+)
+
+const earthRadiusKm = 6371.0
+
+// DefaultAccuracyKm es el radio que se asume para una ubicación cuya base no
+// informa precisión: las coordenadas suelen ser el centro de la ciudad o de
+// la región, no el lugar real
+const DefaultAccuracyKm = 50
+
+// Login es un inicio de sesión ubicado en el mapa
+type Login struct {
+	IP       string
+	Location Location
+	At       time.Time
+}
+
+// Travel describe el desplazamiento entre dos logins consecutivos de un
+// usuario que habría requerido viajar más rápido de lo posible
+type Travel struct {
+	UserID     uint
+	Previous   Login
+	Current    Login
+	DistanceKm float64
+	SpeedKmh   float64
+}
+
+// DistanceKm calcula la distancia sobre la superficie terrestre (haversine)
+func DistanceKm(a, b Location) float64 {
+	lat1 := a.Latitude * math.Pi / 180
+	lat2 := b.Latitude * math.Pi / 180
+	dLat := lat2 - lat1
+	dLon := (b.Longitude - a.Longitude) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// CheckTravel devuelve el viaje entre previous y current si su velocidad
+// supera maxSpeedKmh. Sin coordenadas en alguno de los dos no hay viaje, y
+// tampoco si la distancia cabe en los radios de precisión de ambas
+// ubicaciones, porque podrían ser el mismo lugar.
+func CheckTravel(userID uint, previous, current Login, maxSpeedKmh float64) (Travel, bool) {
+	if !previous.Location.HasCoordinates || !current.Location.HasCoordinates || maxSpeedKmh <= 0 {
+		return Travel{}, false
+	}
+
+	distance := DistanceKm(previous.Location, current.Location)
+	elapsed := current.At.Sub(previous.At).Hours()
+	speed := math.Inf(1)
+	if elapsed > 0 {
+		speed = distance / elapsed
+	}
+	// Logins simultáneos desde el mismo lugar no son un viaje
+	if distance <= accuracyKm(previous.Location)+accuracyKm(current.Location) || speed <= maxSpeedKmh {
+		return Travel{}, false
+	}
+
+	return Travel{
+		UserID:     userID,
+		Previous:   previous,
+		Current:    current,
+		DistanceKm: distance,
+		SpeedKmh:   speed,
+	}, true
+}
+
+func accuracyKm(loc Location) float64 {
+	if loc.AccuracyKm == 0 {
+		return DefaultAccuracyKm
+	}
+	return float64(loc.AccuracyKm)
+}
@@ -0,0 +1,40 @@
+package mail
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileMailer deja cada correo como un archivo .eml en un directorio, para
+// abrirlo con cualquier cliente de correo sin un servidor SMTP
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+func NewFileMailer(dir, from string) *FileMailer {
+	return &FileMailer{dir: dir, from: from}
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	now := time.Now()
+	data, err := msg.format(m.from, now)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(m.dir, 0o700); err != nil {
+		return err
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", now.UTC().Format("20060102T150405.000000000"), hex.EncodeToString(suffix))
+	return os.WriteFile(filepath.Join(m.dir, name), data, 0o600)
+}
@@ -0,0 +1,49 @@
+// Package mail envía los correos de la aplicación (verificación de email,
+// recuperación de contraseña, links de acceso). Mailer abstrae el transporte:
+// SMTPMailer para producción, FileMailer para desarrollo local y MemoryMailer
+// para las pruebas.
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrInvalidHeader indica un destinatario o asunto con saltos de línea, que
+// permitirían inyectar cabeceras
+var ErrInvalidHeader = errors.New("mail header contains line breaks")
+
+// Message es un correo de texto plano
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer entrega un correo
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// format arma el correo en formato RFC 5322 con el remitente from
+func (m Message) format(from string, at time.Time) ([]byte, error) {
+	for _, header := range []string{from, m.To, m.Subject} {
+		if strings.ContainsAny(header, "\r\n") {
+			return nil, ErrInvalidHeader
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", m.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", m.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", at.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(m.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return []byte(b.String()), nil
+}
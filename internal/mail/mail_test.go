@@ -0,0 +1,131 @@
+package mail
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testMessage = Message{
+	To:      "alice@example.com",
+	Subject: "Verify your email",
+	Body:    "Open this link:\nhttps://example.com/verify?token=abc",
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	mailer := NewFileMailer(dir, "no-reply@example.com")
+
+	require.NoError(t, mailer.Send(context.Background(), testMessage))
+	require.NoError(t, mailer.Send(context.Background(), testMessage))
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+
+	data, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "From: no-reply@example.com\r\n")
+	assert.Contains(t, string(data), "To: alice@example.com\r\n")
+	assert.Contains(t, string(data), "Subject: Verify your email\r\n")
+	assert.True(t, strings.HasSuffix(string(data), "\r\n\r\nOpen this link:\r\nhttps://example.com/verify?token=abc"))
+}
+
+func TestHeaderInjection(t *testing.T) {
+	mailer := NewFileMailer(t.TempDir(), "no-reply@example.com")
+	msg := testMessage
+	msg.To = "alice@example.com\r\nBcc: everyone@example.com"
+	assert.ErrorIs(t, mailer.Send(context.Background(), msg), ErrInvalidHeader)
+
+	msg = testMessage
+	msg.Subject = "hi\nBcc: everyone@example.com"
+	assert.ErrorIs(t, mailer.Send(context.Background(), msg), ErrInvalidHeader)
+}
+
+func TestMemoryMailer(t *testing.T) {
+	mailer := NewMemoryMailer()
+	require.NoError(t, mailer.Send(context.Background(), testMessage))
+	bob := Message{To: "bob@example.com", Subject: "hi"}
+	require.NoError(t, mailer.Send(context.Background(), bob))
+
+	assert.Len(t, mailer.Messages(), 2)
+	last, ok := mailer.Last("alice@example.com")
+	require.True(t, ok)
+	assert.Equal(t, testMessage, last)
+	_, ok = mailer.Last("carol@example.com")
+	assert.False(t, ok)
+}
+
+// fakeSMTPServer acepta una conexión, responde el diálogo SMTP mínimo y
+// devuelve por el canal lo recibido en DATA
+func fakeSMTPServer(t *testing.T) (string, <-chan string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+		reply("220 localhost ESMTP")
+		var data strings.Builder
+		inData := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if inData {
+				if line == ".\r\n" {
+					inData = false
+					received <- data.String()
+					reply("250 OK")
+					continue
+				}
+				data.WriteString(line)
+				continue
+			}
+			switch cmd := strings.ToUpper(strings.Fields(line)[0]); cmd {
+			case "EHLO", "HELO", "MAIL", "RCPT", "RSET", "NOOP":
+				reply("250 OK")
+			case "DATA":
+				inData = true
+				reply("354 go ahead")
+			case "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("502 not implemented")
+			}
+		}
+	}()
+	return ln.Addr().String(), received
+}
+
+func TestSMTPMailer(t *testing.T) {
+	addr, received := fakeSMTPServer(t)
+	host, port, err := net.SplitHostPort(addr)
+	require.NoError(t, err)
+	portNumber, err := net.LookupPort("tcp", port)
+	require.NoError(t, err)
+
+	mailer := NewSMTPMailer(host, portNumber, "", "", "no-reply@example.com")
+	require.NoError(t, mailer.Send(context.Background(), testMessage))
+
+	data := <-received
+	assert.Contains(t, data, "To: alice@example.com\r\n")
+	assert.Contains(t, data, "https://example.com/verify?token=abc")
+}
@@ -0,0 +1,51 @@
+package mail
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryMailer guarda los correos en memoria; lo usan las pruebas para leer
+// los links enviados
+type MemoryMailer struct {
+	// Err, si no es nil, se devuelve en cada envío
+	Err error
+
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+func (m *MemoryMailer) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.Err != nil {
+		return m.Err
+	}
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages devuelve los correos enviados, en orden
+func (m *MemoryMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
+
+// Last devuelve el último correo enviado a to
+func (m *MemoryMailer) Last(to string) (Message, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if m.messages[i].To == to {
+			return m.messages[i], true
+		}
+	}
+	return Message{}, false
+}
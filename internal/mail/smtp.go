@@ -0,0 +1,41 @@
+package mail
+
+import (
+	"context"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// SMTPMailer envía por un servidor SMTP. Con usuario usa AUTH PLAIN, que
+// net/smtp sólo permite sobre TLS (STARTTLS) o contra localhost.
+type SMTPMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+func NewSMTPMailer(host string, port int, username, password, from string) *SMTPMailer {
+	m := &SMTPMailer{
+		addr: net.JoinHostPort(host, strconv.Itoa(port)),
+		from: from,
+	}
+	if username != "" {
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m
+}
+
+// Send no respeta la cancelación del contexto una vez iniciada la conexión:
+// net/smtp no la soporta
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	data, err := msg.format(m.from, time.Now())
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{msg.To}, data)
+}
@@ -0,0 +1,84 @@
+package maintenance
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Locker decide qué réplica ejecuta la limpieza. TryLock no bloquea: si otra
+// réplica tiene el lock devuelve acquired == false y la corrida se saltea.
+type Locker interface {
+	TryLock(ctx context.Context) (release func(), acquired bool, err error)
+}
+
+const unlockTimeout = 5 * time.Second
+
+// AdvisoryLock usa un advisory lock de Postgres como elección de líder entre
+// réplicas. El lock es de sesión, así que se toma sobre una conexión dedicada
+// del pool que se devuelve al liberarlo; si el proceso muere, Postgres lo
+// suelta al cerrarse la conexión.
+type AdvisoryLock struct {
+	db  *gorm.DB
+	key int64
+}
+
+func NewAdvisoryLock(db *gorm.DB, key int64) *AdvisoryLock {
+	return &AdvisoryLock{db: db, key: key}
+}
+
+func (l *AdvisoryLock) TryLock(ctx context.Context) (func(), bool, error) {
+	sqlDB, err := l.db.DB()
+	if err != nil {
+		return nil, false, err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", l.key).Scan(&acquired); err != nil {
+		conn.Close()
+		return nil, false, err
+	}
+	if !acquired {
+		conn.Close()
+		return nil, false, nil
+	}
+
+	release := func() {
+		// Con un contexto propio: el de la corrida puede estar cancelado
+		unlockCtx, cancel := context.WithTimeout(context.Background(), unlockTimeout)
+		defer cancel()
+		unlock(unlockCtx, conn, l.key)
+	}
+	return release, true, nil
+}
+
+// unlock suelta el lock y devuelve la conexión al pool. Si no puede soltarlo
+// descarta la conexión en lugar de devolverla, para que Postgres libere el
+// lock al cerrarla y no quede tomado por una conexión ociosa.
+func unlock(ctx context.Context, conn *sql.Conn, key int64) {
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", key); err != nil {
+		_ = conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	}
+	conn.Close()
+}
+
+// LocalLock sólo excluye corridas dentro del mismo proceso; sirve para una
+// única réplica o para bases sin advisory locks (tests con SQLite)
+type LocalLock struct {
+	mu sync.Mutex
+}
+
+func (l *LocalLock) TryLock(ctx context.Context) (func(), bool, error) {
+	if !l.mu.TryLock() {
+		return nil, false, nil
+	}
+	return l.mu.Unlock, true, nil
+}
@@ -0,0 +1,194 @@
+package maintenance
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ramiroschettino/jwt-auth-api/internal/repositories"
+)
+
+// Worker purga periódicamente las sesiones vencidas, los tokens vencidos de
+// la lista negra y, si se configuran, los eventos de autenticación más viejos
+// que su retención, los contadores de logins fallidos abandonados y los
+// links de recuperación de contraseña vencidos. Borra en lotes de BatchSize
+// filas para no mantener locks largos sobre las tablas, y sólo corre en la
+// réplica que obtiene el Locker.
+type Worker struct {
+	userRepo    repositories.UserStore
+	sessionRepo repositories.SessionStore
+	events      repositories.AuthEventStore
+	retention   time.Duration
+	lockouts    repositories.LockoutStore
+	lockoutTTL  time.Duration
+	resets      repositories.PasswordResetStore
+	locker      Locker
+	interval    time.Duration
+	batchSize   int
+	onReport    func(Report)
+
+	cancel   context.CancelFunc
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+type Options struct {
+	// Interval es cada cuánto se intenta una limpieza
+	Interval time.Duration
+	// BatchSize es la cantidad máxima de filas borradas por DELETE
+	BatchSize int
+	// Locker elige qué réplica limpia; por defecto sólo excluye dentro del proceso
+	Locker Locker
+	// Events y EventRetention activan la purga del log de autenticación
+	Events         repositories.AuthEventStore
+	EventRetention time.Duration
+	// Lockouts y LockoutTTL activan la purga de los contadores de logins
+	// fallidos sin actividad ni bloqueo vigente en ese tiempo
+	Lockouts   repositories.LockoutStore
+	LockoutTTL time.Duration
+	// PasswordResets activa la purga de los links de recuperación vencidos
+	PasswordResets repositories.PasswordResetStore
+	// OnReport recibe el resultado de cada corrida; por defecto se loguea
+	OnReport func(Report)
+}
+
+// Report resume lo que borró una corrida
+type Report struct {
+	Sessions int64
+	Tokens   int64
+	Events   int64
+	Lockouts int64
+	// ResetTokens son los links de recuperación de contraseña vencidos
+	ResetTokens int64
+	Duration    time.Duration
+}
+
+func NewWorker(userRepo repositories.UserStore, sessionRepo repositories.SessionStore, opts Options) *Worker {
+	if opts.Interval <= 0 {
+		opts.Interval = 10 * time.Minute
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 1000
+	}
+	if opts.Locker == nil {
+		opts.Locker = &LocalLock{}
+	}
+	if opts.OnReport == nil {
+		opts.OnReport = logReport
+	}
+	return &Worker{
+		userRepo:    userRepo,
+		sessionRepo: sessionRepo,
+		events:      opts.Events,
+		retention:   opts.EventRetention,
+		lockouts:    opts.Lockouts,
+		lockoutTTL:  opts.LockoutTTL,
+		resets:      opts.PasswordResets,
+		locker:      opts.Locker,
+		interval:    opts.Interval,
+		batchSize:   opts.BatchSize,
+		onReport:    opts.OnReport,
+	}
+}
+
+// RunOnce ejecuta una limpieza completa si obtiene el lock. ran es false
+// cuando otra réplica está limpiando y esta corrida se salteó.
+func (w *Worker) RunOnce(ctx context.Context) (report Report, ran bool, err error) {
+	release, acquired, err := w.locker.TryLock(ctx)
+	if err != nil || !acquired {
+		return Report{}, false, err
+	}
+	defer release()
+
+	start := time.Now()
+	report.Sessions, err = w.purge(ctx, w.sessionRepo.CleanupExpiredSessions)
+	if err == nil {
+		report.Tokens, err = w.purge(ctx, w.userRepo.CleanupExpiredTokens)
+	}
+	if err == nil && w.events != nil && w.retention > 0 {
+		before := time.Now().Add(-w.retention)
+		report.Events, err = w.purge(ctx, func(ctx context.Context, limit int) (int64, error) {
+			return w.events.CleanupEventsBefore(ctx, before, limit)
+		})
+	}
+	if err == nil && w.lockouts != nil && w.lockoutTTL > 0 {
+		before := time.Now().Add(-w.lockoutTTL)
+		report.Lockouts, err = w.purge(ctx, func(ctx context.Context, limit int) (int64, error) {
+			return w.lockouts.CleanupFailuresBefore(ctx, before, limit)
+		})
+	}
+	if err == nil && w.resets != nil {
+		report.ResetTokens, err = w.purge(ctx, w.resets.CleanupExpiredResetTokens)
+	}
+	report.Duration = time.Since(start)
+	return report, true, err
+}
+
+// purge repite el borrado por lotes hasta que un lote sale incompleto
+func (w *Worker) purge(ctx context.Context, cleanup func(context.Context, int) (int64, error)) (int64, error) {
+	var total int64
+	for {
+		deleted, err := cleanup(ctx, w.batchSize)
+		total += deleted
+		if err != nil {
+			return total, err
+		}
+		if deleted < int64(w.batchSize) {
+			return total, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+	}
+}
+
+func (w *Worker) run(ctx context.Context) {
+	report, ran, err := w.RunOnce(ctx)
+	// Un error por Stop no es una falla de la limpieza
+	if err != nil && ctx.Err() == nil {
+		log.Printf("Error en la limpieza de sesiones y tokens: %v", err)
+	}
+	if ran {
+		w.onReport(report)
+	}
+}
+
+func logReport(r Report) {
+	log.Printf("Limpieza: %d sesiones, %d tokens, %d eventos, %d contadores de fallas y %d links de recuperación borrados en %s",
+		r.Sessions, r.Tokens, r.Events, r.Lockouts, r.ResetTokens, r.Duration)
+}
+
+// Start lanza la limpieza periódica en segundo plano; la primera corrida es
+// inmediata
+func (w *Worker) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	w.cancel = cancel
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		w.run(ctx)
+
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				w.run(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop cancela la corrida en curso y espera a que termine
+func (w *Worker) Stop() {
+	w.stopOnce.Do(func() {
+		if w.cancel != nil {
+			w.cancel()
+		}
+	})
+	w.wg.Wait()
+}
@@ -0,0 +1,97 @@
+package maintenance
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/ramiroschettino/jwt-auth-api/internal/models"
+	"github.com/ramiroschettino/jwt-auth-api/internal/repositories"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.Session{}, &models.InvalidToken{}))
+	return db
+}
+
+func TestWorkerPurgesInBatches(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+	sessionRepo := repositories.NewSessionRepository(db)
+
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	for i := 0; i < 7; i++ {
+		expiresAt := past
+		if i == 0 {
+			expiresAt = future
+		}
+		require.NoError(t, sessionRepo.CreateSession(ctx, &models.Session{
+			UserID:       1,
+			Token:        fmt.Sprintf("token-%d", i),
+			JTI:          fmt.Sprintf("jti-%d", i),
+			LastActivity: past,
+			ExpiresAt:    expiresAt,
+			IsActive:     true,
+		}))
+		require.NoError(t, userRepo.InvalidateToken(ctx, fmt.Sprintf("revoked-%d", i), fmt.Sprintf("rjti-%d", i), expiresAt))
+	}
+	// Una sesión ya borrada con soft delete también se purga
+	require.NoError(t, db.Where("token = ?", "token-1").Delete(&models.Session{}).Error)
+
+	var reports []Report
+	worker := NewWorker(userRepo, sessionRepo, Options{
+		BatchSize: 2,
+		OnReport:  func(r Report) { reports = append(reports, r) },
+	})
+
+	report, ran, err := worker.RunOnce(ctx)
+	require.NoError(t, err)
+	assert.True(t, ran)
+	assert.Equal(t, int64(6), report.Sessions)
+	assert.Equal(t, int64(6), report.Tokens)
+
+	var sessions, tokens int64
+	db.Unscoped().Model(&models.Session{}).Count(&sessions)
+	db.Unscoped().Model(&models.InvalidToken{}).Count(&tokens)
+	assert.Equal(t, int64(1), sessions)
+	assert.Equal(t, int64(1), tokens)
+
+	// Una segunda corrida no encuentra nada
+	report, _, err = worker.RunOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, Report{Duration: report.Duration}, report)
+
+	worker.Start()
+	worker.Stop()
+	assert.Len(t, reports, 1)
+}
+
+func TestWorkerSkipsWithoutLock(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	lock := &LocalLock{}
+
+	worker := NewWorker(repositories.NewUserRepository(db), repositories.NewSessionRepository(db), Options{Locker: lock})
+
+	release, acquired, err := lock.TryLock(ctx)
+	require.NoError(t, err)
+	require.True(t, acquired)
+
+	_, ran, err := worker.RunOnce(ctx)
+	assert.NoError(t, err)
+	assert.False(t, ran)
+
+	release()
+	_, ran, err = worker.RunOnce(ctx)
+	assert.NoError(t, err)
+	assert.True(t, ran)
+}
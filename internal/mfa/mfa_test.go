@@ -0,0 +1,56 @@
+package mfa
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTOTP(t *testing.T) {
+	key, err := GenerateTOTP("JWT Auth API", "alice")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(key.URI, "otpauth://totp/JWT%20Auth%20API:alice?"))
+	assert.Contains(t, key.URI, "secret="+key.Secret)
+	_, err = png.Decode(bytes.NewReader(key.QRCode))
+	require.NoError(t, err)
+
+	now := time.Unix(1_700_000_010, 0)
+	code, err := TOTPCode(key.Secret, now)
+	require.NoError(t, err)
+
+	step, ok := VerifyTOTP(key.Secret, code, now)
+	assert.True(t, ok)
+	assert.Equal(t, now.Unix()/totpPeriod, step)
+
+	// Se tolera un paso de desfase en cada sentido, no más
+	_, ok = VerifyTOTP(key.Secret, code, now.Add(totpPeriod*time.Second))
+	assert.True(t, ok)
+	_, ok = VerifyTOTP(key.Secret, code, now.Add(2*totpPeriod*time.Second))
+	assert.False(t, ok)
+
+	_, ok = VerifyTOTP(key.Secret, "12345", now)
+	assert.False(t, ok)
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := GenerateRecoveryCodes(RecoveryCodeCount)
+	require.NoError(t, err)
+	require.Len(t, codes, RecoveryCodeCount)
+	require.Len(t, hashes, RecoveryCodeCount)
+
+	seen := make(map[string]bool)
+	for i, code := range codes {
+		assert.Regexp(t, `^[a-z2-7]{5}-[a-z2-7]{5}$`, code)
+		assert.False(t, seen[code])
+		seen[code] = true
+		assert.Equal(t, hashes[i], HashRecoveryCode(code))
+	}
+
+	// Mayúsculas, espacios y guiones no cambian el hash
+	assert.Equal(t, hashes[0], HashRecoveryCode(" "+strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))))
+}
@@ -0,0 +1,42 @@
+package mfa
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"strings"
+)
+
+// RecoveryCodeCount es la cantidad de códigos de recuperación por usuario
+const RecoveryCodeCount = 10
+
+// recoveryEncoding usa el alfabeto base32 en minúsculas y sin relleno: diez
+// caracteres fáciles de transcribir
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateRecoveryCodes crea n códigos de la forma xxxxx-xxxxx (50 bits de
+// entropía cada uno) y devuelve también sus hashes, que es lo único que se
+// guarda
+func GenerateRecoveryCodes(n int) (codes, hashes []string, err error) {
+	for i := 0; i < n; i++ {
+		raw := make([]byte, 7)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, err
+		}
+		encoded := strings.ToLower(recoveryEncoding.EncodeToString(raw))[:10]
+		code := encoded[:5] + "-" + encoded[5:]
+		codes = append(codes, code)
+		hashes = append(hashes, HashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode normaliza el código (mayúsculas, espacios y guiones dan
+// igual) y devuelve su SHA-256 en hex. Con 50 bits de entropía no hace falta
+// un hash lento.
+func HashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,90 @@
+// Package mfa implementa los segundos factores basados en secretos
+// compartidos: códigos TOTP (RFC 6238) y códigos de recuperación de un solo uso.
+package mfa
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"image/png"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+const (
+	totpPeriod = 30
+	// totpSkew acepta el código del paso anterior y del siguiente para
+	// tolerar relojes algo desfasados
+	totpSkew = 1
+	qrSize   = 256
+)
+
+// TOTPKey es un secreto recién generado junto con lo que necesita el usuario
+// para cargarlo en su app de autenticación
+type TOTPKey struct {
+	// Secret va en base32, tal como se guarda y como se muestra para
+	// cargarlo a mano
+	Secret string
+	// URI es la URI otpauth:// que codifica el QR
+	URI string
+	// QRCode es la imagen PNG del QR
+	QRCode []byte
+}
+
+// GenerateTOTP crea un secreto nuevo para la cuenta account de issuer
+func GenerateTOTP(issuer, account string) (*TOTPKey, error) {
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      issuer,
+		AccountName: account,
+		Period:      totpPeriod,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := key.Image(qrSize, qrSize)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+
+	return &TOTPKey{Secret: key.Secret(), URI: key.URL(), QRCode: buf.Bytes()}, nil
+}
+
+// TOTPCode calcula el código de secret para el instante at
+func TOTPCode(secret string, at time.Time) (string, error) {
+	return totp.GenerateCodeCustom(secret, at, validateOpts())
+}
+
+// VerifyTOTP comprueba code contra secret en at y devuelve el paso de tiempo
+// en que coincidió. Quien lo llama debe rechazar pasos ya usados para que un
+// código no sirva dos veces.
+func VerifyTOTP(secret, code string, at time.Time) (int64, bool) {
+	if len(code) != otp.DigitsSix.Length() {
+		return 0, false
+	}
+	step := at.Unix() / totpPeriod
+	for offset := int64(-totpSkew); offset <= totpSkew; offset++ {
+		candidate := step + offset
+		expected, err := TOTPCode(secret, time.Unix(candidate*totpPeriod, 0))
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return candidate, true
+		}
+	}
+	return 0, false
+}
+
+func validateOpts() totp.ValidateOpts {
+	return totp.ValidateOpts{
+		Period:    totpPeriod,
+		Digits:    otp.DigitsSix,
+		Algorithm: otp.AlgorithmSHA1,
+	}
+}
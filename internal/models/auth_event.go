@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// Tipos de evento de autenticación
+const (
+	AuthEventLogin          = "login"
+	AuthEventLogout         = "logout"
+	AuthEventPasswordReset  = "password_reset"
+	AuthEventPasswordChange = "password_change"
+)
+
+// AuthEvent registra un intento de autenticación, exitoso o no. Es un log de
+// sólo escritura: no usa gorm.Model porque nunca se actualiza ni se borra con
+// soft delete, sólo se purga por antigüedad.
+type AuthEvent struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"not null;index"`
+
+	// UserID es nil cuando el usuario no existe
+	UserID    *uint  `gorm:"index"`
+	Username  string `gorm:"type:varchar(255);index"`
+	Type      string `gorm:"type:varchar(32);not null;index"`
+	Success   bool   `gorm:"not null;index"`
+	Reason    string `gorm:"type:varchar(64)"`
+	Method    string `gorm:"type:varchar(32)"`
+	MFA       bool   `gorm:"column:mfa;not null;default:false"`
+	SessionID *uint
+
+	IP        string `gorm:"type:varchar(45);index"`
+	UserAgent string `gorm:"type:text"`
+	Country   string `gorm:"type:varchar(2)"`
+	City      string `gorm:"type:varchar(128)"`
+	ASN       uint   `gorm:"column:asn"`
+	// Coordenadas aproximadas de la IP y su radio de precisión, para
+	// comparar cada login con el anterior
+	Latitude   *float64 `gorm:"type:double precision"`
+	Longitude  *float64 `gorm:"type:double precision"`
+	AccuracyKm uint     `gorm:"column:accuracy_km"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Device es un dispositivo desde el que el usuario ya inició sesión,
+// identificado por su huella (ver el paquete devices)
+type Device struct {
+	gorm.Model
+	UserID      uint      `gorm:"not null;uniqueIndex:idx_device_user_fingerprint"`
+	Fingerprint string    `gorm:"type:varchar(64);not null;uniqueIndex:idx_device_user_fingerprint"`
+	UserAgent   string    `gorm:"type:text"`
+	IP          string    `gorm:"type:varchar(45)"`
+	LastSeenAt  time.Time `gorm:"not null"`
+}
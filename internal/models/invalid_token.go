@@ -9,6 +9,7 @@ import (
 type InvalidToken struct {
 	gorm.Model
 	Token     string    `gorm:"uniqueIndex;not null"`
+	JTI       string    `gorm:"index"`
 	ExpiresAt time.Time `gorm:"not null"`
 	UserID    uint      `gorm:"not null"`
 	Reason    string
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// LoginFailure cuenta los logins fallidos recientes de una clave ("user:..."
+// o "ip:...") y hasta cuándo queda bloqueada
+type LoginFailure struct {
+	ID          uint      `gorm:"primarykey"`
+	Key         string    `gorm:"column:lock_key;type:varchar(320);not null;uniqueIndex"`
+	Failures    int       `gorm:"not null;default:0"`
+	LastFailure time.Time `gorm:"not null;index"`
+	LockedUntil time.Time
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// TOTPSecret es el secreto TOTP de un usuario. Hasta que se confirma con un
+// código válido no se exige en el login.
+type TOTPSecret struct {
+	ID          uint `gorm:"primarykey"`
+	CreatedAt   time.Time
+	UserID      uint   `gorm:"not null;uniqueIndex"`
+	Secret      string `gorm:"type:varchar(64);not null"`
+	ConfirmedAt *time.Time
+	// LastUsedStep es el último paso de tiempo aceptado, para que un código
+	// no pueda usarse dos veces
+	LastUsedStep int64 `gorm:"not null;default:0"`
+}
+
+// RecoveryCode es un código de recuperación de un solo uso; sólo se guarda
+// su hash
+type RecoveryCode struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UserID    uint   `gorm:"not null;uniqueIndex:idx_recovery_user_hash"`
+	CodeHash  string `gorm:"type:varchar(64);not null;uniqueIndex:idx_recovery_user_hash"`
+	UsedAt    *time.Time
+}
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
@@ -9,6 +11,10 @@ type User struct {
 	Username string `gorm:"unique;not null"`
 	Password string `gorm:"not null"`
 	Role     string `gorm:"not null"`
+	// Email es opcional (NULL no choca con el índice único) y se guarda en
+	// minúsculas; EmailVerifiedAt se borra cada vez que cambia
+	Email           *string `gorm:"uniqueIndex"`
+	EmailVerifiedAt *time.Time
 }
 
 type Note struct {
@@ -19,7 +25,9 @@ type Note struct {
 }
 
 type TokenClaims struct {
-	UserID   uint   `json:"user_id"`
-	Username string `json:"username"`
-	Role     string `json:"role"`
+	UserID    uint   `json:"user_id"`
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	JTI       string `json:"jti"`
+	SessionID uint   `json:"-"`
 }
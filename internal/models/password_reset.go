@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// PasswordResetToken es un link de recuperación de contraseña. Sólo se guarda
+// el SHA-256 del token: quien lea la tabla no puede usar los links.
+type PasswordResetToken struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UserID    uint      `gorm:"not null;index"`
+	TokenHash string    `gorm:"type:varchar(64);not null;uniqueIndex"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+	UsedAt    *time.Time
+}
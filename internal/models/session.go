@@ -10,11 +10,24 @@ type Session struct {
 	gorm.Model
 	UserID       uint      `gorm:"not null;index"`
 	Token        string    `gorm:"type:text;not null;uniqueIndex"`
+	JTI          string    `gorm:"type:varchar(64);index"`
 	LastActivity time.Time `gorm:"not null;index"`
 	ExpiresAt    time.Time `gorm:"not null;index"`
 	UserAgent    string    `gorm:"type:text"`
 	IP           string    `gorm:"type:varchar(45)"`
 	IsActive     bool      `gorm:"not null;default:true;index"`
+
+	// Huella del dispositivo y si era desconocido al iniciar la sesión
+	DeviceFingerprint string `gorm:"type:varchar(64)"`
+	NewDevice         bool   `gorm:"not null;default:false"`
+
+	// Ubicación aproximada de la IP según la base GeoIP, si está configurada
+	Country   string   `gorm:"type:varchar(2)"`
+	City      string   `gorm:"type:varchar(128)"`
+	ASN       uint     `gorm:"column:asn"`
+	ASOrg     string   `gorm:"column:as_org;type:varchar(255)"`
+	Latitude  *float64 `gorm:"type:double precision"`
+	Longitude *float64 `gorm:"type:double precision"`
 }
 
 func (s *Session) IsExpired() bool {
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// WebAuthnCredential es una passkey registrada por un usuario
+type WebAuthnCredential struct {
+	ID           uint `gorm:"primarykey"`
+	CreatedAt    time.Time
+	UserID       uint   `gorm:"not null;index"`
+	Name         string `gorm:"type:varchar(100)"`
+	CredentialID []byte `gorm:"not null;uniqueIndex"`
+	PublicKey    []byte `gorm:"not null"`
+	// AttestationType y Transports se guardan tal como los informó el
+	// autenticador; Transports separados por comas
+	AttestationType string
+	Transports      string
+	AAGUID          []byte
+	// SignCount es el último contador de firmas visto; si un login trae uno
+	// que no avanza el autenticador puede estar clonado
+	SignCount      uint32 `gorm:"not null;default:0"`
+	CloneWarning   bool   `gorm:"not null;default:false"`
+	UserVerified   bool
+	BackupEligible bool
+	BackupState    bool
+	LastUsedAt     *time.Time
+}
+
+func (WebAuthnCredential) TableName() string {
+	return "webauthn_credentials"
+}
@@ -0,0 +1,125 @@
+package passhash
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const argon2idPrefix = "$argon2id$"
+
+// Argon2idParams son los parámetros de costo de argon2id. Memory va en KiB.
+type Argon2idParams struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2idParams sigue la segunda recomendación de RFC 9106 con
+// menos paralelismo: 64 MiB, 3 pasadas, 2 hilos
+func DefaultArgon2idParams() Argon2idParams {
+	return Argon2idParams{Memory: 64 * 1024, Iterations: 3, Parallelism: 2, SaltLength: 16, KeyLength: 32}
+}
+
+// Argon2id hashea con argon2id y los parámetros dados
+type Argon2id struct {
+	params Argon2idParams
+}
+
+// NewArgon2id completa con los valores por defecto los parámetros en cero
+func NewArgon2id(params Argon2idParams) *Argon2id {
+	defaults := DefaultArgon2idParams()
+	if params.Memory == 0 {
+		params.Memory = defaults.Memory
+	}
+	if params.Iterations == 0 {
+		params.Iterations = defaults.Iterations
+	}
+	if params.Parallelism == 0 {
+		params.Parallelism = defaults.Parallelism
+	}
+	if params.SaltLength == 0 {
+		params.SaltLength = defaults.SaltLength
+	}
+	if params.KeyLength == 0 {
+		params.KeyLength = defaults.KeyLength
+	}
+	return &Argon2id{params: params}
+}
+
+func (a *Argon2id) Hash(password string) (string, error) {
+	salt := make([]byte, a.params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, a.params.Iterations, a.params.Memory, a.params.Parallelism, a.params.KeyLength)
+	return encodeArgon2id(a.params, salt, key), nil
+}
+
+func (a *Argon2id) Verify(password, encoded string) (bool, error) {
+	return Verify(password, encoded)
+}
+
+// NeedsRehash es true si el hash es de otro algoritmo o se generó con otros
+// parámetros
+func (a *Argon2id) NeedsRehash(encoded string) bool {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return params.Memory != a.params.Memory ||
+		params.Iterations != a.params.Iterations ||
+		params.Parallelism != a.params.Parallelism ||
+		uint32(len(salt)) != a.params.SaltLength ||
+		uint32(len(key)) != a.params.KeyLength
+}
+
+func verifyArgon2id(password, encoded string) (bool, error) {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+	candidate := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+	return subtle.ConstantTimeCompare(candidate, key) == 1, nil
+}
+
+// encodeArgon2id arma $argon2id$v=19$m=...,t=...,p=...$sal$hash con base64
+// estándar sin relleno, como la referencia de argon2
+func encodeArgon2id(params Argon2idParams, salt, key []byte) string {
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version,
+		params.Memory, params.Iterations, params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+func decodeArgon2id(encoded string) (params Argon2idParams, salt, key []byte, err error) {
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", sal, hash
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, ErrUnknownFormat
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2 version %q", parts[2])
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id parameters %q", parts[3])
+	}
+	if params.Memory == 0 || params.Iterations == 0 || params.Parallelism == 0 {
+		return params, nil, nil, fmt.Errorf("invalid argon2id parameters %q", parts[3])
+	}
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id salt: %w", err)
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(key) == 0 {
+		return params, nil, nil, fmt.Errorf("invalid argon2id hash")
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
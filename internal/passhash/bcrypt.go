@@ -0,0 +1,127 @@
+package passhash
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const bcryptPrefix = "$bcrypt$"
+
+// bcryptEncoding es el base64 propio de bcrypt, con el que van la sal y el
+// hash en el Modular Crypt Format
+var bcryptEncoding = base64.NewEncoding("./ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789").WithPadding(base64.NoPadding)
+
+// Bcrypt hashea con bcrypt y guarda el resultado en formato PHC
+// ($bcrypt$c=costo$sal$hash). Verifica también los hashes en el Modular Crypt
+// Format ($2a$costo$salhash) de antes de passhash; NeedsRehash los marca
+// para pasarlos a PHC en el próximo login.
+type Bcrypt struct {
+	cost int
+}
+
+// NewBcrypt usa bcrypt.DefaultCost si cost es 0
+func NewBcrypt(cost int) *Bcrypt {
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+	return &Bcrypt{cost: cost}
+}
+
+func (b *Bcrypt) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), b.cost)
+	if err != nil {
+		return "", err
+	}
+	return encodeBcrypt(string(hash))
+}
+
+func (b *Bcrypt) Verify(password, encoded string) (bool, error) {
+	return Verify(password, encoded)
+}
+
+// NeedsRehash es true si el hash es de otro algoritmo, de otro costo o
+// todavía está en Modular Crypt Format
+func (b *Bcrypt) NeedsRehash(encoded string) bool {
+	if !strings.HasPrefix(encoded, bcryptPrefix) {
+		return true
+	}
+	mcf, err := decodeBcrypt(encoded)
+	if err != nil {
+		return true
+	}
+	cost, err := bcrypt.Cost([]byte(mcf))
+	return err != nil || cost != b.cost
+}
+
+// isLegacyBcrypt reconoce los hashes de bcrypt en Modular Crypt Format
+func isLegacyBcrypt(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+// verifyBcrypt acepta el hash en PHC o en Modular Crypt Format
+func verifyBcrypt(password, encoded string) (bool, error) {
+	mcf := encoded
+	if strings.HasPrefix(encoded, bcryptPrefix) {
+		var err error
+		if mcf, err = decodeBcrypt(encoded); err != nil {
+			return false, err
+		}
+	}
+	err := bcrypt.CompareHashAndPassword([]byte(mcf), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// encodeBcrypt pasa $2a$10$<22 de sal><31 de hash> a $bcrypt$c=10$sal$hash,
+// con la sal y el hash en base64 estándar sin relleno como en argon2id
+func encodeBcrypt(mcf string) (string, error) {
+	// "", "2a", costo, sal+hash
+	parts := strings.Split(mcf, "$")
+	if len(parts) != 4 || len(parts[3]) != 53 {
+		return "", ErrUnknownFormat
+	}
+	cost, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return "", fmt.Errorf("invalid bcrypt cost %q", parts[2])
+	}
+	salt, err := bcryptEncoding.DecodeString(parts[3][:22])
+	if err != nil {
+		return "", fmt.Errorf("invalid bcrypt salt: %w", err)
+	}
+	hash, err := bcryptEncoding.DecodeString(parts[3][22:])
+	if err != nil {
+		return "", fmt.Errorf("invalid bcrypt hash: %w", err)
+	}
+	return fmt.Sprintf("%sc=%d$%s$%s", bcryptPrefix, cost,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(hash)), nil
+}
+
+// decodeBcrypt arma el Modular Crypt Format que entiende bcrypt a partir de
+// un hash en PHC
+func decodeBcrypt(encoded string) (string, error) {
+	// "", "bcrypt", "c=...", sal, hash
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 5 || parts[1] != "bcrypt" {
+		return "", ErrUnknownFormat
+	}
+	var cost int
+	if _, err := fmt.Sscanf(parts[2], "c=%d", &cost); err != nil || cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return "", fmt.Errorf("invalid bcrypt cost %q", parts[2])
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(salt) != 16 {
+		return "", fmt.Errorf("invalid bcrypt salt")
+	}
+	hash, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil || len(hash) != 23 {
+		return "", fmt.Errorf("invalid bcrypt hash")
+	}
+	return fmt.Sprintf("$2a$%02d$%s%s", cost, bcryptEncoding.EncodeToString(salt), bcryptEncoding.EncodeToString(hash)), nil
+}
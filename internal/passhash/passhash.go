@@ -0,0 +1,31 @@
+// Package passhash hashea contraseñas con argon2id o bcrypt y las guarda en
+// formato PHC: $argon2id$v=19$m=...,t=...,p=...$sal$hash y
+// $bcrypt$c=costo$sal$hash. También verifica los hashes de bcrypt en Modular
+// Crypt Format ($2a$costo$salhash) guardados antes de passhash. Cualquier
+// Hasher verifica hashes de los dos algoritmos, así se puede cambiar de
+// algoritmo o de parámetros sin invalidar las contraseñas guardadas:
+// NeedsRehash indica cuáles conviene regenerar la próxima vez que se conozca
+// la contraseña.
+package passhash
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrUnknownFormat es un hash que no es de ningún algoritmo soportado
+var ErrUnknownFormat = errors.New("unknown password hash format")
+
+// Verify compara password con un hash de cualquier algoritmo soportado. Una
+// contraseña incorrecta devuelve false sin error; el error queda para los
+// hashes mal formados.
+func Verify(password, encoded string) (bool, error) {
+	switch {
+	case strings.HasPrefix(encoded, argon2idPrefix):
+		return verifyArgon2id(password, encoded)
+	case strings.HasPrefix(encoded, bcryptPrefix), isLegacyBcrypt(encoded):
+		return verifyBcrypt(password, encoded)
+	default:
+		return false, ErrUnknownFormat
+	}
+}
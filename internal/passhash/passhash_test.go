@@ -0,0 +1,105 @@
+package passhash
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Parámetros chicos para que los tests no tarden
+var testArgon2 = Argon2idParams{Memory: 64, Iterations: 1, Parallelism: 1}
+
+func TestArgon2id(t *testing.T) {
+	hasher := NewArgon2id(testArgon2)
+
+	encoded, err := hasher.Hash("correct horse")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(encoded, "$argon2id$v=19$m=64,t=1,p=1$"), encoded)
+
+	other, err := hasher.Hash("correct horse")
+	require.NoError(t, err)
+	assert.NotEqual(t, encoded, other, "cada hash lleva su propia sal")
+
+	ok, err := hasher.Verify("correct horse", encoded)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = hasher.Verify("wrong horse", encoded)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.False(t, hasher.NeedsRehash(encoded))
+	assert.True(t, NewArgon2id(Argon2idParams{Memory: 128, Iterations: 1, Parallelism: 1}).NeedsRehash(encoded))
+	assert.True(t, NewBcrypt(bcrypt.MinCost).NeedsRehash(encoded))
+}
+
+func TestBcrypt(t *testing.T) {
+	hasher := NewBcrypt(bcrypt.MinCost)
+
+	encoded, err := hasher.Hash("correct horse")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(encoded, "$bcrypt$c=4$"), encoded)
+	ok, err := hasher.Verify("correct horse", encoded)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = hasher.Verify("wrong horse", encoded)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.False(t, hasher.NeedsRehash(encoded))
+	assert.True(t, NewBcrypt(bcrypt.MinCost+1).NeedsRehash(encoded))
+	assert.True(t, NewArgon2id(testArgon2).NeedsRehash(encoded))
+
+	// Un hasher argon2id verifica los bcrypt guardados antes del cambio
+	ok, err = NewArgon2id(testArgon2).Verify("correct horse", encoded)
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestBcryptLegacyFormat(t *testing.T) {
+	hasher := NewBcrypt(bcrypt.MinCost)
+
+	// Los hashes en Modular Crypt Format de antes de passhash siguen sirviendo
+	// y se marcan para pasarlos a PHC
+	legacy, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	require.NoError(t, err)
+	ok, err := hasher.Verify("correct horse", string(legacy))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = hasher.Verify("wrong horse", string(legacy))
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.True(t, hasher.NeedsRehash(string(legacy)))
+
+	// El PHC es el mismo hash con otra codificación: se vuelve al original
+	encoded, err := encodeBcrypt(string(legacy))
+	require.NoError(t, err)
+	mcf, err := decodeBcrypt(encoded)
+	require.NoError(t, err)
+	assert.Equal(t, string(legacy), mcf)
+	ok, err = hasher.Verify("correct horse", encoded)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.False(t, hasher.NeedsRehash(encoded))
+}
+
+func TestVerifyMalformed(t *testing.T) {
+	for _, encoded := range []string{
+		"",
+		"plaintext",
+		"$argon2i$v=19$m=64,t=1,p=1$c2FsdA$aGFzaA",
+		"$argon2id$v=16$m=64,t=1,p=1$c2FsdA$aGFzaA",
+		"$argon2id$v=19$m=0,t=1,p=1$c2FsdA$aGFzaA",
+		"$argon2id$v=19$m=64,t=1,p=1$!!$aGFzaA",
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdA$",
+		"$bcrypt$c=10$c2FsdA$aGFzaA",
+		"$bcrypt$c=99$AAAAAAAAAAAAAAAAAAAAAA$AAAAAAAAAAAAAAAAAAAAAAAAAAAAAA",
+		"$bcrypt$c=10$!!$aGFzaA",
+	} {
+		ok, err := Verify("password", encoded)
+		assert.Error(t, err, encoded)
+		assert.False(t, ok, encoded)
+	}
+}
@@ -0,0 +1,121 @@
+// Package ratelimit implementa un limitador token bucket en memoria, con un
+// balde por clave (IP, usuario, cliente de la API...).
+//
+// Cada réplica lleva sus propios baldes: con N réplicas detrás de un
+// balanceador el límite efectivo por clave es hasta N veces el configurado.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit es la capacidad de un balde: Burst requests de golpe y una
+// reposición continua de Rate requests por segundo
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// PerPeriod permite n requests por período, todos de golpe si el balde está
+// lleno
+func PerPeriod(n int, period time.Duration) Limit {
+	return Limit{Rate: float64(n) / period.Seconds(), Burst: n}
+}
+
+// Result es la decisión sobre un request y el estado del balde después
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset es cuánto falta para que el balde vuelva a estar lleno
+	Reset time.Duration
+	// RetryAfter es cuánto falta para el próximo request permitido; cero si
+	// el request se permitió
+	RetryAfter time.Duration
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter reparte un balde por clave con el mismo Limit
+type Limiter struct {
+	limit Limit
+	now   func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func NewLimiter(limit Limit) *Limiter {
+	return &Limiter{
+		limit:   limit,
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow consume un token del balde de key si hay disponible
+func (l *Limiter) Allow(key string) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	burst := float64(l.limit.Burst)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*l.limit.Rate)
+	b.last = now
+
+	result := Result{Limit: l.limit.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = l.durationFor(1 - b.tokens)
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = l.durationFor(burst - b.tokens)
+	return result
+}
+
+// durationFor devuelve el tiempo que tarda en reponerse la cantidad de tokens
+func (l *Limiter) durationFor(tokens float64) time.Duration {
+	if l.limit.Rate <= 0 {
+		return 0
+	}
+	return time.Duration(tokens / l.limit.Rate * float64(time.Second))
+}
+
+// sweep descarta, como mucho una vez por minuto, los baldes que ya se
+// habrían llenado: recrearlos da el mismo resultado y el mapa no crece con
+// cada IP que pasó alguna vez
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+
+	full := l.durationFor(float64(l.limit.Burst))
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Len devuelve la cantidad de baldes en memoria
+func (l *Limiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
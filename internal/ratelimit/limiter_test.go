@@ -0,0 +1,39 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Now()
+	limiter := NewLimiter(PerPeriod(3, 3*time.Second))
+	limiter.now = func() time.Time { return now }
+
+	for i := 2; i >= 0; i-- {
+		result := limiter.Allow("a")
+		assert.True(t, result.Allowed)
+		assert.Equal(t, 3, result.Limit)
+		assert.Equal(t, i, result.Remaining)
+	}
+
+	result := limiter.Allow("a")
+	assert.False(t, result.Allowed)
+	assert.Equal(t, time.Second, result.RetryAfter)
+	assert.Equal(t, 3*time.Second, result.Reset)
+
+	// Otra clave tiene su propio balde
+	assert.True(t, limiter.Allow("b").Allowed)
+
+	// Se repone un token por segundo
+	now = now.Add(time.Second)
+	assert.True(t, limiter.Allow("a").Allowed)
+	assert.False(t, limiter.Allow("a").Allowed)
+
+	// Los baldes llenos se descartan
+	now = now.Add(time.Hour)
+	limiter.Allow("c")
+	assert.Equal(t, 1, limiter.Len())
+}
@@ -0,0 +1,95 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/ramiroschettino/jwt-auth-api/internal/models"
+	"gorm.io/gorm"
+)
+
+// Cantidad máxima de eventos por consulta
+const maxAuthEventsPage = 500
+
+type AuthEventRepository struct {
+	db      *gorm.DB
+	timeout time.Duration
+}
+
+func NewAuthEventRepository(db *gorm.DB) *AuthEventRepository {
+	return &AuthEventRepository{db: db}
+}
+
+// WithQueryTimeout limita la duración de cada query del repositorio
+func (r *AuthEventRepository) WithQueryTimeout(timeout time.Duration) *AuthEventRepository {
+	r.timeout = timeout
+	return r
+}
+
+func (r *AuthEventRepository) RecordEvent(ctx context.Context, event *models.AuthEvent) error {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+	return db.Create(event).Error
+}
+
+func (r *AuthEventRepository) FindEvents(ctx context.Context, filter AuthEventFilter) ([]models.AuthEvent, error) {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
+	query := db.Model(&models.AuthEvent{})
+	if filter.UserID != 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.Username != "" {
+		query = query.Where("username = ?", filter.Username)
+	}
+	if filter.IP != "" {
+		query = query.Where("ip = ?", filter.IP)
+	}
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if filter.Success != nil {
+		query = query.Where("success = ?", *filter.Success)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("created_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("created_at < ?", filter.Until)
+	}
+	if filter.BeforeID != 0 {
+		query = query.Where("id < ?", filter.BeforeID)
+	}
+
+	limit := filter.Limit
+	if limit <= 0 || limit > maxAuthEventsPage {
+		limit = maxAuthEventsPage
+	}
+
+	var events []models.AuthEvent
+	if err := query.Order("id DESC").Limit(limit).Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// CleanupEventsBefore borra hasta limit eventos anteriores a before (todos si
+// limit <= 0) y devuelve cuántos borró
+func (r *AuthEventRepository) CleanupEventsBefore(ctx context.Context, before time.Time, limit int) (int64, error) {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
+	query := db.Where("created_at < ?", before)
+	if limit > 0 {
+		ids := db.Model(&models.AuthEvent{}).
+			Select("id").
+			Where("created_at < ?", before).
+			Order("id").
+			Limit(limit)
+		query = db.Where("id IN (?)", ids)
+	}
+
+	result := query.Delete(&models.AuthEvent{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,37 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// withContext asocia ctx a la sesión de GORM y, si timeout es mayor a cero,
+// le agrega un plazo propio para que ninguna query quede colgada.
+// El llamador debe invocar cancel cuando termina la query.
+func withContext(ctx context.Context, db *gorm.DB, timeout time.Duration) (*gorm.DB, context.CancelFunc) {
+	if timeout <= 0 {
+		return db.WithContext(ctx), func() {}
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return db.WithContext(ctx), cancel
+}
+
+// deleteExpired borra sin soft delete las filas de model con expires_at en el
+// pasado. Con limit > 0 borra como mucho limit filas, eligiendo los ids en una
+// subquery para no bloquear la tabla entera en un único DELETE.
+func deleteExpired(db *gorm.DB, model interface{}, limit int) (int64, error) {
+	query := db.Unscoped().Where("expires_at < ?", time.Now())
+	if limit > 0 {
+		ids := db.Unscoped().Model(model).
+			Select("id").
+			Where("expires_at < ?", time.Now()).
+			Order("id").
+			Limit(limit)
+		query = db.Unscoped().Where("id IN (?)", ids)
+	}
+
+	result := query.Delete(model)
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,59 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/ramiroschettino/jwt-auth-api/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type DeviceRepository struct {
+	db      *gorm.DB
+	timeout time.Duration
+}
+
+func NewDeviceRepository(db *gorm.DB) *DeviceRepository {
+	return &DeviceRepository{db: db}
+}
+
+// WithQueryTimeout limita la duración de cada query del repositorio
+func (r *DeviceRepository) WithQueryTimeout(timeout time.Duration) *DeviceRepository {
+	r.timeout = timeout
+	return r
+}
+
+// TouchDevice inserta el dispositivo ignorando el conflicto con el índice
+// único (usuario, huella); si no insertó nada ya existía y sólo se actualiza
+// su último uso. Así dos logins simultáneos no pueden registrarlo dos veces.
+func (r *DeviceRepository) TouchDevice(ctx context.Context, device *models.Device) (bool, error) {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(device)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return true, nil
+	}
+
+	err := db.Model(&models.Device{}).
+		Where("user_id = ? AND fingerprint = ?", device.UserID, device.Fingerprint).
+		Updates(map[string]interface{}{
+			"last_seen_at": device.LastSeenAt,
+			"user_agent":   device.UserAgent,
+			"ip":           device.IP,
+		}).Error
+	return false, err
+}
+
+func (r *DeviceRepository) CountDevices(ctx context.Context, userID uint) (int64, error) {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
+	var count int64
+	err := db.Model(&models.Device{}).Where("user_id = ?", userID).Count(&count).Error
+	return count, err
+}
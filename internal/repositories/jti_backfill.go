@@ -0,0 +1,61 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ramiroschettino/jwt-auth-api/internal/models"
+	"gorm.io/gorm"
+)
+
+// BackfillJTIs completa la columna jti de las sesiones y los tokens revocados
+// creados antes de que existiera. Authenticate busca las sesiones por jti, así
+// que sin esto todos los tokens emitidos antes de la migración dejarían de
+// servir. El jti sale del propio token guardado, que siempre lo incluyó; no
+// hace falta verificar la firma porque el token viene de la base. Sólo se
+// tocan las filas vigentes y es idempotente: se llama después de AutoMigrate.
+func BackfillJTIs(ctx context.Context, db *gorm.DB) (int64, error) {
+	db = db.WithContext(ctx)
+	sessions, err := backfillJTIs(db, &models.Session{}, db.Where("is_active = ?", true))
+	if err != nil {
+		return sessions, err
+	}
+	revoked, err := backfillJTIs(db, &models.InvalidToken{}, db)
+	return sessions + revoked, err
+}
+
+type jtiRow struct {
+	ID    uint
+	Token string
+}
+
+// backfillJTIs completa el jti de las filas vigentes de model que cumplen scope
+func backfillJTIs(db *gorm.DB, model interface{}, scope *gorm.DB) (int64, error) {
+	var rows []jtiRow
+	var updated int64
+	parser := jwt.NewParser()
+
+	err := scope.Model(model).
+		Select("id", "token").
+		Where("(jti = '' OR jti IS NULL) AND expires_at > ?", time.Now()).
+		FindInBatches(&rows, 500, func(tx *gorm.DB, batch int) error {
+			for _, row := range rows {
+				claims := jwt.MapClaims{}
+				if _, _, err := parser.ParseUnverified(row.Token, claims); err != nil {
+					continue
+				}
+				jti, _ := claims["jti"].(string)
+				if jti == "" {
+					continue
+				}
+				result := db.Model(model).Where("id = ?", row.ID).Update("jti", jti)
+				if result.Error != nil {
+					return result.Error
+				}
+				updated += result.RowsAffected
+			}
+			return nil
+		}).Error
+	return updated, err
+}
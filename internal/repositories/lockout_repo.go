@@ -0,0 +1,100 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ramiroschettino/jwt-auth-api/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type LockoutRepository struct {
+	db      *gorm.DB
+	timeout time.Duration
+}
+
+func NewLockoutRepository(db *gorm.DB) *LockoutRepository {
+	return &LockoutRepository{db: db}
+}
+
+// WithQueryTimeout limita la duración de cada query del repositorio
+func (r *LockoutRepository) WithQueryTimeout(timeout time.Duration) *LockoutRepository {
+	r.timeout = timeout
+	return r
+}
+
+func (r *LockoutRepository) GetFailure(ctx context.Context, key string) (*models.LoginFailure, error) {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
+	var failure models.LoginFailure
+	err := db.Where("lock_key = ?", key).First(&failure).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &failure, nil
+}
+
+// RegisterFailure hace el incremento con un único upsert para que dos
+// intentos simultáneos no pierdan ninguna falla
+func (r *LockoutRepository) RegisterFailure(ctx context.Context, key string, at, resetBefore time.Time) (int, error) {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
+	err := db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "lock_key"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"failures":     gorm.Expr("CASE WHEN login_failures.last_failure < ? THEN 1 ELSE login_failures.failures + 1 END", resetBefore),
+			"last_failure": at,
+		}),
+	}).Create(&models.LoginFailure{Key: key, Failures: 1, LastFailure: at}).Error
+	if err != nil {
+		return 0, err
+	}
+
+	var failures int
+	err = db.Model(&models.LoginFailure{}).Where("lock_key = ?", key).Pluck("failures", &failures).Error
+	return failures, err
+}
+
+func (r *LockoutRepository) LockUntil(ctx context.Context, key string, until time.Time) error {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
+	return db.Model(&models.LoginFailure{}).
+		Where("lock_key = ?", key).
+		Update("locked_until", until).Error
+}
+
+func (r *LockoutRepository) ResetFailures(ctx context.Context, key string) error {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
+	return db.Where("lock_key = ?", key).Delete(&models.LoginFailure{}).Error
+}
+
+// CleanupFailuresBefore borra los registros sin fallas ni bloqueo posteriores
+// a before, hasta limit filas (todas si limit <= 0)
+func (r *LockoutRepository) CleanupFailuresBefore(ctx context.Context, before time.Time, limit int) (int64, error) {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
+	condition := "last_failure < ? AND (locked_until IS NULL OR locked_until < ?)"
+	query := db.Where(condition, before, before)
+	if limit > 0 {
+		ids := db.Model(&models.LoginFailure{}).
+			Select("id").
+			Where(condition, before, before).
+			Order("id").
+			Limit(limit)
+		query = db.Where("id IN (?)", ids)
+	}
+
+	result := query.Delete(&models.LoginFailure{})
+	return result.RowsAffected, result.Error
+}
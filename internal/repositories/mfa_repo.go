@@ -0,0 +1,112 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ramiroschettino/jwt-auth-api/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type MFARepository struct {
+	db      *gorm.DB
+	timeout time.Duration
+}
+
+func NewMFARepository(db *gorm.DB) *MFARepository {
+	return &MFARepository{db: db}
+}
+
+// WithQueryTimeout limita la duración de cada query del repositorio
+func (r *MFARepository) WithQueryTimeout(timeout time.Duration) *MFARepository {
+	r.timeout = timeout
+	return r
+}
+
+func (r *MFARepository) SaveTOTP(ctx context.Context, secret *models.TOTPSecret) error {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"created_at", "secret", "confirmed_at", "last_used_step"}),
+	}).Create(secret).Error
+}
+
+func (r *MFARepository) GetTOTP(ctx context.Context, userID uint) (*models.TOTPSecret, error) {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
+	var secret models.TOTPSecret
+	err := db.Where("user_id = ?", userID).First(&secret).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &secret, nil
+}
+
+func (r *MFARepository) ConfirmTOTP(ctx context.Context, userID uint, at time.Time) error {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
+	return db.Model(&models.TOTPSecret{}).
+		Where("user_id = ?", userID).
+		Update("confirmed_at", at).Error
+}
+
+// UseTOTPStep avanza el último paso usado con un UPDATE condicional, así dos
+// requests simultáneos con el mismo código no pueden ganar los dos
+func (r *MFARepository) UseTOTPStep(ctx context.Context, userID uint, step int64) (bool, error) {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
+	result := db.Model(&models.TOTPSecret{}).
+		Where("user_id = ? AND last_used_step < ?", userID, step).
+		Update("last_used_step", step)
+	return result.RowsAffected == 1, result.Error
+}
+
+func (r *MFARepository) ReplaceRecoveryCodes(ctx context.Context, userID uint, hashes []string) error {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		codes := make([]models.RecoveryCode, 0, len(hashes))
+		for _, hash := range hashes {
+			codes = append(codes, models.RecoveryCode{UserID: userID, CodeHash: hash})
+		}
+		if len(codes) == 0 {
+			return nil
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+func (r *MFARepository) UseRecoveryCode(ctx context.Context, userID uint, hash string, at time.Time) (bool, error) {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
+	result := db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+		Update("used_at", at)
+	return result.RowsAffected == 1, result.Error
+}
+
+func (r *MFARepository) CountRecoveryCodes(ctx context.Context, userID uint) (int, error) {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
+	var count int64
+	err := db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&count).Error
+	return int(count), err
+}
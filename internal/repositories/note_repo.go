@@ -1,25 +1,40 @@
 package repositories
 
 import (
+	"context"
+	"time"
+
 	"github.com/ramiroschettino/jwt-auth-api/internal/models"
 	"gorm.io/gorm"
 )
 
 type NoteRepository struct {
-	db *gorm.DB
+	db      *gorm.DB
+	timeout time.Duration
 }
 
 func NewNoteRepository(db *gorm.DB) *NoteRepository {
 	return &NoteRepository{db: db}
 }
 
-func (r *NoteRepository) CreateNote(note *models.Note) error {
-	return r.db.Create(note).Error
+// WithQueryTimeout limita la duración de cada query del repositorio
+func (r *NoteRepository) WithQueryTimeout(timeout time.Duration) *NoteRepository {
+	r.timeout = timeout
+	return r
+}
+
+func (r *NoteRepository) CreateNote(ctx context.Context, note *models.Note) error {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+	return db.Create(note).Error
 }
 
-func (r *NoteRepository) FindNotesByUserID(userID uint) ([]models.Note, error) {
+func (r *NoteRepository) FindNotesByUserID(ctx context.Context, userID uint) ([]models.Note, error) {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
 	var notes []models.Note
-	err := r.db.Where("user_id = ?", userID).Find(&notes).Error
+	err := db.Where("user_id = ?", userID).Find(&notes).Error
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,86 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ramiroschettino/jwt-auth-api/internal/models"
+	"gorm.io/gorm"
+)
+
+type PasswordResetRepository struct {
+	db      *gorm.DB
+	timeout time.Duration
+}
+
+func NewPasswordResetRepository(db *gorm.DB) *PasswordResetRepository {
+	return &PasswordResetRepository{db: db}
+}
+
+// WithQueryTimeout limita la duración de cada query del repositorio
+func (r *PasswordResetRepository) WithQueryTimeout(timeout time.Duration) *PasswordResetRepository {
+	r.timeout = timeout
+	return r
+}
+
+func (r *PasswordResetRepository) CreateResetToken(ctx context.Context, token *models.PasswordResetToken) error {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+	return db.Create(token).Error
+}
+
+func (r *PasswordResetRepository) FindResetToken(ctx context.Context, tokenHash string, at time.Time) (*models.PasswordResetToken, error) {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
+	var token models.PasswordResetToken
+	err := db.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", tokenHash, at).First(&token).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// ConsumeResetToken marca el token con un UPDATE condicional, así dos
+// requests simultáneos con el mismo link no pueden usarlo los dos
+func (r *PasswordResetRepository) ConsumeResetToken(ctx context.Context, tokenHash string, at time.Time) (*models.PasswordResetToken, error) {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
+	result := db.Model(&models.PasswordResetToken{}).
+		Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", tokenHash, at).
+		Update("used_at", at)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+
+	var token models.PasswordResetToken
+	if err := db.Where("token_hash = ?", tokenHash).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *PasswordResetRepository) DeleteUserResetTokens(ctx context.Context, userID uint) error {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+	return db.Where("user_id = ?", userID).Delete(&models.PasswordResetToken{}).Error
+}
+
+// CleanupExpiredResetTokens borra hasta limit links vencidos (todos si
+// limit <= 0) y devuelve cuántos borró
+func (r *PasswordResetRepository) CleanupExpiredResetTokens(ctx context.Context, limit int) (int64, error) {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+	return deleteExpired(db, &models.PasswordResetToken{}, limit)
+}
@@ -0,0 +1,877 @@
+// Package repotest provee implementaciones en memoria de los stores de
+// repositories para tests unitarios de servicios, sin levantar una base.
+//
+// Cada fake tiene un campo Err: si no es nil, todas las operaciones que
+// devuelven error fallan con ese valor, para probar caminos de error.
+package repotest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	apperrors "github.com/ramiroschettino/jwt-auth-api/internal/errors"
+	"github.com/ramiroschettino/jwt-auth-api/internal/models"
+	"github.com/ramiroschettino/jwt-auth-api/internal/repositories"
+)
+
+var (
+	_ repositories.UserStore   = (*UserStore)(nil)
+	_ repositories.NoteStore   = (*NoteStore)(nil)
+	_ repositories.DeviceStore = (*DeviceStore)(nil)
+
+	_ repositories.AuthEventStore = (*AuthEventStore)(nil)
+	_ repositories.LockoutStore   = (*LockoutStore)(nil)
+	_ repositories.MFAStore       = (*MFAStore)(nil)
+	_ repositories.WebAuthnStore  = (*WebAuthnStore)(nil)
+)
+
+// NewSessionStore devuelve un SessionStore en memoria
+func NewSessionStore() *repositories.MemorySessionStore {
+	return repositories.NewMemorySessionStore()
+}
+
+type revokedToken struct {
+	token     string
+	userID    uint
+	expiresAt time.Time
+}
+
+// UserStore es un repositorio de usuarios y tokens revocados en memoria
+type UserStore struct {
+	Err error
+
+	mu      sync.Mutex
+	nextID  uint
+	users   map[string]*models.User
+	revoked map[string]revokedToken
+}
+
+func NewUserStore() *UserStore {
+	return &UserStore{
+		users:   make(map[string]*models.User),
+		revoked: make(map[string]revokedToken),
+	}
+}
+
+func (f *UserStore) CreateUser(ctx context.Context, user *models.User) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return f.Err
+	}
+	if _, ok := f.users[user.Username]; ok {
+		return apperrors.ErrUserExists
+	}
+	for _, existing := range f.users {
+		if user.Email != nil && existing.Email != nil && *existing.Email == *user.Email {
+			return apperrors.ErrEmailTaken
+		}
+	}
+	f.nextID++
+	now := time.Now()
+	user.ID = f.nextID
+	user.CreatedAt = now
+	user.UpdatedAt = now
+
+	stored := *user
+	f.users[user.Username] = &stored
+	return nil
+}
+
+func (f *UserStore) FindUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	user, ok := f.users[username]
+	if !ok {
+		return nil, apperrors.ErrUserNotFound
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (f *UserStore) FindUserByID(ctx context.Context, id uint) (*models.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	for _, user := range f.users {
+		if user.ID == id {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, apperrors.ErrUserNotFound
+}
+
+func (f *UserStore) FindUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	for _, user := range f.users {
+		if user.Email != nil && *user.Email == email {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, apperrors.ErrUserNotFound
+}
+
+func (f *UserStore) IsUsernameTaken(ctx context.Context, username string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return false, f.Err
+	}
+	_, ok := f.users[username]
+	return ok, nil
+}
+
+func (f *UserStore) IsEmailTaken(ctx context.Context, email string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return false, f.Err
+	}
+	for _, user := range f.users {
+		if user.Email != nil && *user.Email == email {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *UserStore) HasPasswordHashPrefix(ctx context.Context, prefix string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return false, f.Err
+	}
+	for _, user := range f.users {
+		if strings.HasPrefix(user.Password, prefix) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *UserStore) UpdateEmail(ctx context.Context, userID uint, email string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return f.Err
+	}
+	for _, user := range f.users {
+		if user.Email != nil && *user.Email == email && user.ID != userID {
+			return apperrors.ErrEmailTaken
+		}
+	}
+	for _, user := range f.users {
+		if user.ID == userID {
+			user.Email = &email
+			user.EmailVerifiedAt = nil
+		}
+	}
+	return nil
+}
+
+func (f *UserStore) MarkEmailVerified(ctx context.Context, userID uint, email string, at time.Time) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return false, f.Err
+	}
+	for _, user := range f.users {
+		if user.ID == userID && user.Email != nil && *user.Email == email {
+			user.EmailVerifiedAt = &at
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *UserStore) UpdatePassword(ctx context.Context, userID uint, passwordHash string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return f.Err
+	}
+	for _, user := range f.users {
+		if user.ID == userID {
+			user.Password = passwordHash
+		}
+	}
+	return nil
+}
+
+func (f *UserStore) InvalidateToken(ctx context.Context, token, jti string, expiresAt time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return f.Err
+	}
+	f.revoked[jti] = revokedToken{token: token, expiresAt: expiresAt}
+	return nil
+}
+
+func (f *UserStore) ConsumeToken(ctx context.Context, token, jti string, expiresAt time.Time) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return false, f.Err
+	}
+	if _, ok := f.revoked[jti]; ok {
+		return false, nil
+	}
+	f.revoked[jti] = revokedToken{token: token, expiresAt: expiresAt}
+	return true, nil
+}
+
+func (f *UserStore) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return false, f.Err
+	}
+	t, ok := f.revoked[jti]
+	return ok && time.Now().Before(t.expiresAt), nil
+}
+
+func (f *UserStore) FindRevokedJTIs(ctx context.Context) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	var jtis []string
+	for jti, t := range f.revoked {
+		if jti != "" && time.Now().Before(t.expiresAt) {
+			jtis = append(jtis, jti)
+		}
+	}
+	return jtis, nil
+}
+
+func (f *UserStore) CleanupExpiredTokens(ctx context.Context, limit int) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return 0, f.Err
+	}
+	var deleted int64
+	for jti, t := range f.revoked {
+		if limit > 0 && deleted >= int64(limit) {
+			break
+		}
+		if !time.Now().Before(t.expiresAt) {
+			delete(f.revoked, jti)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (f *UserStore) InvalidateUserTokens(ctx context.Context, userID uint) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return f.Err
+	}
+	for jti, t := range f.revoked {
+		if t.userID == userID {
+			t.expiresAt = time.Now()
+			f.revoked[jti] = t
+		}
+	}
+	return nil
+}
+
+// NoteStore es un repositorio de notas en memoria
+type NoteStore struct {
+	Err error
+
+	mu     sync.Mutex
+	nextID uint
+	notes  []models.Note
+}
+
+func NewNoteStore() *NoteStore {
+	return &NoteStore{}
+}
+
+func (f *NoteStore) CreateNote(ctx context.Context, note *models.Note) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return f.Err
+	}
+	f.nextID++
+	now := time.Now()
+	note.ID = f.nextID
+	note.CreatedAt = now
+	note.UpdatedAt = now
+	f.notes = append(f.notes, *note)
+	return nil
+}
+
+func (f *NoteStore) FindNotesByUserID(ctx context.Context, userID uint) ([]models.Note, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	var notes []models.Note
+	for _, note := range f.notes {
+		if note.UserID == userID {
+			notes = append(notes, note)
+		}
+	}
+	return notes, nil
+}
+
+// DeviceStore es un repositorio de dispositivos conocidos en memoria
+type DeviceStore struct {
+	Err error
+
+	mu      sync.Mutex
+	nextID  uint
+	devices map[uint]map[string]*models.Device
+}
+
+func NewDeviceStore() *DeviceStore {
+	return &DeviceStore{devices: make(map[uint]map[string]*models.Device)}
+}
+
+func (f *DeviceStore) TouchDevice(ctx context.Context, device *models.Device) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return false, f.Err
+	}
+	byFingerprint, ok := f.devices[device.UserID]
+	if !ok {
+		byFingerprint = make(map[string]*models.Device)
+		f.devices[device.UserID] = byFingerprint
+	}
+	if known, ok := byFingerprint[device.Fingerprint]; ok {
+		known.LastSeenAt = device.LastSeenAt
+		known.UserAgent = device.UserAgent
+		known.IP = device.IP
+		return false, nil
+	}
+
+	f.nextID++
+	now := time.Now()
+	device.ID = f.nextID
+	device.CreatedAt = now
+	device.UpdatedAt = now
+	stored := *device
+	byFingerprint[device.Fingerprint] = &stored
+	return true, nil
+}
+
+func (f *DeviceStore) CountDevices(ctx context.Context, userID uint) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return 0, f.Err
+	}
+	return int64(len(f.devices[userID])), nil
+}
+
+// AuthEventStore es un log de eventos de autenticación en memoria
+type AuthEventStore struct {
+	Err error
+
+	mu     sync.Mutex
+	nextID uint
+	events []models.AuthEvent
+}
+
+func NewAuthEventStore() *AuthEventStore {
+	return &AuthEventStore{}
+}
+
+func (f *AuthEventStore) RecordEvent(ctx context.Context, event *models.AuthEvent) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return f.Err
+	}
+	f.nextID++
+	event.ID = f.nextID
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	f.events = append(f.events, *event)
+	return nil
+}
+
+func (f *AuthEventStore) FindEvents(ctx context.Context, filter repositories.AuthEventFilter) ([]models.AuthEvent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	var events []models.AuthEvent
+	for i := len(f.events) - 1; i >= 0; i-- {
+		event := f.events[i]
+		switch {
+		case filter.UserID != 0 && (event.UserID == nil || *event.UserID != filter.UserID),
+			filter.Username != "" && event.Username != filter.Username,
+			filter.IP != "" && event.IP != filter.IP,
+			filter.Type != "" && event.Type != filter.Type,
+			filter.Success != nil && event.Success != *filter.Success,
+			!filter.Since.IsZero() && event.CreatedAt.Before(filter.Since),
+			!filter.Until.IsZero() && !event.CreatedAt.Before(filter.Until),
+			filter.BeforeID != 0 && event.ID >= filter.BeforeID:
+			continue
+		}
+		events = append(events, event)
+		if filter.Limit > 0 && len(events) == filter.Limit {
+			break
+		}
+	}
+	return events, nil
+}
+
+func (f *AuthEventStore) CleanupEventsBefore(ctx context.Context, before time.Time, limit int) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return 0, f.Err
+	}
+	var deleted int64
+	kept := f.events[:0]
+	for _, event := range f.events {
+		if event.CreatedAt.Before(before) && (limit <= 0 || deleted < int64(limit)) {
+			deleted++
+			continue
+		}
+		kept = append(kept, event)
+	}
+	f.events = kept
+	return deleted, nil
+}
+
+// LockoutStore lleva en memoria la cuenta de logins fallidos
+type LockoutStore struct {
+	Err error
+
+	mu       sync.Mutex
+	failures map[string]models.LoginFailure
+}
+
+func NewLockoutStore() *LockoutStore {
+	return &LockoutStore{failures: make(map[string]models.LoginFailure)}
+}
+
+func (f *LockoutStore) GetFailure(ctx context.Context, key string) (*models.LoginFailure, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	failure, ok := f.failures[key]
+	if !ok {
+		return nil, nil
+	}
+	return &failure, nil
+}
+
+func (f *LockoutStore) RegisterFailure(ctx context.Context, key string, at, resetBefore time.Time) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return 0, f.Err
+	}
+	failure := f.failures[key]
+	failure.Key = key
+	if failure.LastFailure.Before(resetBefore) {
+		failure.Failures = 0
+	}
+	failure.Failures++
+	failure.LastFailure = at
+	f.failures[key] = failure
+	return failure.Failures, nil
+}
+
+func (f *LockoutStore) LockUntil(ctx context.Context, key string, until time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return f.Err
+	}
+	if failure, ok := f.failures[key]; ok {
+		failure.LockedUntil = until
+		f.failures[key] = failure
+	}
+	return nil
+}
+
+func (f *LockoutStore) ResetFailures(ctx context.Context, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return f.Err
+	}
+	delete(f.failures, key)
+	return nil
+}
+
+func (f *LockoutStore) CleanupFailuresBefore(ctx context.Context, before time.Time, limit int) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return 0, f.Err
+	}
+	var deleted int64
+	for key, failure := range f.failures {
+		if limit > 0 && deleted >= int64(limit) {
+			break
+		}
+		if failure.LastFailure.Before(before) && failure.LockedUntil.Before(before) {
+			delete(f.failures, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// MFAStore guarda en memoria secretos TOTP y códigos de recuperación
+type MFAStore struct {
+	Err error
+
+	mu       sync.Mutex
+	secrets  map[uint]models.TOTPSecret
+	recovery map[uint][]models.RecoveryCode
+}
+
+func NewMFAStore() *MFAStore {
+	return &MFAStore{
+		secrets:  make(map[uint]models.TOTPSecret),
+		recovery: make(map[uint][]models.RecoveryCode),
+	}
+}
+
+func (f *MFAStore) SaveTOTP(ctx context.Context, secret *models.TOTPSecret) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return f.Err
+	}
+	f.secrets[secret.UserID] = *secret
+	return nil
+}
+
+func (f *MFAStore) GetTOTP(ctx context.Context, userID uint) (*models.TOTPSecret, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	secret, ok := f.secrets[userID]
+	if !ok {
+		return nil, nil
+	}
+	return &secret, nil
+}
+
+func (f *MFAStore) ConfirmTOTP(ctx context.Context, userID uint, at time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return f.Err
+	}
+	if secret, ok := f.secrets[userID]; ok {
+		secret.ConfirmedAt = &at
+		f.secrets[userID] = secret
+	}
+	return nil
+}
+
+func (f *MFAStore) UseTOTPStep(ctx context.Context, userID uint, step int64) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return false, f.Err
+	}
+	secret, ok := f.secrets[userID]
+	if !ok || secret.LastUsedStep >= step {
+		return false, nil
+	}
+	secret.LastUsedStep = step
+	f.secrets[userID] = secret
+	return true, nil
+}
+
+func (f *MFAStore) ReplaceRecoveryCodes(ctx context.Context, userID uint, hashes []string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return f.Err
+	}
+	codes := make([]models.RecoveryCode, 0, len(hashes))
+	for _, hash := range hashes {
+		codes = append(codes, models.RecoveryCode{UserID: userID, CodeHash: hash, CreatedAt: time.Now()})
+	}
+	f.recovery[userID] = codes
+	return nil
+}
+
+func (f *MFAStore) UseRecoveryCode(ctx context.Context, userID uint, hash string, at time.Time) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return false, f.Err
+	}
+	for i, code := range f.recovery[userID] {
+		if code.CodeHash == hash && code.UsedAt == nil {
+			f.recovery[userID][i].UsedAt = &at
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *MFAStore) CountRecoveryCodes(ctx context.Context, userID uint) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return 0, f.Err
+	}
+	count := 0
+	for _, code := range f.recovery[userID] {
+		if code.UsedAt == nil {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// WebAuthnStore guarda passkeys en memoria
+type WebAuthnStore struct {
+	Err error
+
+	mu          sync.Mutex
+	nextID      uint
+	credentials map[uint]models.WebAuthnCredential
+}
+
+func NewWebAuthnStore() *WebAuthnStore {
+	return &WebAuthnStore{credentials: make(map[uint]models.WebAuthnCredential)}
+}
+
+func (f *WebAuthnStore) CreateCredential(ctx context.Context, credential *models.WebAuthnCredential) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return f.Err
+	}
+	for _, existing := range f.credentials {
+		if bytes.Equal(existing.CredentialID, credential.CredentialID) {
+			return errors.New("credential already registered")
+		}
+	}
+	f.nextID++
+	credential.ID = f.nextID
+	credential.CreatedAt = time.Now()
+	f.credentials[credential.ID] = *credential
+	return nil
+}
+
+func (f *WebAuthnStore) FindCredentialsByUser(ctx context.Context, userID uint) ([]models.WebAuthnCredential, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	var result []models.WebAuthnCredential
+	for _, credential := range f.credentials {
+		if credential.UserID == userID {
+			result = append(result, credential)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
+
+func (f *WebAuthnStore) UpdateCredentialUse(ctx context.Context, credential *models.WebAuthnCredential) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return f.Err
+	}
+	stored, ok := f.credentials[credential.ID]
+	if !ok {
+		return nil
+	}
+	stored.SignCount = credential.SignCount
+	stored.CloneWarning = credential.CloneWarning
+	stored.UserVerified = credential.UserVerified
+	stored.BackupState = credential.BackupState
+	stored.LastUsedAt = credential.LastUsedAt
+	f.credentials[credential.ID] = stored
+	return nil
+}
+
+func (f *WebAuthnStore) DeleteCredential(ctx context.Context, userID, id uint) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return false, f.Err
+	}
+	credential, ok := f.credentials[id]
+	if !ok || credential.UserID != userID {
+		return false, nil
+	}
+	delete(f.credentials, id)
+	return true, nil
+}
+
+// PasswordResetStore guarda links de recuperación en memoria, por hash
+type PasswordResetStore struct {
+	Err error
+
+	mu     sync.Mutex
+	nextID uint
+	tokens map[string]*models.PasswordResetToken
+}
+
+func NewPasswordResetStore() *PasswordResetStore {
+	return &PasswordResetStore{tokens: make(map[string]*models.PasswordResetToken)}
+}
+
+func (f *PasswordResetStore) CreateResetToken(ctx context.Context, token *models.PasswordResetToken) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return f.Err
+	}
+	if _, ok := f.tokens[token.TokenHash]; ok {
+		return errors.New("reset token already exists")
+	}
+	f.nextID++
+	token.ID = f.nextID
+	token.CreatedAt = time.Now()
+	stored := *token
+	f.tokens[token.TokenHash] = &stored
+	return nil
+}
+
+func (f *PasswordResetStore) FindResetToken(ctx context.Context, tokenHash string, at time.Time) (*models.PasswordResetToken, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	token, ok := f.tokens[tokenHash]
+	if !ok || token.UsedAt != nil || !token.ExpiresAt.After(at) {
+		return nil, nil
+	}
+	copied := *token
+	return &copied, nil
+}
+
+func (f *PasswordResetStore) ConsumeResetToken(ctx context.Context, tokenHash string, at time.Time) (*models.PasswordResetToken, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	token, ok := f.tokens[tokenHash]
+	if !ok || token.UsedAt != nil || !token.ExpiresAt.After(at) {
+		return nil, nil
+	}
+	token.UsedAt = &at
+	copied := *token
+	return &copied, nil
+}
+
+func (f *PasswordResetStore) DeleteUserResetTokens(ctx context.Context, userID uint) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return f.Err
+	}
+	for hash, token := range f.tokens {
+		if token.UserID == userID {
+			delete(f.tokens, hash)
+		}
+	}
+	return nil
+}
+
+func (f *PasswordResetStore) CleanupExpiredResetTokens(ctx context.Context, limit int) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return 0, f.Err
+	}
+	var deleted int64
+	now := time.Now()
+	for hash, token := range f.tokens {
+		if limit > 0 && deleted >= int64(limit) {
+			break
+		}
+		if token.ExpiresAt.Before(now) {
+			delete(f.tokens, hash)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,165 @@
+package repositories
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	apperrors "github.com/ramiroschettino/jwt-auth-api/internal/errors"
+	"github.com/ramiroschettino/jwt-auth-api/internal/models"
+)
+
+// MemorySessionStore guarda las sesiones en el proceso. Sirve para tests y
+// para despliegues de una sola instancia; las sesiones se pierden al reiniciar.
+type MemorySessionStore struct {
+	mu       sync.RWMutex
+	nextID   uint
+	sessions map[uint]*models.Session
+	byToken  map[string]uint
+	byJTI    map[string]uint
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		sessions: make(map[uint]*models.Session),
+		byToken:  make(map[string]uint),
+		byJTI:    make(map[string]uint),
+	}
+}
+
+func (m *MemorySessionStore) CreateSession(ctx context.Context, session *models.Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nextID++
+	now := time.Now()
+	session.ID = m.nextID
+	session.CreatedAt = now
+	session.UpdatedAt = now
+
+	stored := *session
+	m.sessions[session.ID] = &stored
+	m.byToken[session.Token] = session.ID
+	if session.JTI != "" {
+		m.byJTI[session.JTI] = session.ID
+	}
+	return nil
+}
+
+func (m *MemorySessionStore) GetActiveSessionByToken(ctx context.Context, token string) (*models.Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.activeLocked(m.byToken[token])
+}
+
+func (m *MemorySessionStore) GetActiveSessionByJTI(ctx context.Context, jti string) (*models.Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.activeLocked(m.byJTI[jti])
+}
+
+func (m *MemorySessionStore) GetActiveSessionByID(ctx context.Context, id uint) (*models.Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.activeLocked(id)
+}
+
+func (m *MemorySessionStore) activeLocked(id uint) (*models.Session, error) {
+	session, ok := m.sessions[id]
+	if !ok || !session.IsActive || session.IsExpired() {
+		return nil, apperrors.ErrSessionNotFound
+	}
+	copied := *session
+	return &copied, nil
+}
+
+func (m *MemorySessionStore) GetActiveSessionsByUserID(ctx context.Context, userID uint) ([]models.Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var sessions []models.Session
+	for _, session := range m.sessions {
+		if session.UserID == userID && session.IsActive && !session.IsExpired() {
+			sessions = append(sessions, *session)
+		}
+	}
+	return sessions, nil
+}
+
+func (m *MemorySessionStore) DeactivateSession(ctx context.Context, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if session, ok := m.sessions[m.byToken[token]]; ok {
+		session.IsActive = false
+		session.ExpiresAt = time.Now()
+	}
+	return nil
+}
+
+func (m *MemorySessionStore) DeactivateUserSessionsAndBlacklist(ctx context.Context, userID uint, userRepo UserStore) error {
+	sessions, err := m.GetActiveSessionsByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if err := m.DeactivateSession(ctx, session.Token); err != nil {
+			return err
+		}
+		if err := userRepo.InvalidateToken(ctx, session.Token, session.JTI, session.ExpiresAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MemorySessionStore) UpdateLastActivity(ctx context.Context, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if session, ok := m.sessions[m.byToken[token]]; ok && session.IsActive {
+		session.LastActivity = time.Now()
+	}
+	return nil
+}
+
+func (m *MemorySessionStore) UpdateLastActivityBatch(ctx context.Context, ids []uint, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, id := range ids {
+		if session, ok := m.sessions[id]; ok && session.IsActive && session.LastActivity.Before(at) {
+			session.LastActivity = at
+		}
+	}
+	return nil
+}
+
+func (m *MemorySessionStore) ExtendSession(ctx context.Context, id uint, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if session, ok := m.sessions[id]; ok && session.IsActive && session.ExpiresAt.Before(expiresAt) {
+		session.ExpiresAt = expiresAt
+	}
+	return nil
+}
+
+func (m *MemorySessionStore) CleanupExpiredSessions(ctx context.Context, limit int) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted int64
+	for id, session := range m.sessions {
+		if limit > 0 && deleted >= int64(limit) {
+			break
+		}
+		if session.IsExpired() {
+			delete(m.byToken, session.Token)
+			delete(m.byJTI, session.JTI)
+			delete(m.sessions, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
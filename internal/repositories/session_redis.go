@@ -0,0 +1,324 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	apperrors "github.com/ramiroschettino/jwt-auth-api/internal/errors"
+	"github.com/ramiroschettino/jwt-auth-api/internal/models"
+	"github.com/ramiroschettino/jwt-auth-api/internal/resp"
+)
+
+// RedisSessionStore guarda las sesiones en un servidor que hable el protocolo
+// de Redis. Cada sesión se guarda como JSON con TTL igual a su ExpiresAt, más
+// índices por token, por jti y por usuario:
+//
+//	<prefix>session:<id>          JSON de la sesión
+//	<prefix>session:token:<token> id
+//	<prefix>session:jti:<jti>     id
+//	<prefix>user:<userID>:sessions set de ids
+//
+// Solo se guardan sesiones activas: desactivar una sesión borra sus claves.
+// Las actualizaciones usan SET XX para no recrear una sesión que se borró
+// entre la lectura y la escritura.
+type RedisSessionStore struct {
+	client *resp.Client
+	prefix string
+}
+
+// errSessionExpired se devuelve al crear una sesión cuyo ExpiresAt ya pasó:
+// no se guardaría nada y el token nunca podría autenticar
+var errSessionExpired = errors.New("session already expired")
+
+func NewRedisSessionStore(client *resp.Client, prefix string) *RedisSessionStore {
+	return &RedisSessionStore{client: client, prefix: prefix}
+}
+
+func (r *RedisSessionStore) sessionKey(id uint) string {
+	return r.prefix + "session:" + strconv.FormatUint(uint64(id), 10)
+}
+
+func (r *RedisSessionStore) tokenKey(token string) string {
+	return r.prefix + "session:token:" + token
+}
+
+func (r *RedisSessionStore) jtiKey(jti string) string {
+	return r.prefix + "session:jti:" + jti
+}
+
+func (r *RedisSessionStore) userKey(userID uint) string {
+	return r.prefix + "user:" + strconv.FormatUint(uint64(userID), 10) + ":sessions"
+}
+
+func (r *RedisSessionStore) CreateSession(ctx context.Context, session *models.Session) error {
+	ttl := ttlMillis(session.ExpiresAt)
+	if ttl == "" {
+		return errSessionExpired
+	}
+	id, err := r.client.Int(ctx, "INCR", r.prefix+"session:seq")
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	session.ID = uint(id)
+	session.CreatedAt = now
+	session.UpdatedAt = now
+
+	if err := r.save(ctx, session, false); err != nil {
+		return err
+	}
+	idStr := strconv.FormatUint(uint64(session.ID), 10)
+	if _, err := r.client.Do(ctx, "SET", r.tokenKey(session.Token), idStr, "PX", ttl); err != nil {
+		return err
+	}
+	if session.JTI != "" {
+		if _, err := r.client.Do(ctx, "SET", r.jtiKey(session.JTI), idStr, "PX", ttl); err != nil {
+			return err
+		}
+	}
+	if _, err := r.client.Do(ctx, "SADD", r.userKey(session.UserID), idStr); err != nil {
+		return err
+	}
+	return r.expireUserKey(ctx, session.UserID, session.ExpiresAt)
+}
+
+// save escribe la sesión con TTL hasta ExpiresAt. Con existing sólo la
+// sobrescribe si la clave sigue existiendo; si otra request la borró
+// devuelve ErrSessionNotFound.
+func (r *RedisSessionStore) save(ctx context.Context, session *models.Session, existing bool) error {
+	ttl := ttlMillis(session.ExpiresAt)
+	if ttl == "" {
+		_, err := r.client.Do(ctx, "DEL", r.sessionKey(session.ID))
+		return err
+	}
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	args := []string{"SET", r.sessionKey(session.ID), string(data), "PX", ttl}
+	if existing {
+		args = append(args, "XX")
+	}
+	_, err = r.client.Do(ctx, args...)
+	if errors.Is(err, resp.ErrNil) {
+		return apperrors.ErrSessionNotFound
+	}
+	return err
+}
+
+// expireUserKey estira el TTL del índice del usuario hasta expiresAt si hoy
+// vence antes, para que el set desaparezca junto con su última sesión
+func (r *RedisSessionStore) expireUserKey(ctx context.Context, userID uint, expiresAt time.Time) error {
+	ms := time.Until(expiresAt).Milliseconds()
+	if ms <= 0 {
+		return nil
+	}
+	key := r.userKey(userID)
+	// PTTL devuelve -1 si la clave no tiene TTL y -2 si no existe
+	current, err := r.client.Int(ctx, "PTTL", key)
+	if err != nil {
+		return err
+	}
+	if current == -2 || current >= ms {
+		return nil
+	}
+	_, err = r.client.Do(ctx, "PEXPIRE", key, strconv.FormatInt(ms, 10))
+	return err
+}
+
+func (r *RedisSessionStore) load(ctx context.Context, id uint) (*models.Session, error) {
+	data, err := r.client.String(ctx, "GET", r.sessionKey(id))
+	if err != nil {
+		if errors.Is(err, resp.ErrNil) {
+			return nil, apperrors.ErrSessionNotFound
+		}
+		return nil, err
+	}
+	var session models.Session
+	if err := json.Unmarshal([]byte(data), &session); err != nil {
+		return nil, err
+	}
+	if !session.IsActive || session.IsExpired() {
+		return nil, apperrors.ErrSessionNotFound
+	}
+	return &session, nil
+}
+
+func (r *RedisSessionStore) loadByIndex(ctx context.Context, key string) (*models.Session, error) {
+	idStr, err := r.client.String(ctx, "GET", key)
+	if err != nil {
+		if errors.Is(err, resp.ErrNil) {
+			return nil, apperrors.ErrSessionNotFound
+		}
+		return nil, err
+	}
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return r.load(ctx, uint(id))
+}
+
+func (r *RedisSessionStore) GetActiveSessionByToken(ctx context.Context, token string) (*models.Session, error) {
+	return r.loadByIndex(ctx, r.tokenKey(token))
+}
+
+func (r *RedisSessionStore) GetActiveSessionByJTI(ctx context.Context, jti string) (*models.Session, error) {
+	return r.loadByIndex(ctx, r.jtiKey(jti))
+}
+
+func (r *RedisSessionStore) GetActiveSessionByID(ctx context.Context, id uint) (*models.Session, error) {
+	return r.load(ctx, id)
+}
+
+func (r *RedisSessionStore) GetActiveSessionsByUserID(ctx context.Context, userID uint) ([]models.Session, error) {
+	ids, err := r.client.Strings(ctx, "SMEMBERS", r.userKey(userID))
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []models.Session
+	for _, idStr := range ids {
+		id, err := strconv.ParseUint(idStr, 10, 64)
+		if err != nil {
+			continue
+		}
+		session, err := r.load(ctx, uint(id))
+		if errors.Is(err, apperrors.ErrSessionNotFound) {
+			// La sesión venció por TTL: limpiar el índice del usuario
+			r.client.Do(ctx, "SREM", r.userKey(userID), idStr)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, nil
+}
+
+func (r *RedisSessionStore) DeactivateSession(ctx context.Context, token string) error {
+	session, err := r.GetActiveSessionByToken(ctx, token)
+	if errors.Is(err, apperrors.ErrSessionNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return r.remove(ctx, session)
+}
+
+func (r *RedisSessionStore) remove(ctx context.Context, session *models.Session) error {
+	keys := []string{"DEL", r.sessionKey(session.ID), r.tokenKey(session.Token)}
+	if session.JTI != "" {
+		keys = append(keys, r.jtiKey(session.JTI))
+	}
+	if _, err := r.client.Do(ctx, keys...); err != nil {
+		return err
+	}
+	_, err := r.client.Do(ctx, "SREM", r.userKey(session.UserID), strconv.FormatUint(uint64(session.ID), 10))
+	return err
+}
+
+func (r *RedisSessionStore) DeactivateUserSessionsAndBlacklist(ctx context.Context, userID uint, userRepo UserStore) error {
+	sessions, err := r.GetActiveSessionsByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for i := range sessions {
+		if err := r.remove(ctx, &sessions[i]); err != nil {
+			return err
+		}
+		if err := userRepo.InvalidateToken(ctx, sessions[i].Token, sessions[i].JTI, sessions[i].ExpiresAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *RedisSessionStore) UpdateLastActivity(ctx context.Context, token string) error {
+	session, err := r.GetActiveSessionByToken(ctx, token)
+	if errors.Is(err, apperrors.ErrSessionNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	session.LastActivity = time.Now()
+	err = r.save(ctx, session, true)
+	if errors.Is(err, apperrors.ErrSessionNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (r *RedisSessionStore) UpdateLastActivityBatch(ctx context.Context, ids []uint, at time.Time) error {
+	for _, id := range ids {
+		session, err := r.load(ctx, id)
+		if errors.Is(err, apperrors.ErrSessionNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !session.LastActivity.Before(at) {
+			continue
+		}
+		session.LastActivity = at
+		if err := r.save(ctx, session, true); err != nil && !errors.Is(err, apperrors.ErrSessionNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExtendSession mueve ExpiresAt hacia adelante y renueva el TTL de la sesión
+// y de sus índices
+func (r *RedisSessionStore) ExtendSession(ctx context.Context, id uint, expiresAt time.Time) error {
+	session, err := r.load(ctx, id)
+	if errors.Is(err, apperrors.ErrSessionNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !session.ExpiresAt.Before(expiresAt) {
+		return nil
+	}
+
+	session.ExpiresAt = expiresAt
+	if err := r.save(ctx, session, true); err != nil {
+		if errors.Is(err, apperrors.ErrSessionNotFound) {
+			return nil
+		}
+		return err
+	}
+	ttl := ttlMillis(expiresAt)
+	if _, err := r.client.Do(ctx, "PEXPIRE", r.tokenKey(session.Token), ttl); err != nil {
+		return err
+	}
+	if session.JTI != "" {
+		if _, err := r.client.Do(ctx, "PEXPIRE", r.jtiKey(session.JTI), ttl); err != nil {
+			return err
+		}
+	}
+	return r.expireUserKey(ctx, session.UserID, expiresAt)
+}
+
+// CleanupExpiredSessions no hace nada: Redis borra las sesiones por TTL y los
+// índices por usuario se limpian al leerlos
+func (r *RedisSessionStore) CleanupExpiredSessions(ctx context.Context, limit int) (int64, error) {
+	return 0, nil
+}
+
+// ttlMillis devuelve el TTL en milisegundos hasta expiresAt, o "" si ya venció
+func ttlMillis(expiresAt time.Time) string {
+	ms := time.Until(expiresAt).Milliseconds()
+	if ms <= 0 {
+		return ""
+	}
+	return strconv.FormatInt(ms, 10)
+}
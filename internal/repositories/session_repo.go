@@ -1,6 +1,7 @@
 package repositories
 
 import (
+	"context"
 	"time"
 
 	"github.com/ramiroschettino/jwt-auth-api/internal/models"
@@ -8,37 +9,79 @@ import (
 )
 
 type SessionRepository struct {
-	db *gorm.DB
+	db      *gorm.DB
+	timeout time.Duration
 }
 
 func NewSessionRepository(db *gorm.DB) *SessionRepository {
 	return &SessionRepository{db: db}
 }
 
-func (r *SessionRepository) CreateSession(session *models.Session) error {
-	return r.db.Create(session).Error
+// WithQueryTimeout limita la duración de cada query del repositorio
+func (r *SessionRepository) WithQueryTimeout(timeout time.Duration) *SessionRepository {
+	r.timeout = timeout
+	return r
 }
 
-func (r *SessionRepository) GetActiveSessionByToken(token string) (*models.Session, error) {
+func (r *SessionRepository) CreateSession(ctx context.Context, session *models.Session) error {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+	return db.Create(session).Error
+}
+
+func (r *SessionRepository) GetActiveSessionByToken(ctx context.Context, token string) (*models.Session, error) {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
+	var session models.Session
+	err := db.Where("token = ? AND is_active = ? AND expires_at > ?", token, true, time.Now()).First(&session).Error
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *SessionRepository) GetActiveSessionByJTI(ctx context.Context, jti string) (*models.Session, error) {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
+	var session models.Session
+	err := db.Where("jti = ? AND is_active = ? AND expires_at > ?", jti, true, time.Now()).First(&session).Error
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *SessionRepository) GetActiveSessionByID(ctx context.Context, id uint) (*models.Session, error) {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
 	var session models.Session
-	err := r.db.Where("token = ? AND is_active = ? AND expires_at > ?", token, true, time.Now()).First(&session).Error
+	err := db.Where("id = ? AND is_active = ? AND expires_at > ?", id, true, time.Now()).First(&session).Error
 	if err != nil {
 		return nil, err
 	}
 	return &session, nil
 }
 
-func (r *SessionRepository) GetActiveSessionsByUserID(userID uint) ([]models.Session, error) {
+func (r *SessionRepository) GetActiveSessionsByUserID(ctx context.Context, userID uint) ([]models.Session, error) {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
 	var sessions []models.Session
-	err := r.db.Where("user_id = ? AND is_active = ? AND expires_at > ?", userID, true, time.Now()).Find(&sessions).Error
+	err := db.Where("user_id = ? AND is_active = ? AND expires_at > ?", userID, true, time.Now()).Find(&sessions).Error
 	if err != nil {
 		return nil, err
 	}
 	return sessions, nil
 }
 
-func (r *SessionRepository) DeactivateSession(token string) error {
-	return r.db.Model(&models.Session{}).
+func (r *SessionRepository) DeactivateSession(ctx context.Context, token string) error {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
+	return db.Model(&models.Session{}).
 		Where("token = ?", token).
 		Updates(map[string]interface{}{
 			"is_active":  false,
@@ -46,9 +89,12 @@ func (r *SessionRepository) DeactivateSession(token string) error {
 		}).Error
 }
 
-func (r *SessionRepository) DeactivateUserSessions(userID uint) error {
+func (r *SessionRepository) DeactivateUserSessions(ctx context.Context, userID uint) error {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
 	var sessions []models.Session
-	if err := r.db.Where("user_id = ? AND is_active = ? AND expires_at > ?", userID, true, time.Now()).Find(&sessions).Error; err != nil {
+	if err := db.Where("user_id = ? AND is_active = ? AND expires_at > ?", userID, true, time.Now()).Find(&sessions).Error; err != nil {
 		return err
 	}
 
@@ -56,7 +102,7 @@ func (r *SessionRepository) DeactivateUserSessions(userID uint) error {
 		return nil
 	}
 
-	tx := r.db.Begin()
+	tx := db.Begin()
 	defer func() {
 		if r := recover(); r != nil {
 			tx.Rollback()
@@ -76,6 +122,7 @@ func (r *SessionRepository) DeactivateUserSessions(userID uint) error {
 	for _, session := range sessions {
 		invalidToken := &models.InvalidToken{
 			Token:     session.Token,
+			JTI:       session.JTI,
 			ExpiresAt: session.ExpiresAt,
 			UserID:    userID,
 			Reason:    "new_login",
@@ -90,9 +137,12 @@ func (r *SessionRepository) DeactivateUserSessions(userID uint) error {
 }
 
 // Desactiva todas las sesiones activas y agrega sus tokens a la lista negra
-func (r *SessionRepository) DeactivateUserSessionsAndBlacklist(userID uint, userRepo *UserRepository) error {
+func (r *SessionRepository) DeactivateUserSessionsAndBlacklist(ctx context.Context, userID uint, userRepo UserStore) error {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
 	var sessions []models.Session
-	if err := r.db.Where("user_id = ? AND is_active = ? AND expires_at > ?", userID, true, time.Now()).Find(&sessions).Error; err != nil {
+	if err := db.Where("user_id = ? AND is_active = ? AND expires_at > ?", userID, true, time.Now()).Find(&sessions).Error; err != nil {
 		return err
 	}
 
@@ -100,7 +150,7 @@ func (r *SessionRepository) DeactivateUserSessionsAndBlacklist(userID uint, user
 		return nil
 	}
 
-	tx := r.db.Begin()
+	tx := db.Begin()
 	defer func() {
 		if r := recover(); r != nil {
 			tx.Rollback()
@@ -118,7 +168,7 @@ func (r *SessionRepository) DeactivateUserSessionsAndBlacklist(userID uint, user
 	}
 
 	for _, session := range sessions {
-		if err := userRepo.InvalidateToken(session.Token, session.ExpiresAt); err != nil {
+		if err := userRepo.InvalidateToken(ctx, session.Token, session.JTI, session.ExpiresAt); err != nil {
 			tx.Rollback()
 			return err
 		}
@@ -127,13 +177,45 @@ func (r *SessionRepository) DeactivateUserSessionsAndBlacklist(userID uint, user
 	return tx.Commit().Error
 }
 
-func (r *SessionRepository) UpdateLastActivity(token string) error {
-	return r.db.Model(&models.Session{}).
+func (r *SessionRepository) UpdateLastActivity(ctx context.Context, token string) error {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
+	return db.Model(&models.Session{}).
 		Where("token = ? AND is_active = ?", token, true).
 		Update("last_activity", time.Now()).Error
 }
 
-func (r *SessionRepository) CleanupExpiredSessions() error {
-	return r.db.Where("expires_at < ?", time.Now()).
-		Delete(&models.Session{}).Error
+// UpdateLastActivityBatch actualiza varias sesiones con un único UPDATE, sin
+// retroceder LastActivity si ya había un valor más nuevo
+func (r *SessionRepository) UpdateLastActivityBatch(ctx context.Context, ids []uint, at time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
+	return db.Model(&models.Session{}).
+		Where("id IN ? AND is_active = ? AND last_activity < ?", ids, true, at).
+		Update("last_activity", at).Error
+}
+
+// ExtendSession mueve ExpiresAt hacia adelante; nunca la acorta
+func (r *SessionRepository) ExtendSession(ctx context.Context, id uint, expiresAt time.Time) error {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
+	return db.Model(&models.Session{}).
+		Where("id = ? AND is_active = ? AND expires_at < ?", id, true, expiresAt).
+		Update("expires_at", expiresAt).Error
+}
+
+// CleanupExpiredSessions borra definitivamente hasta limit sesiones vencidas
+// (todas si limit <= 0) y devuelve cuántas borró
+func (r *SessionRepository) CleanupExpiredSessions(ctx context.Context, limit int) (int64, error) {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
+	return deleteExpired(db, &models.Session{}, limit)
 }
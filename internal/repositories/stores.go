@@ -0,0 +1,166 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/ramiroschettino/jwt-auth-api/internal/models"
+)
+
+// Los servicios dependen de estas interfaces y no de los repositorios GORM
+// concretos, para poder usar otras implementaciones (ver el paquete repotest).
+
+// UserStore es el contrato que cumple UserRepository
+type UserStore interface {
+	CreateUser(ctx context.Context, user *models.User) error
+	FindUserByUsername(ctx context.Context, username string) (*models.User, error)
+	FindUserByID(ctx context.Context, id uint) (*models.User, error)
+	FindUserByEmail(ctx context.Context, email string) (*models.User, error)
+	IsUsernameTaken(ctx context.Context, username string) (bool, error)
+	IsEmailTaken(ctx context.Context, email string) (bool, error)
+	// UpdateEmail cambia el email del usuario y lo deja sin verificar
+	UpdateEmail(ctx context.Context, userID uint, email string) error
+	// MarkEmailVerified verifica el email sólo si sigue siendo el del usuario;
+	// ok es false si cambió desde que se envió el link
+	MarkEmailVerified(ctx context.Context, userID uint, email string, at time.Time) (ok bool, err error)
+	UpdatePassword(ctx context.Context, userID uint, passwordHash string) error
+	// HasPasswordHashPrefix indica si algún usuario tiene un hash de
+	// contraseña que empieza con prefix, es decir, de ese algoritmo
+	HasPasswordHashPrefix(ctx context.Context, prefix string) (bool, error)
+	InvalidateToken(ctx context.Context, token, jti string, expiresAt time.Time) error
+	// ConsumeToken es InvalidateToken para tokens de un solo uso: consumed es
+	// false si el token ya estaba en la lista negra
+	ConsumeToken(ctx context.Context, token, jti string, expiresAt time.Time) (consumed bool, err error)
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
+	FindRevokedJTIs(ctx context.Context) ([]string, error)
+	CleanupExpiredTokens(ctx context.Context, limit int) (int64, error)
+	InvalidateUserTokens(ctx context.Context, userID uint) error
+}
+
+// NoteStore es el contrato que cumple NoteRepository
+type NoteStore interface {
+	CreateNote(ctx context.Context, note *models.Note) error
+	FindNotesByUserID(ctx context.Context, userID uint) ([]models.Note, error)
+}
+
+// SessionStore abstrae dónde viven las sesiones. SessionRepository es la
+// implementación sobre la base SQL principal; MemorySessionStore y
+// RedisSessionStore permiten guardarlas en memoria o en un servidor Redis.
+type SessionStore interface {
+	CreateSession(ctx context.Context, session *models.Session) error
+	GetActiveSessionByToken(ctx context.Context, token string) (*models.Session, error)
+	GetActiveSessionByJTI(ctx context.Context, jti string) (*models.Session, error)
+	GetActiveSessionByID(ctx context.Context, id uint) (*models.Session, error)
+	GetActiveSessionsByUserID(ctx context.Context, userID uint) ([]models.Session, error)
+	DeactivateSession(ctx context.Context, token string) error
+	DeactivateUserSessionsAndBlacklist(ctx context.Context, userID uint, userRepo UserStore) error
+	UpdateLastActivity(ctx context.Context, token string) error
+	UpdateLastActivityBatch(ctx context.Context, ids []uint, at time.Time) error
+	ExtendSession(ctx context.Context, id uint, expiresAt time.Time) error
+	CleanupExpiredSessions(ctx context.Context, limit int) (int64, error)
+}
+
+// DeviceStore guarda los dispositivos conocidos de cada usuario
+type DeviceStore interface {
+	// TouchDevice registra el dispositivo o actualiza su último uso; isNew
+	// indica si el usuario no lo tenía registrado
+	TouchDevice(ctx context.Context, device *models.Device) (isNew bool, err error)
+	CountDevices(ctx context.Context, userID uint) (int64, error)
+}
+
+// AuthEventFilter acota una consulta del log de autenticación; los campos
+// vacíos no filtran
+type AuthEventFilter struct {
+	UserID   uint
+	Username string
+	IP       string
+	Type     string
+	Success  *bool
+	Since    time.Time
+	Until    time.Time
+	// BeforeID pagina hacia atrás: sólo eventos con id menor
+	BeforeID uint
+	Limit    int
+}
+
+// AuthEventStore guarda el log persistente de eventos de autenticación
+type AuthEventStore interface {
+	RecordEvent(ctx context.Context, event *models.AuthEvent) error
+	// FindEvents devuelve los eventos más recientes primero
+	FindEvents(ctx context.Context, filter AuthEventFilter) ([]models.AuthEvent, error)
+	CleanupEventsBefore(ctx context.Context, before time.Time, limit int) (int64, error)
+}
+
+// LockoutStore lleva la cuenta de logins fallidos por usuario y por IP
+type LockoutStore interface {
+	// GetFailure devuelve el registro de la clave, o nil si no tiene fallas
+	GetFailure(ctx context.Context, key string) (*models.LoginFailure, error)
+	// RegisterFailure suma una falla de forma atómica y devuelve el total.
+	// Si la última falla es anterior a resetBefore la cuenta vuelve a 1.
+	RegisterFailure(ctx context.Context, key string, at, resetBefore time.Time) (int, error)
+	LockUntil(ctx context.Context, key string, until time.Time) error
+	ResetFailures(ctx context.Context, key string) error
+	CleanupFailuresBefore(ctx context.Context, before time.Time, limit int) (int64, error)
+}
+
+// MFAStore guarda los secretos TOTP y los códigos de recuperación
+type MFAStore interface {
+	// SaveTOTP guarda el secreto, reemplazando el que tuviera el usuario
+	SaveTOTP(ctx context.Context, secret *models.TOTPSecret) error
+	// GetTOTP devuelve el secreto del usuario, o nil si no tiene
+	GetTOTP(ctx context.Context, userID uint) (*models.TOTPSecret, error)
+	ConfirmTOTP(ctx context.Context, userID uint, at time.Time) error
+	// UseTOTPStep registra step como último paso usado si es posterior al
+	// anterior; false indica que el código ya se había usado
+	UseTOTPStep(ctx context.Context, userID uint, step int64) (bool, error)
+	// ReplaceRecoveryCodes descarta los códigos anteriores del usuario
+	ReplaceRecoveryCodes(ctx context.Context, userID uint, hashes []string) error
+	// UseRecoveryCode marca el código como usado; false si no existe o ya
+	// se había usado
+	UseRecoveryCode(ctx context.Context, userID uint, hash string, at time.Time) (bool, error)
+	// CountRecoveryCodes cuenta los códigos sin usar
+	CountRecoveryCodes(ctx context.Context, userID uint) (int, error)
+}
+
+// WebAuthnStore guarda las passkeys de cada usuario
+type WebAuthnStore interface {
+	CreateCredential(ctx context.Context, credential *models.WebAuthnCredential) error
+	FindCredentialsByUser(ctx context.Context, userID uint) ([]models.WebAuthnCredential, error)
+	// UpdateCredentialUse guarda el contador de firmas y las marcas del
+	// último login con la passkey
+	UpdateCredentialUse(ctx context.Context, credential *models.WebAuthnCredential) error
+	// DeleteCredential borra la passkey id del usuario; false si no existe o
+	// es de otro usuario
+	DeleteCredential(ctx context.Context, userID, id uint) (bool, error)
+}
+
+// PasswordResetStore guarda los links de recuperación de contraseña por el
+// hash de su token
+type PasswordResetStore interface {
+	CreateResetToken(ctx context.Context, token *models.PasswordResetToken) error
+	// FindResetToken devuelve el token con ese hash si no venció ni se usó,
+	// sin consumirlo; nil si no hay ninguno válido
+	FindResetToken(ctx context.Context, tokenHash string, at time.Time) (*models.PasswordResetToken, error)
+	// ConsumeResetToken marca como usado el token con ese hash si no venció
+	// ni se usó, de forma atómica; devuelve nil si no hay ninguno válido
+	ConsumeResetToken(ctx context.Context, tokenHash string, at time.Time) (*models.PasswordResetToken, error)
+	// DeleteUserResetTokens invalida todos los links pendientes del usuario
+	DeleteUserResetTokens(ctx context.Context, userID uint) error
+	CleanupExpiredResetTokens(ctx context.Context, limit int) (int64, error)
+}
+
+var (
+	_ UserStore    = (*UserRepository)(nil)
+	_ NoteStore    = (*NoteRepository)(nil)
+	_ SessionStore = (*SessionRepository)(nil)
+	_ SessionStore = (*MemorySessionStore)(nil)
+	_ SessionStore = (*RedisSessionStore)(nil)
+	_ DeviceStore  = (*DeviceRepository)(nil)
+
+	_ AuthEventStore = (*AuthEventRepository)(nil)
+	_ LockoutStore   = (*LockoutRepository)(nil)
+	_ MFAStore       = (*MFARepository)(nil)
+	_ WebAuthnStore  = (*WebAuthnRepository)(nil)
+
+	_ PasswordResetStore = (*PasswordResetRepository)(nil)
+)
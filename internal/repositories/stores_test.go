@@ -0,0 +1,558 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/glebarez/sqlite"
+	"github.com/golang-jwt/jwt/v5"
+	apperrors "github.com/ramiroschettino/jwt-auth-api/internal/errors"
+	"github.com/ramiroschettino/jwt-auth-api/internal/models"
+	"github.com/ramiroschettino/jwt-auth-api/internal/resp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.User{}, &models.Session{}, &models.InvalidToken{}, &models.Device{}, &models.AuthEvent{}, &models.LoginFailure{}, &models.TOTPSecret{}, &models.RecoveryCode{}, &models.WebAuthnCredential{}, &models.PasswordResetToken{}))
+	return db
+}
+
+// Todas las implementaciones de SessionStore deben comportarse igual
+func TestSessionStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) SessionStore{
+		"sql": func(t *testing.T) SessionStore {
+			return NewSessionRepository(newTestDB(t))
+		},
+		"memory": func(t *testing.T) SessionStore {
+			return NewMemorySessionStore()
+		},
+		"redis": func(t *testing.T) SessionStore {
+			srv := miniredis.RunT(t)
+			client := resp.NewClient(resp.Options{Addr: srv.Addr()})
+			t.Cleanup(func() { client.Close() })
+			return NewRedisSessionStore(client, "test:")
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			testSessionStore(t, newStore(t))
+		})
+	}
+}
+
+// Casos propios de Redis: TTL de las claves y escrituras concurrentes con un
+// borrado
+func TestRedisSessionStore(t *testing.T) {
+	ctx := context.Background()
+	srv := miniredis.RunT(t)
+	client := resp.NewClient(resp.Options{Addr: srv.Addr()})
+	t.Cleanup(func() { client.Close() })
+	store := NewRedisSessionStore(client, "test:")
+
+	t.Run("una sesión ya vencida no se crea en silencio", func(t *testing.T) {
+		err := store.CreateSession(ctx, &models.Session{UserID: 1, Token: "vencida", ExpiresAt: time.Now().Add(-time.Minute), IsActive: true})
+		assert.Error(t, err)
+	})
+
+	session := &models.Session{UserID: 1, Token: "t", JTI: "j", LastActivity: time.Now(), ExpiresAt: time.Now().Add(time.Hour), IsActive: true}
+	require.NoError(t, store.CreateSession(ctx, session))
+
+	t.Run("el índice del usuario vence con sus sesiones", func(t *testing.T) {
+		assert.InDelta(t, time.Hour.Seconds(), srv.TTL("test:user:1:sessions").Seconds(), 5)
+
+		require.NoError(t, store.ExtendSession(ctx, session.ID, time.Now().Add(3*time.Hour)))
+		assert.InDelta(t, (3 * time.Hour).Seconds(), srv.TTL("test:user:1:sessions").Seconds(), 5)
+	})
+
+	t.Run("una escritura después del borrado no revive la sesión", func(t *testing.T) {
+		loaded, err := store.GetActiveSessionByID(ctx, session.ID)
+		require.NoError(t, err)
+		require.NoError(t, store.DeactivateSession(ctx, "t"))
+
+		loaded.LastActivity = time.Now()
+		assert.ErrorIs(t, store.save(ctx, loaded, true), apperrors.ErrSessionNotFound)
+		assert.False(t, srv.Exists(store.sessionKey(session.ID)))
+	})
+}
+
+func testSessionStore(t *testing.T, store SessionStore) {
+	ctx := context.Background()
+	newSession := func(userID uint, token string) *models.Session {
+		session := &models.Session{
+			UserID:       userID,
+			Token:        token,
+			JTI:          "jti-" + token,
+			LastActivity: time.Now().Add(-time.Hour),
+			ExpiresAt:    time.Now().Add(time.Hour),
+			UserAgent:    "test-agent",
+			IP:           "127.0.0.1",
+			IsActive:     true,
+		}
+		require.NoError(t, store.CreateSession(ctx, session))
+		require.NotZero(t, session.ID)
+		return session
+	}
+
+	a := newSession(1, "a")
+	b := newSession(1, "b")
+	newSession(2, "c")
+
+	t.Run("búsqueda por token y jti", func(t *testing.T) {
+		got, err := store.GetActiveSessionByToken(ctx, "a")
+		require.NoError(t, err)
+		assert.Equal(t, a.ID, got.ID)
+		assert.Equal(t, "test-agent", got.UserAgent)
+
+		got, err = store.GetActiveSessionByJTI(ctx, "jti-b")
+		require.NoError(t, err)
+		assert.Equal(t, b.ID, got.ID)
+
+		got, err = store.GetActiveSessionByID(ctx, a.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "a", got.Token)
+
+		_, err = store.GetActiveSessionByToken(ctx, "no-existe")
+		assert.Error(t, err)
+	})
+
+	t.Run("sesiones por usuario", func(t *testing.T) {
+		sessions, err := store.GetActiveSessionsByUserID(ctx, 1)
+		require.NoError(t, err)
+		assert.Len(t, sessions, 2)
+	})
+
+	t.Run("actualización de actividad", func(t *testing.T) {
+		at := time.Now().Truncate(time.Second)
+		require.NoError(t, store.UpdateLastActivityBatch(ctx, []uint{a.ID}, at))
+		got, err := store.GetActiveSessionByToken(ctx, "a")
+		require.NoError(t, err)
+		assert.WithinDuration(t, at, got.LastActivity, time.Second)
+
+		// No retrocede
+		require.NoError(t, store.UpdateLastActivityBatch(ctx, []uint{a.ID}, at.Add(-time.Minute)))
+		got, err = store.GetActiveSessionByToken(ctx, "a")
+		require.NoError(t, err)
+		assert.WithinDuration(t, at, got.LastActivity, time.Second)
+
+		require.NoError(t, store.UpdateLastActivity(ctx, "b"))
+		got, err = store.GetActiveSessionByToken(ctx, "b")
+		require.NoError(t, err)
+		assert.WithinDuration(t, time.Now(), got.LastActivity, 5*time.Second)
+	})
+
+	t.Run("extender sesión", func(t *testing.T) {
+		later := time.Now().Add(3 * time.Hour).Truncate(time.Second)
+		require.NoError(t, store.ExtendSession(ctx, b.ID, later))
+		got, err := store.GetActiveSessionByToken(ctx, "b")
+		require.NoError(t, err)
+		assert.WithinDuration(t, later, got.ExpiresAt, time.Second)
+
+		// No acorta
+		require.NoError(t, store.ExtendSession(ctx, b.ID, time.Now().Add(time.Minute)))
+		got, err = store.GetActiveSessionByJTI(ctx, "jti-b")
+		require.NoError(t, err)
+		assert.WithinDuration(t, later, got.ExpiresAt, time.Second)
+	})
+
+	t.Run("desactivar sesión", func(t *testing.T) {
+		require.NoError(t, store.DeactivateSession(ctx, "a"))
+		_, err := store.GetActiveSessionByToken(ctx, "a")
+		assert.Error(t, err)
+		_, err = store.GetActiveSessionByJTI(ctx, "jti-a")
+		assert.Error(t, err)
+
+		sessions, err := store.GetActiveSessionsByUserID(ctx, 1)
+		require.NoError(t, err)
+		assert.Len(t, sessions, 1)
+	})
+
+	t.Run("desactivar todas y agregar a la lista negra", func(t *testing.T) {
+		userRepo := NewUserRepository(newTestDB(t))
+		require.NoError(t, store.DeactivateUserSessionsAndBlacklist(ctx, 1, userRepo))
+
+		sessions, err := store.GetActiveSessionsByUserID(ctx, 1)
+		require.NoError(t, err)
+		assert.Empty(t, sessions)
+		revoked, err := userRepo.IsTokenRevoked(ctx, "jti-b")
+		require.NoError(t, err)
+		assert.True(t, revoked)
+
+		// Las sesiones de otros usuarios no se tocan
+		sessions, err = store.GetActiveSessionsByUserID(ctx, 2)
+		require.NoError(t, err)
+		assert.Len(t, sessions, 1)
+	})
+
+	t.Run("limpieza", func(t *testing.T) {
+		_, err := store.CleanupExpiredSessions(ctx, 10)
+		assert.NoError(t, err)
+
+		// Las sesiones vigentes no se borran
+		sessions, err := store.GetActiveSessionsByUserID(ctx, 2)
+		require.NoError(t, err)
+		assert.Len(t, sessions, 1)
+	})
+}
+
+func TestDeviceRepository(t *testing.T) {
+	ctx := context.Background()
+	repo := NewDeviceRepository(newTestDB(t))
+
+	device := func(userID uint, fingerprint string) *models.Device {
+		return &models.Device{UserID: userID, Fingerprint: fingerprint, UserAgent: "test-agent", LastSeenAt: time.Now()}
+	}
+
+	isNew, err := repo.TouchDevice(ctx, device(1, "a"))
+	require.NoError(t, err)
+	assert.True(t, isNew)
+
+	isNew, err = repo.TouchDevice(ctx, device(1, "a"))
+	require.NoError(t, err)
+	assert.False(t, isNew)
+
+	// La misma huella en otro usuario es otro dispositivo
+	isNew, err = repo.TouchDevice(ctx, device(2, "a"))
+	require.NoError(t, err)
+	assert.True(t, isNew)
+
+	count, err := repo.CountDevices(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestAuthEventRepository(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	repo := NewAuthEventRepository(db)
+
+	userID := uint(7)
+	old := time.Now().Add(-48 * time.Hour)
+	require.NoError(t, repo.RecordEvent(ctx, &models.AuthEvent{CreatedAt: old, UserID: &userID, Username: "u", Type: models.AuthEventLogin, Success: true, IP: "198.51.100.1"}))
+	require.NoError(t, repo.RecordEvent(ctx, &models.AuthEvent{UserID: &userID, Username: "u", Type: models.AuthEventLogin, Reason: "invalid_password", IP: "198.51.100.2"}))
+	require.NoError(t, repo.RecordEvent(ctx, &models.AuthEvent{Username: "ghost", Type: models.AuthEventLogin, Reason: "user_not_found", IP: "198.51.100.2"}))
+
+	events, err := repo.FindEvents(ctx, AuthEventFilter{UserID: userID})
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Greater(t, events[0].ID, events[1].ID)
+
+	failed := false
+	events, err = repo.FindEvents(ctx, AuthEventFilter{IP: "198.51.100.2", Success: &failed})
+	require.NoError(t, err)
+	assert.Len(t, events, 2)
+
+	events, err = repo.FindEvents(ctx, AuthEventFilter{Since: time.Now().Add(-time.Hour), Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "ghost", events[0].Username)
+
+	deleted, err := repo.CleanupEventsBefore(ctx, time.Now().Add(-24*time.Hour), 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+}
+
+func TestLockoutRepository(t *testing.T) {
+	ctx := context.Background()
+	repo := NewLockoutRepository(newTestDB(t))
+	now := time.Now()
+
+	failure, err := repo.GetFailure(ctx, "user:a")
+	require.NoError(t, err)
+	assert.Nil(t, failure)
+
+	for i := 1; i <= 3; i++ {
+		n, err := repo.RegisterFailure(ctx, "user:a", now, now.Add(-time.Minute))
+		require.NoError(t, err)
+		assert.Equal(t, i, n)
+	}
+
+	// Pasada la ventana la cuenta vuelve a empezar
+	n, err := repo.RegisterFailure(ctx, "user:a", now.Add(time.Hour), now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	require.NoError(t, repo.LockUntil(ctx, "user:a", now.Add(2*time.Hour)))
+	failure, err = repo.GetFailure(ctx, "user:a")
+	require.NoError(t, err)
+	require.NotNil(t, failure)
+	assert.WithinDuration(t, now.Add(2*time.Hour), failure.LockedUntil, time.Second)
+
+	// Un bloqueo vigente no se purga
+	deleted, err := repo.CleanupFailuresBefore(ctx, now.Add(90*time.Minute), 10)
+	require.NoError(t, err)
+	assert.Zero(t, deleted)
+
+	require.NoError(t, repo.ResetFailures(ctx, "user:a"))
+	failure, err = repo.GetFailure(ctx, "user:a")
+	require.NoError(t, err)
+	assert.Nil(t, failure)
+}
+
+func TestMFARepository(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMFARepository(newTestDB(t))
+
+	secret, err := repo.GetTOTP(ctx, 1)
+	require.NoError(t, err)
+	assert.Nil(t, secret)
+
+	// Volver a enrolar reemplaza el secreto pendiente
+	require.NoError(t, repo.SaveTOTP(ctx, &models.TOTPSecret{UserID: 1, Secret: "FIRST"}))
+	require.NoError(t, repo.SaveTOTP(ctx, &models.TOTPSecret{UserID: 1, Secret: "SECOND"}))
+	require.NoError(t, repo.ConfirmTOTP(ctx, 1, time.Now()))
+	secret, err = repo.GetTOTP(ctx, 1)
+	require.NoError(t, err)
+	require.NotNil(t, secret)
+	assert.Equal(t, "SECOND", secret.Secret)
+	assert.NotNil(t, secret.ConfirmedAt)
+
+	// Cada paso de tiempo sirve una sola vez y no se puede volver atrás
+	used, err := repo.UseTOTPStep(ctx, 1, 100)
+	require.NoError(t, err)
+	assert.True(t, used)
+	used, err = repo.UseTOTPStep(ctx, 1, 100)
+	require.NoError(t, err)
+	assert.False(t, used)
+	used, err = repo.UseTOTPStep(ctx, 1, 99)
+	require.NoError(t, err)
+	assert.False(t, used)
+
+	require.NoError(t, repo.ReplaceRecoveryCodes(ctx, 1, []string{"a", "b"}))
+	require.NoError(t, repo.ReplaceRecoveryCodes(ctx, 1, []string{"c", "d", "e"}))
+	count, err := repo.CountRecoveryCodes(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	used, err = repo.UseRecoveryCode(ctx, 1, "a", time.Now())
+	require.NoError(t, err)
+	assert.False(t, used, "los códigos reemplazados ya no sirven")
+	used, err = repo.UseRecoveryCode(ctx, 1, "c", time.Now())
+	require.NoError(t, err)
+	assert.True(t, used)
+	used, err = repo.UseRecoveryCode(ctx, 1, "c", time.Now())
+	require.NoError(t, err)
+	assert.False(t, used)
+	used, err = repo.UseRecoveryCode(ctx, 2, "d", time.Now())
+	require.NoError(t, err)
+	assert.False(t, used, "el código es de otro usuario")
+
+	count, err = repo.CountRecoveryCodes(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestWebAuthnRepository(t *testing.T) {
+	ctx := context.Background()
+	repo := NewWebAuthnRepository(newTestDB(t))
+
+	first := &models.WebAuthnCredential{UserID: 1, Name: "laptop", CredentialID: []byte{1, 2, 3}, PublicKey: []byte{9}}
+	require.NoError(t, repo.CreateCredential(ctx, first))
+	require.NoError(t, repo.CreateCredential(ctx, &models.WebAuthnCredential{UserID: 2, Name: "phone", CredentialID: []byte{4, 5, 6}, PublicKey: []byte{9}}))
+	assert.Error(t, repo.CreateCredential(ctx, &models.WebAuthnCredential{UserID: 2, CredentialID: []byte{1, 2, 3}, PublicKey: []byte{9}}),
+		"el id de credencial es único")
+
+	now := time.Now()
+	first.SignCount = 7
+	first.LastUsedAt = &now
+	require.NoError(t, repo.UpdateCredentialUse(ctx, first))
+
+	credentials, err := repo.FindCredentialsByUser(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, credentials, 1)
+	assert.Equal(t, []byte{1, 2, 3}, credentials[0].CredentialID)
+	assert.Equal(t, uint32(7), credentials[0].SignCount)
+	assert.NotNil(t, credentials[0].LastUsedAt)
+
+	deleted, err := repo.DeleteCredential(ctx, 2, first.ID)
+	require.NoError(t, err)
+	assert.False(t, deleted, "la passkey es de otro usuario")
+	deleted, err = repo.DeleteCredential(ctx, 1, first.ID)
+	require.NoError(t, err)
+	assert.True(t, deleted)
+}
+
+func TestUserRepositoryEmail(t *testing.T) {
+	ctx := context.Background()
+	repo := NewUserRepository(newTestDB(t))
+
+	email := "alice@example.com"
+	alice := &models.User{Username: "alice", Password: "x", Role: "user", Email: &email}
+	require.NoError(t, repo.CreateUser(ctx, alice))
+	// Varios usuarios sin email no chocan con el índice único
+	require.NoError(t, repo.CreateUser(ctx, &models.User{Username: "bob", Password: "x", Role: "user"}))
+	require.NoError(t, repo.CreateUser(ctx, &models.User{Username: "carol", Password: "x", Role: "user"}))
+	assert.Error(t, repo.CreateUser(ctx, &models.User{Username: "dave", Password: "x", Role: "user", Email: &email}))
+
+	taken, err := repo.IsEmailTaken(ctx, email)
+	require.NoError(t, err)
+	assert.True(t, taken)
+
+	ok, err := repo.MarkEmailVerified(ctx, alice.ID, "old@example.com", time.Now())
+	require.NoError(t, err)
+	assert.False(t, ok, "el link era para otro email")
+	ok, err = repo.MarkEmailVerified(ctx, alice.ID, email, time.Now())
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// Cambiar el email lo deja sin verificar
+	require.NoError(t, repo.UpdateEmail(ctx, alice.ID, "new@example.com"))
+	user, err := repo.FindUserByID(ctx, alice.ID)
+	require.NoError(t, err)
+	require.NotNil(t, user.Email)
+	assert.Equal(t, "new@example.com", *user.Email)
+	assert.Nil(t, user.EmailVerifiedAt)
+
+	user, err = repo.FindUserByEmail(ctx, "new@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, alice.ID, user.ID)
+	_, err = repo.FindUserByEmail(ctx, email)
+	assert.Error(t, err)
+}
+
+func TestUserRepositoryPasswordHashPrefix(t *testing.T) {
+	ctx := context.Background()
+	repo := NewUserRepository(newTestDB(t))
+	require.NoError(t, repo.CreateUser(ctx, &models.User{Username: "alice", Password: "$argon2id$v=19$m=64,t=1,p=1$c2Fs$aGFzaA", Role: "user"}))
+
+	found, err := repo.HasPasswordHashPrefix(ctx, "$2")
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	require.NoError(t, repo.CreateUser(ctx, &models.User{Username: "bob", Password: "$2a$10$abcdefghijklmnopqrstuv", Role: "user"}))
+	found, err = repo.HasPasswordHashPrefix(ctx, "$2")
+	require.NoError(t, err)
+	assert.True(t, found)
+}
+
+func TestPasswordResetRepository(t *testing.T) {
+	ctx := context.Background()
+	repo := NewPasswordResetRepository(newTestDB(t))
+	now := time.Now()
+
+	require.NoError(t, repo.CreateResetToken(ctx, &models.PasswordResetToken{UserID: 1, TokenHash: "valid", ExpiresAt: now.Add(time.Hour)}))
+	require.NoError(t, repo.CreateResetToken(ctx, &models.PasswordResetToken{UserID: 1, TokenHash: "expired", ExpiresAt: now.Add(-time.Minute)}))
+	require.NoError(t, repo.CreateResetToken(ctx, &models.PasswordResetToken{UserID: 2, TokenHash: "other", ExpiresAt: now.Add(time.Hour)}))
+
+	token, err := repo.FindResetToken(ctx, "valid", now)
+	require.NoError(t, err)
+	require.NotNil(t, token, "buscarlo no lo consume")
+	token, err = repo.FindResetToken(ctx, "expired", now)
+	require.NoError(t, err)
+	assert.Nil(t, token)
+
+	token, err = repo.ConsumeResetToken(ctx, "valid", now)
+	require.NoError(t, err)
+	require.NotNil(t, token)
+	assert.Equal(t, uint(1), token.UserID)
+	assert.NotNil(t, token.UsedAt)
+
+	token, err = repo.ConsumeResetToken(ctx, "valid", now)
+	require.NoError(t, err)
+	assert.Nil(t, token, "el token es de un solo uso")
+	token, err = repo.FindResetToken(ctx, "valid", now)
+	require.NoError(t, err)
+	assert.Nil(t, token)
+	token, err = repo.ConsumeResetToken(ctx, "expired", now)
+	require.NoError(t, err)
+	assert.Nil(t, token)
+	token, err = repo.ConsumeResetToken(ctx, "missing", now)
+	require.NoError(t, err)
+	assert.Nil(t, token)
+
+	deleted, err := repo.CleanupExpiredResetTokens(ctx, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	require.NoError(t, repo.DeleteUserResetTokens(ctx, 2))
+	token, err = repo.ConsumeResetToken(ctx, "other", now)
+	require.NoError(t, err)
+	assert.Nil(t, token)
+}
+
+func TestBackfillJTIs(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	sessions := NewSessionRepository(db)
+	users := NewUserRepository(db)
+
+	signed := func(jti string) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"jti": jti}).SignedString([]byte("secret"))
+		require.NoError(t, err)
+		return token
+	}
+	newSession := func(token string, active bool, expiresAt time.Time) {
+		require.NoError(t, sessions.CreateSession(ctx, &models.Session{
+			UserID:       1,
+			Token:        token,
+			LastActivity: time.Now(),
+			ExpiresAt:    expiresAt,
+			IsActive:     true,
+		}))
+		if !active {
+			require.NoError(t, sessions.DeactivateSession(ctx, token))
+		}
+	}
+
+	// Sesiones y revocaciones de antes de la columna jti
+	newSession(signed("vigente"), true, time.Now().Add(time.Hour))
+	newSession(signed("vencida"), true, time.Now().Add(-time.Hour))
+	newSession(signed("cerrada"), false, time.Now().Add(time.Hour))
+	newSession("no-es-un-jwt", true, time.Now().Add(time.Hour))
+	require.NoError(t, users.InvalidateToken(ctx, signed("revocado"), "", time.Now().Add(time.Hour)))
+
+	n, err := BackfillJTIs(ctx, db)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	session, err := sessions.GetActiveSessionByJTI(ctx, "vigente")
+	require.NoError(t, err)
+	assert.Equal(t, signed("vigente"), session.Token)
+	revoked, err := users.IsTokenRevoked(ctx, "revocado")
+	require.NoError(t, err)
+	assert.True(t, revoked)
+
+	var untouched int64
+	require.NoError(t, db.Model(&models.Session{}).Where("jti = ''").Count(&untouched).Error)
+	assert.Equal(t, int64(3), untouched)
+
+	// Una segunda corrida no tiene nada que hacer
+	n, err = BackfillJTIs(ctx, db)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
+
+func TestUserRepositoryFindUserByIDNotFound(t *testing.T) {
+	repo := NewUserRepository(newTestDB(t))
+
+	// Como en repotest, un id inexistente es ErrUserNotFound y no el error de GORM
+	_, err := repo.FindUserByID(context.Background(), 42)
+	assert.ErrorIs(t, err, apperrors.ErrUserNotFound)
+}
+
+func TestUserRepositoryConsumeToken(t *testing.T) {
+	ctx := context.Background()
+	repo := NewUserRepository(newTestDB(t))
+	expiresAt := time.Now().Add(time.Hour)
+
+	// Sólo el primer uso consume el token; los demás no fallan con la clave
+	// duplicada, avisan que ya estaba usado
+	consumed, err := repo.ConsumeToken(ctx, "token-unico", "unico", expiresAt)
+	require.NoError(t, err)
+	assert.True(t, consumed)
+	consumed, err = repo.ConsumeToken(ctx, "token-unico", "unico", expiresAt)
+	require.NoError(t, err)
+	assert.False(t, consumed)
+
+	// Invalidar dos veces el mismo token no es un error
+	require.NoError(t, repo.InvalidateToken(ctx, "token-unico", "unico", expiresAt))
+	revoked, err := repo.IsTokenRevoked(ctx, "unico")
+	require.NoError(t, err)
+	assert.True(t, revoked)
+}
@@ -1,16 +1,21 @@
 package repositories
 
 import (
+	"context"
+	"errors"
 	"time"
 
+	apperrors "github.com/ramiroschettino/jwt-auth-api/internal/errors"
 	"github.com/ramiroschettino/jwt-auth-api/internal/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // UserRepository maneja el acceso a datos de los usuarios
 // Implementa operaciones CRUD y búsquedas específicas
 type UserRepository struct {
-	db *gorm.DB
+	db      *gorm.DB
+	timeout time.Duration
 }
 
 // NewUserRepository crea una nueva instancia del repositorio de usuarios
@@ -18,51 +23,179 @@ func NewUserRepository(db *gorm.DB) *UserRepository {
 	return &UserRepository{db: db}
 }
 
-func (r *UserRepository) CreateUser(user *models.User) error {
-	return r.db.Create(user).Error
+// WithQueryTimeout limita la duración de cada query del repositorio
+func (r *UserRepository) WithQueryTimeout(timeout time.Duration) *UserRepository {
+	r.timeout = timeout
+	return r
 }
 
-func (r *UserRepository) FindUserByUsername(username string) (*models.User, error) {
+func (r *UserRepository) CreateUser(ctx context.Context, user *models.User) error {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+	return db.Create(user).Error
+}
+
+func (r *UserRepository) FindUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
 	var user models.User
-	err := r.db.Where("username = ?", username).First(&user).Error
+	err := db.Where("username = ?", username).First(&user).Error
 	if err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 
-func (r *UserRepository) IsUsernameTaken(username string) bool {
+func (r *UserRepository) FindUserByID(ctx context.Context, id uint) (*models.User, error) {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
+	var user models.User
+	if err := db.First(&user, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperrors.ErrUserNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *UserRepository) FindUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
+	var user models.User
+	if err := db.Where("email = ?", email).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *UserRepository) IsUsernameTaken(ctx context.Context, username string) (bool, error) {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
+	var count int64
+	err := db.Model(&models.User{}).Where("username = ?", username).Count(&count).Error
+	return count > 0, err
+}
+
+func (r *UserRepository) IsEmailTaken(ctx context.Context, email string) (bool, error) {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
 	var count int64
-	r.db.Model(&models.User{}).Where("username = ?", username).Count(&count)
-	return count > 0
+	err := db.Model(&models.User{}).Where("email = ?", email).Count(&count).Error
+	return count > 0, err
+}
+
+func (r *UserRepository) HasPasswordHashPrefix(ctx context.Context, prefix string) (bool, error) {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
+	var ids []uint
+	err := db.Model(&models.User{}).Where("password LIKE ?", prefix+"%").Limit(1).Pluck("id", &ids).Error
+	return len(ids) > 0, err
 }
 
-func (r *UserRepository) InvalidateToken(token string, expiresAt time.Time) error {
-	return r.db.Create(&models.InvalidToken{
+func (r *UserRepository) UpdateEmail(ctx context.Context, userID uint, email string) error {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
+	return db.Model(&models.User{}).
+		Where("id = ?", userID).
+		Updates(map[string]interface{}{
+			"email":             email,
+			"email_verified_at": nil,
+		}).Error
+}
+
+func (r *UserRepository) MarkEmailVerified(ctx context.Context, userID uint, email string, at time.Time) (bool, error) {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
+	result := db.Model(&models.User{}).
+		Where("id = ? AND email = ?", userID, email).
+		Update("email_verified_at", at)
+	return result.RowsAffected == 1, result.Error
+}
+
+func (r *UserRepository) UpdatePassword(ctx context.Context, userID uint, passwordHash string) error {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
+	return db.Model(&models.User{}).Where("id = ?", userID).Update("password", passwordHash).Error
+}
+
+// InvalidateToken agrega el token a la lista negra; si ya estaba no hace nada
+func (r *UserRepository) InvalidateToken(ctx context.Context, token, jti string, expiresAt time.Time) error {
+	_, err := r.ConsumeToken(ctx, token, jti, expiresAt)
+	return err
+}
+
+// ConsumeToken agrega el token a la lista negra e indica si lo agregó esta
+// llamada. Con dos usos simultáneos del mismo token sólo uno recibe true.
+func (r *UserRepository) ConsumeToken(ctx context.Context, token, jti string, expiresAt time.Time) (bool, error) {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.InvalidToken{
 		Token:     token,
+		JTI:       jti,
 		ExpiresAt: expiresAt,
-	}).Error
+	})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
 }
 
-func (r *UserRepository) IsTokenInvalid(token string) bool {
+// IsTokenRevoked indica si el jti del token figura en la lista negra
+func (r *UserRepository) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
 	var count int64
-	r.db.Model(&models.InvalidToken{}).
-		Where("token = ? AND expires_at > ?", token, time.Now()).
-		Count(&count)
-	return count > 0
+	err := db.Model(&models.InvalidToken{}).
+		Where("jti = ? AND expires_at > ?", jti, time.Now()).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// FindRevokedJTIs devuelve los jti de todos los tokens revocados que aún no vencieron
+func (r *UserRepository) FindRevokedJTIs(ctx context.Context) ([]string, error) {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
+	var jtis []string
+	err := db.Model(&models.InvalidToken{}).
+		Where("jti <> '' AND expires_at > ?", time.Now()).
+		Pluck("jti", &jtis).Error
+	if err != nil {
+		return nil, err
+	}
+	return jtis, nil
 }
 
-func (r *UserRepository) CleanupExpiredTokens() error {
-	return r.db.Where("expires_at < ?", time.Now()).
-		Delete(&models.InvalidToken{}).Error
+// CleanupExpiredTokens borra definitivamente hasta limit tokens vencidos de la
+// lista negra (todos si limit <= 0) y devuelve cuántos borró
+func (r *UserRepository) CleanupExpiredTokens(ctx context.Context, limit int) (int64, error) {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
+	return deleteExpired(db, &models.InvalidToken{}, limit)
 }
 
-func (r *UserRepository) InvalidateUserTokens(userID uint) error {
-	if err := r.CleanupExpiredTokens(); err != nil {
+func (r *UserRepository) InvalidateUserTokens(ctx context.Context, userID uint) error {
+	if _, err := r.CleanupExpiredTokens(ctx, 0); err != nil {
 		return err
 	}
 
-	return r.db.Model(&models.InvalidToken{}).
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
+	return db.Model(&models.InvalidToken{}).
 		Where("user_id = ? AND expires_at > ?", userID, time.Now()).
 		Updates(map[string]interface{}{
 			"expires_at": time.Now(),
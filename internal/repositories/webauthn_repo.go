@@ -0,0 +1,62 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/ramiroschettino/jwt-auth-api/internal/models"
+	"gorm.io/gorm"
+)
+
+type WebAuthnRepository struct {
+	db      *gorm.DB
+	timeout time.Duration
+}
+
+func NewWebAuthnRepository(db *gorm.DB) *WebAuthnRepository {
+	return &WebAuthnRepository{db: db}
+}
+
+// WithQueryTimeout limita la duración de cada query del repositorio
+func (r *WebAuthnRepository) WithQueryTimeout(timeout time.Duration) *WebAuthnRepository {
+	r.timeout = timeout
+	return r
+}
+
+func (r *WebAuthnRepository) CreateCredential(ctx context.Context, credential *models.WebAuthnCredential) error {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+	return db.Create(credential).Error
+}
+
+func (r *WebAuthnRepository) FindCredentialsByUser(ctx context.Context, userID uint) ([]models.WebAuthnCredential, error) {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
+	var credentials []models.WebAuthnCredential
+	err := db.Where("user_id = ?", userID).Order("id").Find(&credentials).Error
+	return credentials, err
+}
+
+func (r *WebAuthnRepository) UpdateCredentialUse(ctx context.Context, credential *models.WebAuthnCredential) error {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
+	return db.Model(&models.WebAuthnCredential{}).
+		Where("id = ?", credential.ID).
+		Updates(map[string]interface{}{
+			"sign_count":    credential.SignCount,
+			"clone_warning": credential.CloneWarning,
+			"user_verified": credential.UserVerified,
+			"backup_state":  credential.BackupState,
+			"last_used_at":  credential.LastUsedAt,
+		}).Error
+}
+
+func (r *WebAuthnRepository) DeleteCredential(ctx context.Context, userID, id uint) (bool, error) {
+	db, cancel := withContext(ctx, r.db, r.timeout)
+	defer cancel()
+
+	result := db.Where("id = ? AND user_id = ?", id, userID).Delete(&models.WebAuthnCredential{})
+	return result.RowsAffected == 1, result.Error
+}
@@ -0,0 +1,319 @@
+// Package resp implementa un cliente mínimo del protocolo de Redis (RESP2),
+// suficiente para los comandos que usa RedisSessionStore.
+package resp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrNil se devuelve cuando el servidor responde con un valor nulo
+var ErrNil = errors.New("resp: nil reply")
+
+// Error es un error devuelto por el servidor (respuesta "-ERR ...")
+type Error string
+
+func (e Error) Error() string { return string(e) }
+
+type Options struct {
+	Addr     string
+	Password string
+	DB       int
+	// Timeout acota cada comando (conexión, escritura y respuesta)
+	Timeout time.Duration
+	// PoolSize es la cantidad máxima de conexiones abiertas a la vez
+	PoolSize int
+}
+
+// Client reparte los comandos entre un pool de conexiones, así una respuesta
+// lenta sólo ocupa la suya. Una conexión que falla se descarta y la próxima
+// se abre cuando haga falta.
+type Client struct {
+	opts Options
+	// slots limita las conexiones en uso a PoolSize
+	slots chan struct{}
+
+	mu     sync.Mutex
+	idle   []*conn
+	closed bool
+}
+
+type conn struct {
+	net.Conn
+	rd *bufio.Reader
+}
+
+func NewClient(opts Options) *Client {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	if opts.PoolSize <= 0 {
+		opts.PoolSize = 10
+	}
+	return &Client{opts: opts, slots: make(chan struct{}, opts.PoolSize)}
+}
+
+// Do envía un comando y devuelve la respuesta como string, int64,
+// []interface{} o nil. El plazo de ctx, si es menor que Timeout, acota tanto
+// la espera de una conexión libre como la de la respuesta.
+func (c *Client) Do(ctx context.Context, args ...string) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(c.opts.Timeout)
+	ctxDeadline := false
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+		ctxDeadline = true
+	}
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	select {
+	case c.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timer.C:
+		return nil, fmt.Errorf("resp: no hay conexiones libres: %w", context.DeadlineExceeded)
+	}
+	defer func() { <-c.slots }()
+
+	cn, err := c.get(deadline)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := cn.roundTrip(deadline, args)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			cn.Close()
+			return nil, ctxErr
+		}
+		// El socket puede vencer un instante antes que ctx
+		var netErr net.Error
+		if ctxDeadline && errors.As(err, &netErr) && netErr.Timeout() {
+			cn.Close()
+			return nil, context.DeadlineExceeded
+		}
+		var serverErr Error
+		if !errors.As(err, &serverErr) && !errors.Is(err, ErrNil) {
+			cn.Close()
+			return nil, err
+		}
+	}
+	c.put(cn)
+	return reply, err
+}
+
+// get devuelve una conexión libre o abre una nueva
+func (c *Client) get(deadline time.Time) (*conn, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, errors.New("resp: cliente cerrado")
+	}
+	if n := len(c.idle); n > 0 {
+		cn := c.idle[n-1]
+		c.idle = c.idle[:n-1]
+		c.mu.Unlock()
+		return cn, nil
+	}
+	c.mu.Unlock()
+	return c.connect(deadline)
+}
+
+func (c *Client) put(cn *conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		cn.Close()
+		return
+	}
+	c.idle = append(c.idle, cn)
+}
+
+func (c *Client) connect(deadline time.Time) (*conn, error) {
+	dialer := net.Dialer{Deadline: deadline}
+	nc, err := dialer.Dial("tcp", c.opts.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("resp: error al conectar a %s: %w", c.opts.Addr, err)
+	}
+	cn := &conn{Conn: nc, rd: bufio.NewReader(nc)}
+
+	if c.opts.Password != "" {
+		if _, err := cn.roundTrip(deadline, []string{"AUTH", c.opts.Password}); err != nil {
+			cn.Close()
+			return nil, err
+		}
+	}
+	if c.opts.DB != 0 {
+		if _, err := cn.roundTrip(deadline, []string{"SELECT", strconv.Itoa(c.opts.DB)}); err != nil {
+			cn.Close()
+			return nil, err
+		}
+	}
+	return cn, nil
+}
+
+func (cn *conn) roundTrip(deadline time.Time, args []string) (interface{}, error) {
+	cn.SetDeadline(deadline)
+
+	buf := make([]byte, 0, 64)
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, '\r', '\n')
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, arg...)
+		buf = append(buf, '\r', '\n')
+	}
+	if _, err := cn.Write(buf); err != nil {
+		return nil, err
+	}
+	return cn.readReply()
+}
+
+func (cn *conn) readReply() (interface{}, error) {
+	line, err := cn.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errors.New("resp: respuesta vacía")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, Error(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, ErrNil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(cn.rd, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, ErrNil
+		}
+		// Un error del servidor dentro del array (por ejemplo en EXEC) no
+		// corta la lectura: el resto de los elementos tiene que salir de la
+		// conexión o el próximo comando leería una respuesta ajena
+		items := make([]interface{}, n)
+		var itemErr error
+		for i := range items {
+			item, err := cn.readReply()
+			if err != nil && !errors.Is(err, ErrNil) {
+				var serverErr Error
+				if !errors.As(err, &serverErr) {
+					return nil, err
+				}
+				if itemErr == nil {
+					itemErr = err
+				}
+				continue
+			}
+			items[i] = item
+		}
+		if itemErr != nil {
+			return nil, itemErr
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("resp: tipo de respuesta desconocido %q", line[0])
+	}
+}
+
+func (cn *conn) readLine() (string, error) {
+	line, err := cn.rd.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", errors.New("resp: línea mal formada")
+	}
+	return line[:len(line)-2], nil
+}
+
+// Close cierra las conexiones libres; las que están en uso se cierran al
+// terminar su comando
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	for _, cn := range c.idle {
+		cn.Close()
+	}
+	c.idle = nil
+	return nil
+}
+
+// String ejecuta un comando cuya respuesta es un bulk string
+func (c *Client) String(ctx context.Context, args ...string) (string, error) {
+	reply, err := c.Do(ctx, args...)
+	if err != nil {
+		return "", err
+	}
+	s, ok := reply.(string)
+	if !ok {
+		return "", fmt.Errorf("resp: se esperaba string y llegó %T", reply)
+	}
+	return s, nil
+}
+
+// Int ejecuta un comando cuya respuesta es un entero
+func (c *Client) Int(ctx context.Context, args ...string) (int64, error) {
+	reply, err := c.Do(ctx, args...)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("resp: se esperaba entero y llegó %T", reply)
+	}
+	return n, nil
+}
+
+// Strings ejecuta un comando cuya respuesta es un array de bulk strings;
+// los elementos nulos se devuelven como ""
+func (c *Client) Strings(ctx context.Context, args ...string) ([]string, error) {
+	reply, err := c.Do(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	items, ok := reply.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("resp: se esperaba array y llegó %T", reply)
+	}
+	out := make([]string, len(items))
+	for i, item := range items {
+		if s, ok := item.(string); ok {
+			out[i] = s
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,96 @@
+package resp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientNestedError(t *testing.T) {
+	ctx := context.Background()
+	srv := miniredis.RunT(t)
+	// Con una sola conexión MULTI, los comandos y EXEC van por el mismo socket
+	client := NewClient(Options{Addr: srv.Addr(), PoolSize: 1})
+	t.Cleanup(func() { client.Close() })
+
+	require.NoError(t, srv.Set("texto", "hola"))
+
+	// EXEC devuelve un array con el error de INCR en el medio
+	_, err := client.Do(ctx, "MULTI")
+	require.NoError(t, err)
+	_, err = client.Do(ctx, "INCR", "texto")
+	require.NoError(t, err)
+	_, err = client.Do(ctx, "SET", "otra", "valor")
+	require.NoError(t, err)
+	_, err = client.Do(ctx, "EXEC")
+	var serverErr Error
+	assert.ErrorAs(t, err, &serverErr)
+
+	// La conexión sigue alineada: cada comando recibe su propia respuesta
+	got, err := client.String(ctx, "GET", "otra")
+	require.NoError(t, err)
+	assert.Equal(t, "valor", got)
+	n, err := client.Int(ctx, "INCR", "contador")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+}
+
+func TestClientSlowReply(t *testing.T) {
+	ctx := context.Background()
+	srv := miniredis.RunT(t)
+	client := NewClient(Options{Addr: srv.Addr(), PoolSize: 2})
+	t.Cleanup(func() { client.Close() })
+
+	// BLPOP sobre una lista vacía no responde: el plazo de ctx lo corta
+	blocked := make(chan error, 1)
+	go func() {
+		slowCtx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+		defer cancel()
+		_, err := client.Do(slowCtx, "BLPOP", "cola", "0")
+		blocked <- err
+	}()
+
+	// Mientras tanto los demás comandos usan otra conexión
+	time.Sleep(50 * time.Millisecond)
+	start := time.Now()
+	n, err := client.Int(ctx, "INCR", "contador")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	assert.Less(t, time.Since(start), 250*time.Millisecond)
+
+	select {
+	case err := <-blocked:
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	case <-time.After(5 * time.Second):
+		t.Fatal("el comando colgado no respetó el plazo de ctx")
+	}
+
+	// La conexión colgada se descartó y el cliente sigue funcionando
+	n, err = client.Int(ctx, "INCR", "contador")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+}
+
+func TestClientPoolExhausted(t *testing.T) {
+	ctx := context.Background()
+	srv := miniredis.RunT(t)
+	client := NewClient(Options{Addr: srv.Addr(), PoolSize: 1})
+	t.Cleanup(func() { client.Close() })
+
+	go func() {
+		slowCtx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+		client.Do(slowCtx, "BLPOP", "cola", "0")
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// Sin conexiones libres se espera sólo hasta el plazo propio
+	waitCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	_, err := client.Do(waitCtx, "PING")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	apperrors "github.com/ramiroschettino/jwt-auth-api/internal/errors"
+	"github.com/ramiroschettino/jwt-auth-api/internal/models"
+	"github.com/ramiroschettino/jwt-auth-api/internal/repositories"
+)
+
+// Métodos de login que se registran en el log de eventos
+const (
+	LoginMethodPassword = "password"
+	LoginMethodPasskey  = "passkey"
+	// LoginMethodMagicLink es el login por link enviado por email
+	LoginMethodMagicLink = "magic_link"
+)
+
+// Motivos de falla registrados en el log de eventos
+const (
+	ReasonUserNotFound        = "user_not_found"
+	ReasonInvalidPassword     = "invalid_password"
+	ReasonAccountLocked       = "account_locked"
+	ReasonMFARequired         = "mfa_required"
+	ReasonInvalidMFACode      = "invalid_mfa_code"
+	ReasonInvalidMFAChallenge = "invalid_mfa_challenge"
+	ReasonInvalidPasskey      = "invalid_passkey"
+	ReasonInvalidMagicLink    = "invalid_magic_link"
+	ReasonEmailNotVerified    = "email_not_verified"
+	ReasonSessionLimitReached = "session_limit_reached"
+	ReasonSessionNotFound     = "session_not_found"
+	ReasonCanceled            = "canceled"
+	ReasonError               = "error"
+)
+
+// loginAttempt junta lo que se sabe de un intento de login a medida que
+// avanza, para registrarlo al final sea cual sea el resultado
+type loginAttempt struct {
+	username  string
+	userAgent string
+	ip        string
+	method    string
+	mfa       bool
+
+	user    *models.User
+	session *models.Session
+}
+
+// WithEventLog hace que cada login y logout quede registrado en store
+func (s *AuthService) WithEventLog(store repositories.AuthEventStore) *AuthService {
+	s.events = store
+	return s
+}
+
+// LoginHistory devuelve los intentos de login del usuario, más recientes
+// primero. beforeID pagina hacia atrás (0 = desde el último).
+func (s *AuthService) LoginHistory(ctx context.Context, userID, beforeID uint, limit int) ([]models.AuthEvent, error) {
+	return s.QueryAuthEvents(ctx, repositories.AuthEventFilter{
+		UserID:   userID,
+		Type:     models.AuthEventLogin,
+		BeforeID: beforeID,
+		Limit:    limit,
+	})
+}
+
+// QueryAuthEvents consulta el log de eventos con un filtro arbitrario
+func (s *AuthService) QueryAuthEvents(ctx context.Context, filter repositories.AuthEventFilter) ([]models.AuthEvent, error) {
+	if s.events == nil {
+		return []models.AuthEvent{}, nil
+	}
+	return s.events.FindEvents(ctx, filter)
+}
+
+func (s *AuthService) recordLogin(ctx context.Context, attempt *loginAttempt, err error) {
+	event := &models.AuthEvent{
+		Username:  attempt.username,
+		Type:      models.AuthEventLogin,
+		Success:   err == nil,
+		Reason:    failureReason(err),
+		Method:    attempt.method,
+		MFA:       attempt.mfa,
+		IP:        attempt.ip,
+		UserAgent: attempt.userAgent,
+	}
+	if attempt.user != nil {
+		event.UserID = &attempt.user.ID
+		event.Username = attempt.user.Username
+	}
+	if attempt.session != nil {
+		event.SessionID = &attempt.session.ID
+	}
+	s.locateEvent(event)
+	s.recordEvent(ctx, event)
+}
+
+func (s *AuthService) recordLogout(ctx context.Context, session *models.Session, username string) {
+	s.recordEvent(ctx, &models.AuthEvent{
+		UserID:    &session.UserID,
+		Username:  username,
+		Type:      models.AuthEventLogout,
+		Success:   true,
+		SessionID: &session.ID,
+		IP:        session.IP,
+		UserAgent: session.UserAgent,
+		Country:   session.Country,
+		City:      session.City,
+		ASN:       session.ASN,
+	})
+}
+
+// recordEvent guarda el evento aunque el request se haya cancelado, para no
+// perder justamente los intentos cortados; un error sólo se registra en el log
+func (s *AuthService) recordEvent(ctx context.Context, event *models.AuthEvent) {
+	if s.events == nil {
+		return
+	}
+	if err := s.events.RecordEvent(context.WithoutCancel(ctx), event); err != nil {
+		log.Printf("Error al registrar el evento de autenticación %s de %q: %v", event.Type, event.Username, err)
+	}
+}
+
+func failureReason(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, apperrors.ErrUserNotFound):
+		return ReasonUserNotFound
+	case errors.Is(err, apperrors.ErrInvalidPassword):
+		return ReasonInvalidPassword
+	case errors.Is(err, apperrors.ErrAccountLocked):
+		return ReasonAccountLocked
+	case errors.Is(err, apperrors.ErrMFARequired):
+		return ReasonMFARequired
+	case errors.Is(err, apperrors.ErrInvalidMFACode):
+		return ReasonInvalidMFACode
+	case errors.Is(err, apperrors.ErrMFAChallengeInvalid):
+		return ReasonInvalidMFAChallenge
+	case errors.Is(err, apperrors.ErrPasskeyInvalid):
+		return ReasonInvalidPasskey
+	case errors.Is(err, apperrors.ErrMagicLinkInvalid):
+		return ReasonInvalidMagicLink
+	case errors.Is(err, apperrors.ErrEmailNotVerified):
+		return ReasonEmailNotVerified
+	case errors.Is(err, apperrors.ErrSessionLimitReached):
+		return ReasonSessionLimitReached
+	case errors.Is(err, apperrors.ErrSessionNotFound):
+		return ReasonSessionNotFound
+	case apperrors.IsContextError(err):
+		return ReasonCanceled
+	default:
+		return ReasonError
+	}
+}
@@ -1,30 +1,80 @@
 package services
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/ramiroschettino/jwt-auth-api/internal/activity"
+	"github.com/ramiroschettino/jwt-auth-api/internal/cache"
 	"github.com/ramiroschettino/jwt-auth-api/internal/config"
+	"github.com/ramiroschettino/jwt-auth-api/internal/devices"
 	apperrors "github.com/ramiroschettino/jwt-auth-api/internal/errors"
+	"github.com/ramiroschettino/jwt-auth-api/internal/geoip"
 	"github.com/ramiroschettino/jwt-auth-api/internal/models"
 	"github.com/ramiroschettino/jwt-auth-api/internal/repositories"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // AuthService gestiona la autenticación y sesiones de usuarios
 type AuthService struct {
-	userRepo    *repositories.UserRepository
-	sessionRepo *repositories.SessionRepository
+	userRepo    repositories.UserStore
+	sessionRepo repositories.SessionStore
+	revocations *cache.RevocationCache
+	activity    *activity.Aggregator
 	Cfg         *config.Config
+
+	devices        repositories.DeviceStore
+	deviceNotifier devices.Notifier
+
+	events repositories.AuthEventStore
+
+	lockouts      repositories.LockoutStore
+	lockoutPolicy LockoutPolicy
+
+	geo            geoip.Locator
+	travelMaxSpeed float64
+	travelHook     TravelHook
+
+	safeRegistration     bool
+	registrationNotifier RegistrationNotifier
+
+	mfa       repositories.MFAStore
+	mfaPolicy MFAPolicy
+
+	webauthn *webauthn.WebAuthn
+	passkeys repositories.WebAuthnStore
+
+	emailVerification *EmailVerification
+
+	passwordResets repositories.PasswordResetStore
+	passwordReset  *PasswordReset
+	passwordPolicy *PasswordPolicy
+	magicLink      *MagicLink
+	// mailTasks son los envíos de correo que corren fuera del request
+	mailTasks sync.WaitGroup
+
+	hasher        PasswordHasher
+	dummyHashOnce sync.Once
+	dummyHash     string
 }
 
-// Límite de sesiones simultáneas por usuario
-const maxSessionsPerUser = 5
+// LoginOptions agrupa datos opcionales del intento de login
+type LoginOptions struct {
+	// TerminateSessionID cierra esa sesión del usuario antes de crear la
+	// nueva; es la respuesta a un SessionLimitError con SessionPolicyChoose
+	TerminateSessionID uint
+	// DeviceID es un identificador de dispositivo opcional enviado por el
+	// cliente; si falta, el dispositivo se reconoce por User-Agent y red
+	DeviceID string
+}
 
-func NewAuthService(userRepo *repositories.UserRepository, sessionRepo *repositories.SessionRepository, cfg *config.Config) *AuthService {
+func NewAuthService(userRepo repositories.UserStore, sessionRepo repositories.SessionStore, cfg *config.Config) *AuthService {
 	return &AuthService{
 		userRepo:    userRepo,
 		sessionRepo: sessionRepo,
@@ -32,157 +82,508 @@ func NewAuthService(userRepo *repositories.UserRepository, sessionRepo *reposito
 	}
 }
 
-func (s *AuthService) Register(username, password, role string) (*models.User, error) {
-	if s.userRepo.IsUsernameTaken(username) {
+// WithRevocationCache hace que ValidateToken consulte primero la caché en
+// memoria antes de ir a la base
+func (s *AuthService) WithRevocationCache(rc *cache.RevocationCache) *AuthService {
+	s.revocations = rc
+	return s
+}
+
+// WithActivityAggregator hace que la última actividad de las sesiones se
+// acumule en memoria y se escriba en lote en lugar de en cada request
+func (s *AuthService) WithActivityAggregator(agg *activity.Aggregator) *AuthService {
+	s.activity = agg
+	return s
+}
+
+func (s *AuthService) Register(ctx context.Context, username, password, role string) (*models.User, error) {
+	return s.RegisterWithEmail(ctx, username, password, role, "")
+}
+
+// RegisterWithEmail registra al usuario con un email opcional (obligatorio
+// si la política de verificación no es off) y le envía el link para
+// verificarlo
+func (s *AuthService) RegisterWithEmail(ctx context.Context, username, password, role, email string) (*models.User, error) {
+	if err := s.checkPassword(ctx, username, password); err != nil {
+		return nil, err
+	}
+
+	var emailAddr *string
+	if email != "" || s.emailPolicy() != EmailPolicyOff {
+		normalized, err := normalizeEmail(email)
+		if err != nil {
+			return nil, err
+		}
+		emailAddr = &normalized
+	}
+
+	taken, err := s.userRepo.IsUsernameTaken(ctx, username)
+	if err != nil {
+		return nil, apperrors.WrapError(err, "failed to check username")
+	}
+	if taken {
+		if s.safeRegistration {
+			s.registrationTaken(ctx, username, password)
+			return nil, nil
+		}
 		return nil, apperrors.ErrUserExists
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if emailAddr != nil {
+		taken, err := s.userRepo.IsEmailTaken(ctx, *emailAddr)
+		if err != nil {
+			return nil, apperrors.WrapError(err, "failed to check email")
+		}
+		if taken {
+			if s.safeRegistration {
+				// Mismo costo que un alta real, como en registrationTaken
+				s.passwordHasher().Hash(password)
+				return nil, nil
+			}
+			return nil, apperrors.ErrEmailTaken
+		}
+	}
+
+	hashedPassword, err := s.passwordHasher().Hash(password)
 	if err != nil {
 		return nil, apperrors.WrapError(err, "failed to hash password")
 	}
 
 	user := &models.User{
 		Username: username,
-		Password: string(hashedPassword),
+		Password: hashedPassword,
 		Role:     role,
+		Email:    emailAddr,
 	}
 
-	if err := s.userRepo.CreateUser(user); err != nil {
+	if err := s.userRepo.CreateUser(ctx, user); err != nil {
 		return nil, apperrors.WrapError(err, "failed to create user")
 	}
+	s.sendRegistrationEmail(ctx, user)
 	return user, nil
 }
 
-func (s *AuthService) Login(username, password string, userAgent, ip string) (string, error) {
-	user, err := s.userRepo.FindUserByUsername(username)
+func (s *AuthService) Login(ctx context.Context, username, password string, userAgent, ip string) (string, error) {
+	return s.LoginWithOptions(ctx, username, password, userAgent, ip, LoginOptions{})
+}
+
+func (s *AuthService) LoginWithOptions(ctx context.Context, username, password string, userAgent, ip string, opts LoginOptions) (string, error) {
+	attempt := &loginAttempt{
+		username:  username,
+		userAgent: userAgent,
+		ip:        ip,
+		method:    LoginMethodPassword,
+	}
+	token, err := s.passwordLogin(ctx, attempt, password, opts)
+	s.recordLogin(ctx, attempt, err)
+	return token, publicLoginError(err)
+}
+
+func (s *AuthService) passwordLogin(ctx context.Context, attempt *loginAttempt, password string, opts LoginOptions) (string, error) {
+	if err := s.checkLockout(ctx, attempt.username, attempt.ip); err != nil {
+		return "", err
+	}
+
+	user, err := s.userRepo.FindUserByUsername(ctx, attempt.username)
 	if err != nil {
+		if apperrors.IsContextError(err) {
+			return "", err
+		}
+		s.equalizeTiming(ctx, password)
+		s.registerFailure(ctx, attempt.username, attempt.ip)
 		return "", apperrors.ErrUserNotFound
 	}
+	attempt.user = user
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+	if !s.verifyPassword(user, password) {
+		s.registerFailure(ctx, attempt.username, attempt.ip)
 		return "", apperrors.ErrInvalidPassword
 	}
+	s.clearFailures(ctx, attempt.username)
+	s.rehashPassword(ctx, user, password)
+
+	if err := s.checkLoginEmail(user); err != nil {
+		return "", err
+	}
+	if err := s.requireSecondFactor(ctx, user); err != nil {
+		return "", err
+	}
+
+	return s.createSession(ctx, attempt, opts)
+}
+
+// createSession abre una sesión para el usuario ya autenticado del intento:
+// aplica el límite de sesiones, emite el JWT y registra dispositivo y
+// ubicación. Es el paso común a todos los métodos de login.
+func (s *AuthService) createSession(ctx context.Context, attempt *loginAttempt, opts LoginOptions) (string, error) {
+	user := attempt.user
+	userAgent, ip := attempt.userAgent, attempt.ip
+
+	previous := s.previousLogin(ctx, user.ID)
 
 	// Controlar límite de sesiones activas
-	activeSessions, err := s.sessionRepo.GetActiveSessionsByUserID(user.ID)
-	if err != nil {
-		return "", fmt.Errorf("error al obtener sesiones activas: %w", err)
-	}
-	if len(activeSessions) >= maxSessionsPerUser {
-		// Desactivar la sesión más antigua
-		oldest := activeSessions[0]
-		for _, sess := range activeSessions {
-			if sess.CreatedAt.Before(oldest.CreatedAt) {
-				oldest = sess
-			}
+	if err := s.enforceSessionLimit(ctx, user, opts.TerminateSessionID); err != nil {
+		return "", err
+	}
+
+	// Con renovación deslizante el JWT dura toda la vida máxima de la sesión
+	// y es ExpiresAt de la sesión lo que se va extendiendo con la actividad
+	now := time.Now()
+	expiresAt := now.Add(s.Cfg.JWTExpiration)
+	tokenExpiresAt := expiresAt
+	if s.Cfg.SessionMaxLifetime > 0 {
+		maxExpiresAt := now.Add(s.Cfg.SessionMaxLifetime)
+		if expiresAt.After(maxExpiresAt) {
+			expiresAt = maxExpiresAt
 		}
-		if err := s.sessionRepo.DeactivateSession(oldest.Token); err != nil {
-			return "", fmt.Errorf("error al desactivar la sesión más antigua: %w", err)
+		tokenExpiresAt = expiresAt
+		if s.Cfg.SessionSliding {
+			tokenExpiresAt = maxExpiresAt
 		}
 	}
 
 	// Generar nuevo token
-	tokenString, err := s.generateToken(user)
+	tokenString, jti, err := s.generateToken(user, tokenExpiresAt)
 	if err != nil {
 		return "", fmt.Errorf("error al generar token: %w", err)
 	}
 
+	fingerprint, newDevice := s.recognizeDevice(ctx, user, userAgent, ip, opts.DeviceID)
+
 	// Crear nueva sesión
 	session := &models.Session{
-		UserID:       user.ID,
-		Token:        tokenString,
-		LastActivity: time.Now(),
-		ExpiresAt:    time.Now().Add(s.Cfg.JWTExpiration),
-		UserAgent:    userAgent,
-		IP:           ip,
-		IsActive:     true,
+		UserID:            user.ID,
+		Token:             tokenString,
+		JTI:               jti,
+		LastActivity:      now,
+		ExpiresAt:         expiresAt,
+		UserAgent:         userAgent,
+		IP:                ip,
+		IsActive:          true,
+		DeviceFingerprint: fingerprint,
+		NewDevice:         newDevice,
 	}
+	s.locate(session)
 
-	if err := s.sessionRepo.CreateSession(session); err != nil {
+	if err := s.sessionRepo.CreateSession(ctx, session); err != nil {
 		return "", fmt.Errorf("error al crear sesión: %w", err)
 	}
+	attempt.session = session
+
+	if newDevice {
+		s.notifyNewDevice(ctx, user, session)
+	}
+	s.checkTravel(ctx, previous, session)
 
 	return tokenString, nil
 }
 
-func (s *AuthService) Logout(tokenStr string) error {
+func (s *AuthService) Logout(ctx context.Context, tokenStr string) error {
+	claims, err := s.parseToken(tokenStr)
+	if err != nil {
+		return err
+	}
+	jti, _ := claims["jti"].(string)
+	expiresAt := time.Now().Add(s.Cfg.JWTExpiration)
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		expiresAt = exp.Time
+	}
+
 	// Verificar si la sesión existe y está activa
-	session, err := s.sessionRepo.GetActiveSessionByToken(tokenStr)
+	session, err := s.sessionRepo.GetActiveSessionByToken(ctx, tokenStr)
+	if apperrors.IsContextError(err) {
+		return err
+	}
 	if err != nil || session == nil {
 		// Si no existe la sesión, igual intentamos invalidar el token
-		expiresAt := time.Now().Add(s.Cfg.JWTExpiration)
-		return s.userRepo.InvalidateToken(tokenStr, expiresAt)
+		if err := s.userRepo.InvalidateToken(ctx, tokenStr, jti, expiresAt); err != nil {
+			return err
+		}
+		s.revokeCached(jti)
+		return nil
 	}
 
 	// Desactivar la sesión
-	if err := s.sessionRepo.DeactivateSession(tokenStr); err != nil {
+	if err := s.sessionRepo.DeactivateSession(ctx, tokenStr); err != nil {
 		return fmt.Errorf("error al desactivar la sesión: %w", err)
 	}
 
 	// Invalidar el token
-	expiresAt := time.Now().Add(s.Cfg.JWTExpiration)
-	if err := s.userRepo.InvalidateToken(tokenStr, expiresAt); err != nil {
+	if err := s.userRepo.InvalidateToken(ctx, tokenStr, jti, expiresAt); err != nil {
 		return fmt.Errorf("error al invalidar el token: %w", err)
 	}
+	s.revokeCached(jti)
 
+	username, _ := claims["username"].(string)
+	s.recordLogout(ctx, session, username)
 	return nil
 }
 
-func (s *AuthService) ValidateToken(tokenStr string) (uint, string, error) {
+// ValidateToken verifica el token y devuelve el usuario y su rol
+func (s *AuthService) ValidateToken(ctx context.Context, tokenStr string) (uint, string, error) {
+	claims, err := s.Authenticate(ctx, tokenStr)
+	if err != nil {
+		return 0, "", err
+	}
+	return claims.UserID, claims.Role, nil
+}
+
+// Authenticate verifica firma y expiración del JWT antes de consultar la base
+// de datos, de modo que un token falso o vencido no cuesta ninguna query.
+// Recién después comprueba lista negra y sesión usando el jti.
+func (s *AuthService) Authenticate(ctx context.Context, tokenStr string) (*models.TokenClaims, error) {
+	claims, err := s.parseToken(tokenStr)
+	if err != nil {
+		return nil, err
+	}
+
+	jti, ok := claims["jti"].(string)
+	if !ok || jti == "" {
+		return nil, apperrors.WrapError(apperrors.ErrTokenInvalid, "missing jti claim")
+	}
+
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return nil, apperrors.WrapError(apperrors.ErrTokenInvalid, "missing user_id claim")
+	}
+
+	role, ok := claims["role"].(string)
+	if !ok {
+		return nil, apperrors.WrapError(apperrors.ErrTokenInvalid, "missing role claim")
+	}
+	username, _ := claims["username"].(string)
+
 	// Verificar si el token está en la lista negra
-	if s.userRepo.IsTokenInvalid(tokenStr) {
-		return 0, "", apperrors.ErrTokenBlacklisted
+	revoked, err := s.isTokenRevoked(ctx, jti)
+	if err != nil {
+		return nil, apperrors.WrapError(err, "failed to check token revocation")
+	}
+	if revoked {
+		return nil, apperrors.ErrTokenBlacklisted
 	}
 
 	// Verificar si la sesión está activa
-	session, err := s.sessionRepo.GetActiveSessionByToken(tokenStr)
+	session, err := s.activeSession(ctx, jti)
+	if apperrors.IsContextError(err) {
+		return nil, err
+	}
 	if err != nil || session == nil || session.IsExpired() || !session.IsActive {
-		return 0, "", apperrors.ErrTokenInvalid
+		return nil, apperrors.ErrTokenInvalid
 	}
 
-	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("método de firma inesperado: %v", token.Header["alg"])
+	if err := s.checkSessionLifetime(ctx, session); err != nil {
+		return nil, err
+	}
+	s.slideSession(ctx, session)
+
+	// Actualizar la última actividad de la sesión
+	if s.activity != nil {
+		s.activity.Touch(session.ID, time.Now())
+	} else {
+		_ = s.sessionRepo.UpdateLastActivity(ctx, tokenStr)
+	}
+
+	return &models.TokenClaims{
+		UserID:    uint(userID),
+		Username:  username,
+		Role:      role,
+		JTI:       jti,
+		SessionID: session.ID,
+	}, nil
+}
+
+// ListSessions devuelve las sesiones activas del usuario, con la última
+// actividad conocida en memoria si todavía no se escribió en la base
+func (s *AuthService) ListSessions(ctx context.Context, userID uint) ([]models.Session, error) {
+	sessions, err := s.sessionRepo.GetActiveSessionsByUserID(ctx, userID)
+	if err != nil {
+		return nil, apperrors.WrapError(err, "failed to list sessions")
+	}
+	if s.activity != nil {
+		for i := range sessions {
+			if seen, ok := s.activity.LastSeen(sessions[i].ID); ok && seen.After(sessions[i].LastActivity) {
+				sessions[i].LastActivity = seen
+			}
 		}
-		return []byte(s.Cfg.JWTSecret), nil
-	})
+	}
+	return sessions, nil
+}
 
+// RevokeSession cierra una sesión del usuario y agrega su token a la lista
+// negra. Si la sesión no existe o es de otro usuario devuelve ErrSessionNotFound.
+func (s *AuthService) RevokeSession(ctx context.Context, userID, sessionID uint) error {
+	session, err := s.sessionRepo.GetActiveSessionByID(ctx, sessionID)
+	if apperrors.IsContextError(err) {
+		return err
+	}
+	if err != nil || session == nil || session.UserID != userID {
+		return apperrors.ErrSessionNotFound
+	}
+	return s.revokeSession(ctx, session)
+}
+
+// RevokeOtherSessions cierra todas las sesiones del usuario salvo la actual y
+// devuelve cuántas se cerraron
+func (s *AuthService) RevokeOtherSessions(ctx context.Context, userID, currentSessionID uint) (int, error) {
+	sessions, err := s.sessionRepo.GetActiveSessionsByUserID(ctx, userID)
 	if err != nil {
-		return 0, "", apperrors.WrapError(err, "failed to parse token")
+		return 0, apperrors.WrapError(err, "failed to list sessions")
 	}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		if exp, ok := claims["exp"].(float64); ok {
-			if float64(time.Now().Unix()) > exp {
-				return 0, "", apperrors.ErrTokenExpired
-			}
+	revoked := 0
+	for i := range sessions {
+		if sessions[i].ID == currentSessionID {
+			continue
 		}
+		if err := s.revokeSession(ctx, &sessions[i]); err != nil {
+			return revoked, err
+		}
+		revoked++
+	}
+	return revoked, nil
+}
 
-		userID, ok := claims["user_id"].(float64)
-		if !ok {
-			return 0, "", apperrors.WrapError(apperrors.ErrTokenInvalid, "missing user_id claim")
+// revokeSession desactiva la sesión y agrega su token a la lista negra hasta
+// su vencimiento original
+func (s *AuthService) revokeSession(ctx context.Context, session *models.Session) error {
+	expiresAt := session.ExpiresAt
+	if err := s.sessionRepo.DeactivateSession(ctx, session.Token); err != nil {
+		return fmt.Errorf("error al desactivar la sesión: %w", err)
+	}
+	if err := s.userRepo.InvalidateToken(ctx, session.Token, session.JTI, expiresAt); err != nil {
+		return fmt.Errorf("error al invalidar el token: %w", err)
+	}
+	s.revokeCached(session.JTI)
+	return nil
+}
+
+// checkSessionLifetime rechaza la sesión si superó la vida máxima o el tiempo
+// de inactividad permitido, y en ese caso la desactiva
+func (s *AuthService) checkSessionLifetime(ctx context.Context, session *models.Session) error {
+	now := time.Now()
+
+	if max := s.Cfg.SessionMaxLifetime; max > 0 && now.After(session.CreatedAt.Add(max)) {
+		s.expireSession(ctx, session)
+		return apperrors.ErrSessionAbsoluteExpired
+	}
+
+	idle := s.Cfg.SessionIdleTimeout
+	if idle <= 0 || now.Sub(s.lastActivity(session)) <= idle {
+		return nil
+	}
+
+	// La copia puede venir de la caché y estar desactualizada si hubo
+	// actividad en otra réplica: confirmar contra el store antes de cortar
+	if s.revocations != nil {
+		fresh, err := s.sessionRepo.GetActiveSessionByJTI(ctx, session.JTI)
+		if err != nil {
+			return apperrors.ErrTokenInvalid
+		}
+		if now.Sub(s.lastActivity(fresh)) <= idle {
+			s.revocations.ForgetSession(session.JTI)
+			return nil
 		}
+	}
+
+	s.expireSession(ctx, session)
+	return apperrors.ErrSessionIdleExpired
+}
 
-		role, ok := claims["role"].(string)
-		if !ok {
-			return 0, "", apperrors.WrapError(apperrors.ErrTokenInvalid, "missing role claim")
+// lastActivity combina lo guardado en la sesión con lo que todavía está
+// pendiente de escritura en el agregador
+func (s *AuthService) lastActivity(session *models.Session) time.Time {
+	last := session.LastActivity
+	if s.activity != nil {
+		if seen, ok := s.activity.LastSeen(session.ID); ok && seen.After(last) {
+			last = seen
 		}
+	}
+	return last
+}
+
+// slideSession extiende ExpiresAt con la actividad, sin pasar la vida máxima.
+// Solo escribe cuando la extensión supera una décima parte de JWTExpiration,
+// para no generar un UPDATE por request.
+func (s *AuthService) slideSession(ctx context.Context, session *models.Session) {
+	if !s.Cfg.SessionSliding {
+		return
+	}
+
+	expiresAt := time.Now().Add(s.Cfg.JWTExpiration)
+	if max := session.CreatedAt.Add(s.Cfg.SessionMaxLifetime); expiresAt.After(max) {
+		expiresAt = max
+	}
+	if expiresAt.Sub(session.ExpiresAt) <= s.Cfg.JWTExpiration/10 {
+		return
+	}
+
+	if err := s.sessionRepo.ExtendSession(ctx, session.ID, expiresAt); err != nil {
+		return
+	}
+	session.ExpiresAt = expiresAt
+	if s.revocations != nil {
+		s.revocations.ForgetSession(session.JTI)
+	}
+}
 
-		// Actualizar la última actividad de la sesión
-		_ = s.sessionRepo.UpdateLastActivity(tokenStr)
+func (s *AuthService) expireSession(ctx context.Context, session *models.Session) {
+	_ = s.sessionRepo.DeactivateSession(ctx, session.Token)
+	if s.revocations != nil {
+		s.revocations.ForgetSession(session.JTI)
+	}
+}
 
-		return uint(userID), role, nil
+func (s *AuthService) isTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	if s.revocations != nil {
+		return s.revocations.IsTokenRevoked(ctx, jti)
 	}
+	return s.userRepo.IsTokenRevoked(ctx, jti)
+}
 
-	return 0, "", apperrors.ErrTokenInvalid
+func (s *AuthService) activeSession(ctx context.Context, jti string) (*models.Session, error) {
+	if s.revocations != nil {
+		return s.revocations.GetActiveSessionByJTI(ctx, jti)
+	}
+	return s.sessionRepo.GetActiveSessionByJTI(ctx, jti)
 }
 
-func (s *AuthService) generateToken(user *models.User) (string, error) {
+func (s *AuthService) revokeCached(jti string) {
+	if s.revocations != nil {
+		s.revocations.Revoke(jti)
+	}
+}
+
+// parseToken valida firma, algoritmo y expiración sin tocar la base de datos
+func (s *AuthService) parseToken(tokenStr string) (jwt.MapClaims, error) {
+	if tokenStr == "" {
+		return nil, apperrors.ErrTokenMissing
+	}
+
+	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("método de firma inesperado: %v", token.Header["alg"])
+		}
+		return []byte(s.Cfg.JWTSecret), nil
+	}, jwt.WithExpirationRequired())
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, apperrors.ErrTokenExpired
+		}
+		return nil, apperrors.WrapError(apperrors.ErrTokenInvalid, err.Error())
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, apperrors.ErrTokenInvalid
+	}
+	return claims, nil
+}
+
+func (s *AuthService) generateToken(user *models.User, expiresAt time.Time) (string, string, error) {
 	jti := make([]byte, 16)
 	_, err := rand.Read(jti)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 	jtiStr := hex.EncodeToString(jti)
 
@@ -190,10 +591,14 @@ func (s *AuthService) generateToken(user *models.User) (string, error) {
 		"user_id":  user.ID,
 		"username": user.Username,
 		"role":     user.Role,
-		"exp":      time.Now().Add(s.Cfg.JWTExpiration).Unix(),
+		"exp":      expiresAt.Unix(),
 		"iat":      time.Now().Unix(),
 		"jti":      jtiStr,
 	})
 
-	return token.SignedString([]byte(s.Cfg.JWTSecret))
+	signed, err := token.SignedString([]byte(s.Cfg.JWTSecret))
+	if err != nil {
+		return "", "", err
+	}
+	return signed, jtiStr, nil
 }
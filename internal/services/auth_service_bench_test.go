@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ramiroschettino/jwt-auth-api/internal/activity"
+	"github.com/ramiroschettino/jwt-auth-api/internal/cache"
+	"github.com/ramiroschettino/jwt-auth-api/internal/config"
+	"github.com/ramiroschettino/jwt-auth-api/internal/models"
+	"github.com/ramiroschettino/jwt-auth-api/internal/repositories"
+	"gorm.io/gorm"
+)
+
+// newBenchAuthService arma un AuthService sobre SQLite en memoria y devuelve
+// un contador con la cantidad de sentencias SQL ejecutadas
+func newBenchAuthService(b *testing.B) (*AuthService, *int64) {
+	b.Helper()
+
+	db, err := gorm.Open(sqlite.Open("file:bench?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Session{}, &models.InvalidToken{}); err != nil {
+		b.Fatal(err)
+	}
+	db.Exec("DELETE FROM invalid_tokens")
+	db.Exec("DELETE FROM sessions")
+	db.Exec("DELETE FROM users")
+
+	var queries int64
+	count := func(*gorm.DB) { atomic.AddInt64(&queries, 1) }
+	db.Callback().Query().After("gorm:query").Register("bench:count_query", count)
+	db.Callback().Create().After("gorm:create").Register("bench:count_create", count)
+	db.Callback().Update().After("gorm:update").Register("bench:count_update", count)
+	db.Callback().Delete().After("gorm:delete").Register("bench:count_delete", count)
+	db.Callback().Row().After("gorm:row").Register("bench:count_row", count)
+
+	cfg := &config.Config{
+		JWTSecret:     "bench-secret",
+		JWTExpiration: 15 * time.Minute,
+	}
+	svc := NewAuthService(repositories.NewUserRepository(db), repositories.NewSessionRepository(db), cfg)
+	return svc, &queries
+}
+
+func benchValidate(b *testing.B, svc *AuthService, queries *int64, token string) {
+	b.Helper()
+	ctx := context.Background()
+	atomic.StoreInt64(queries, 0)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		svc.ValidateToken(ctx, token)
+	}
+	b.StopTimer()
+	b.ReportMetric(float64(atomic.LoadInt64(queries))/float64(b.N), "queries/op")
+}
+
+func BenchmarkValidateToken(b *testing.B) {
+	ctx := context.Background()
+
+	b.Run("Valid", func(b *testing.B) {
+		svc, queries := newBenchAuthService(b)
+		if _, err := svc.Register(ctx, "bench", "benchpass", "user"); err != nil {
+			b.Fatal(err)
+		}
+		token, err := svc.Login(ctx, "bench", "benchpass", "bench-agent", "127.0.0.1")
+		if err != nil {
+			b.Fatal(err)
+		}
+		benchValidate(b, svc, queries, token)
+	})
+
+	b.Run("ValidCached", func(b *testing.B) {
+		svc, queries := newBenchAuthService(b)
+		rc := cache.NewRevocationCache(svc.userRepo, svc.sessionRepo, cache.Options{ResyncInterval: time.Hour})
+		if err := rc.Resync(ctx); err != nil {
+			b.Fatal(err)
+		}
+		svc.WithRevocationCache(rc)
+		svc.WithActivityAggregator(activity.NewAggregator(svc.sessionRepo, activity.Options{FlushInterval: time.Hour}))
+		if _, err := svc.Register(ctx, "bench", "benchpass", "user"); err != nil {
+			b.Fatal(err)
+		}
+		token, err := svc.Login(ctx, "bench", "benchpass", "bench-agent", "127.0.0.1")
+		if err != nil {
+			b.Fatal(err)
+		}
+		benchValidate(b, svc, queries, token)
+	})
+
+	b.Run("Expired", func(b *testing.B) {
+		svc, queries := newBenchAuthService(b)
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"user_id": 1,
+			"role":    "user",
+			"exp":     time.Now().Add(-time.Minute).Unix(),
+			"jti":     "expired",
+		}).SignedString([]byte(svc.Cfg.JWTSecret))
+		if err != nil {
+			b.Fatal(err)
+		}
+		benchValidate(b, svc, queries, token)
+	})
+
+	b.Run("Forged", func(b *testing.B) {
+		svc, queries := newBenchAuthService(b)
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"user_id": 1,
+			"role":    "admin",
+			"exp":     time.Now().Add(time.Hour).Unix(),
+			"jti":     "forged",
+		}).SignedString([]byte("otro-secreto"))
+		if err != nil {
+			b.Fatal(err)
+		}
+		benchValidate(b, svc, queries, token)
+	})
+}
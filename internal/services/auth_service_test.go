@@ -1,16 +1,33 @@
 package services
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/glebarez/sqlite"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ramiroschettino/jwt-auth-api/internal/cache"
 	"github.com/ramiroschettino/jwt-auth-api/internal/config"
+	"github.com/ramiroschettino/jwt-auth-api/internal/devices"
 	apperrors "github.com/ramiroschettino/jwt-auth-api/internal/errors"
+	"github.com/ramiroschettino/jwt-auth-api/internal/geoip"
+	"github.com/ramiroschettino/jwt-auth-api/internal/mail"
+	"github.com/ramiroschettino/jwt-auth-api/internal/mfa"
 	"github.com/ramiroschettino/jwt-auth-api/internal/models"
+	"github.com/ramiroschettino/jwt-auth-api/internal/passhash"
 	"github.com/ramiroschettino/jwt-auth-api/internal/repositories"
+	"github.com/ramiroschettino/jwt-auth-api/internal/repositories/repotest"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
+	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
@@ -49,8 +66,9 @@ func (s *AuthServiceTestSuite) SetupTest() {
 
 	// Config de prueba
 	cfg := &config.Config{
-		JWTSecret:     "test-secret",
-		JWTExpiration: 15 * time.Minute,
+		JWTSecret:          "test-secret",
+		JWTExpiration:      15 * time.Minute,
+		MaxSessionsPerUser: 5,
 	}
 
 	userRepo := repositories.NewUserRepository(s.db)
@@ -64,10 +82,11 @@ func TestAuthService(t *testing.T) {
 
 func (s *AuthServiceTestSuite) TestAuthService() {
 	t := s.T()
+	ctx := context.Background()
 
 	t.Run("Register", func(t *testing.T) {
 		t.Log("Inicio Register test")
-		user, err := s.authService.Register("testuser", "testpass", "user")
+		user, err := s.authService.Register(ctx, "testuser", "testpass", "user")
 		t.Logf("Register result: user=%v, err=%v", user, err)
 		assert.NoError(t, err)
 		assert.NotNil(t, user)
@@ -92,40 +111,41 @@ func (s *AuthServiceTestSuite) TestAuthService() {
 		s.db.Exec("DELETE FROM users")
 
 		t.Log("Antes de Register testuser2")
-		_, err := s.authService.Register("testuser2", "testpass", "user")
+		_, err := s.authService.Register(ctx, "testuser2", "testpass", "user")
 		t.Logf("Register testuser2: err=%v", err)
 		assert.NoError(t, err)
 
 		t.Log("Antes de Login testuser2")
-		token, err := s.authService.Login("testuser2", "testpass", "test-agent", "127.0.0.1")
+		token, err := s.authService.Login(ctx, "testuser2", "testpass", "test-agent", "127.0.0.1")
 		t.Logf("Login testuser2: token=%v, err=%v", token, err)
 		assert.NoError(t, err)
 		assert.NotEmpty(t, token)
 
 		// Login con contraseña incorrecta
 		t.Log("Antes de Login con contraseña incorrecta")
-		_, err = s.authService.Login("testuser2", "wrongpass", "test-agent", "127.0.0.1")
+		_, err = s.authService.Login(ctx, "testuser2", "wrongpass", "test-agent", "127.0.0.1")
 		t.Logf("Login wrongpass: err=%v", err)
 		assert.Error(t, err)
-		assert.Equal(t, apperrors.ErrInvalidPassword, err)
+		assert.Equal(t, apperrors.ErrInvalidCredentials, err)
 
 		// Login con usuario inexistente
 		t.Log("Antes de Login usuario inexistente")
-		_, err = s.authService.Login("nonexistent", "testpass", "test-agent", "127.0.0.1")
+		_, err = s.authService.Login(ctx, "nonexistent", "testpass", "test-agent", "127.0.0.1")
 		t.Logf("Login nonexistent: err=%v", err)
 		assert.Error(t, err)
-		assert.Equal(t, apperrors.ErrUserNotFound, err)
+		assert.Equal(t, apperrors.ErrInvalidCredentials, err)
 
-		// Múltiples logins hasta exceder maxSessionsPerUser
-		t.Log("Antes de múltiples logins (maxSessionsPerUser+1)")
+		// Múltiples logins hasta exceder MaxSessionsPerUser
+		maxSessionsPerUser := s.authService.Cfg.MaxSessionsPerUser
+		t.Log("Antes de múltiples logins (MaxSessionsPerUser+1)")
 		for i := 0; i < maxSessionsPerUser+1; i++ {
-			token, err = s.authService.Login("testuser2", "testpass", "test-agent", "127.0.0.1")
+			token, err = s.authService.Login(ctx, "testuser2", "testpass", "test-agent", "127.0.0.1")
 			t.Logf("Login loop %d: token=%v, err=%v", i, token, err)
 			assert.NoError(t, err)
 			assert.NotEmpty(t, token)
 		}
 
-		// Verificar que solo queden maxSessionsPerUser activas
+		// Verificar que solo queden MaxSessionsPerUser activas
 		t.Log("Antes de verificar sesiones activas")
 		var count int64
 		// Buscar el usuario testuser2
@@ -146,66 +166,1429 @@ func (s *AuthServiceTestSuite) TestAuthService() {
 		s.db.Exec("DELETE FROM sessions")
 		s.db.Exec("DELETE FROM invalid_tokens")
 
-		user, err := s.authService.Register("jwtuser", "jwtpass", "user")
+		user, err := s.authService.Register(ctx, "jwtuser", "jwtpassword", "user")
 		assert.NoError(t, err)
 		assert.NotNil(t, user)
 
 		// Login inicial
-		token, err := s.authService.Login("jwtuser", "jwtpass", "test-agent", "127.0.0.1")
+		token, err := s.authService.Login(ctx, "jwtuser", "jwtpassword", "test-agent", "127.0.0.1")
 		assert.NoError(t, err)
 		assert.NotEmpty(t, token)
 
 		// Validar token
-		userID, role, err := s.authService.ValidateToken(token)
+		userID, role, err := s.authService.ValidateToken(ctx, token)
 		assert.NoError(t, err)
 		assert.Equal(t, user.ID, userID)
 		assert.Equal(t, "user", role)
 
 		// Logout → invalida token
-		err = s.authService.Logout(token)
+		err = s.authService.Logout(ctx, token)
 		assert.NoError(t, err)
 
-		_, _, err = s.authService.ValidateToken(token)
+		_, _, err = s.authService.ValidateToken(ctx, token)
 		assert.Error(t, err)
 
 		// Nuevo login genera token distinto
-		newToken, err := s.authService.Login("jwtuser", "jwtpass", "test-agent", "127.0.0.1")
+		newToken, err := s.authService.Login(ctx, "jwtuser", "jwtpassword", "test-agent", "127.0.0.1")
 		assert.NoError(t, err)
 		assert.NotEmpty(t, newToken)
 		assert.NotEqual(t, token, newToken)
 
 		// Token viejo sigue inválido
-		_, _, err = s.authService.ValidateToken(token)
+		_, _, err = s.authService.ValidateToken(ctx, token)
 		assert.Error(t, err)
 
 		// Nuevo token válido
-		userID, role, err = s.authService.ValidateToken(newToken)
+		userID, role, err = s.authService.ValidateToken(ctx, newToken)
 		assert.NoError(t, err)
 		assert.Equal(t, user.ID, userID)
 		assert.Equal(t, "user", role)
 	})
 
 	t.Run("Role Validation", func(t *testing.T) {
-		admin, err := s.authService.Register("adminuser", "adminpass", "admin")
+		admin, err := s.authService.Register(ctx, "adminuser", "adminpass", "admin")
 		assert.NoError(t, err)
 
-		regularUser, err := s.authService.Register("regularuser", "userpass", "user")
+		regularUser, err := s.authService.Register(ctx, "regularuser", "userpass", "user")
 		assert.NoError(t, err)
 
 		// Admin
-		adminToken, err := s.authService.Login("adminuser", "adminpass", "test-agent", "127.0.0.1")
+		adminToken, err := s.authService.Login(ctx, "adminuser", "adminpass", "test-agent", "127.0.0.1")
 		assert.NoError(t, err)
-		adminID, role, err := s.authService.ValidateToken(adminToken)
+		adminID, role, err := s.authService.ValidateToken(ctx, adminToken)
 		assert.NoError(t, err)
 		assert.Equal(t, admin.ID, adminID)
 		assert.Equal(t, "admin", role)
 
 		// Usuario normal
-		userToken, err := s.authService.Login("regularuser", "userpass", "test-agent", "127.0.0.1")
+		userToken, err := s.authService.Login(ctx, "regularuser", "userpass", "test-agent", "127.0.0.1")
 		assert.NoError(t, err)
-		userID, role, err := s.authService.ValidateToken(userToken)
+		userID, role, err := s.authService.ValidateToken(ctx, userToken)
 		assert.NoError(t, err)
 		assert.Equal(t, regularUser.ID, userID)
 		assert.Equal(t, "user", role)
 	})
+	t.Run("Forged and Expired Tokens", func(t *testing.T) {
+		user, err := s.authService.Register(ctx, "forgeduser", "forgedpass", "user")
+		assert.NoError(t, err)
+
+		// Token firmado con otro secreto
+		forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"user_id": user.ID,
+			"role":    "admin",
+			"exp":     time.Now().Add(time.Hour).Unix(),
+			"jti":     "forged",
+		})
+		forgedStr, err := forged.SignedString([]byte("otro-secreto"))
+		assert.NoError(t, err)
+		_, _, err = s.authService.ValidateToken(ctx, forgedStr)
+		assert.ErrorIs(t, err, apperrors.ErrTokenInvalid)
+
+		// Token vencido con la firma correcta
+		expired := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"user_id": user.ID,
+			"role":    "user",
+			"exp":     time.Now().Add(-time.Minute).Unix(),
+			"jti":     "expired",
+		})
+		expiredStr, err := expired.SignedString([]byte(s.authService.Cfg.JWTSecret))
+		assert.NoError(t, err)
+		_, _, err = s.authService.ValidateToken(ctx, expiredStr)
+		assert.ErrorIs(t, err, apperrors.ErrTokenExpired)
+
+		// Token sin jti
+		noJTI := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"user_id": user.ID,
+			"role":    "user",
+			"exp":     time.Now().Add(time.Hour).Unix(),
+		})
+		noJTIStr, err := noJTI.SignedString([]byte(s.authService.Cfg.JWTSecret))
+		assert.NoError(t, err)
+		_, _, err = s.authService.ValidateToken(ctx, noJTIStr)
+		assert.ErrorIs(t, err, apperrors.ErrTokenInvalid)
+
+		// Basura
+		_, _, err = s.authService.ValidateToken(ctx, "no-es-un-jwt")
+		assert.ErrorIs(t, err, apperrors.ErrTokenInvalid)
+	})
+	t.Run("Canceled Context", func(t *testing.T) {
+		_, err := s.authService.Register(ctx, "ctxuser", "ctxpassword", "user")
+		assert.NoError(t, err)
+		token, err := s.authService.Login(ctx, "ctxuser", "ctxpassword", "test-agent", "127.0.0.1")
+		assert.NoError(t, err)
+
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+
+		_, err = s.authService.Login(canceled, "ctxuser", "ctxpassword", "test-agent", "127.0.0.1")
+		assert.ErrorIs(t, err, context.Canceled)
+
+		_, _, err = s.authService.ValidateToken(canceled, token)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("Session Management", func(t *testing.T) {
+		user, err := s.authService.Register(ctx, "sessuser", "sesspass", "user")
+		assert.NoError(t, err)
+		_, err = s.authService.Register(ctx, "sessother", "sesspass", "user")
+		assert.NoError(t, err)
+
+		tokens := make([]string, 3)
+		for i := range tokens {
+			tokens[i], err = s.authService.Login(ctx, "sessuser", "sesspass", "test-agent", "127.0.0.1")
+			assert.NoError(t, err)
+		}
+		otherToken, err := s.authService.Login(ctx, "sessother", "sesspass", "test-agent", "127.0.0.1")
+		assert.NoError(t, err)
+
+		current, err := s.authService.Authenticate(ctx, tokens[0])
+		assert.NoError(t, err)
+		assert.NotZero(t, current.SessionID)
+
+		sessions, err := s.authService.ListSessions(ctx, user.ID)
+		assert.NoError(t, err)
+		assert.Len(t, sessions, 3)
+
+		// No se puede revocar la sesión de otro usuario
+		otherClaims, err := s.authService.Authenticate(ctx, otherToken)
+		assert.NoError(t, err)
+		err = s.authService.RevokeSession(ctx, user.ID, otherClaims.SessionID)
+		assert.ErrorIs(t, err, apperrors.ErrSessionNotFound)
+
+		// Revocar una sesión puntual
+		second, err := s.authService.Authenticate(ctx, tokens[1])
+		assert.NoError(t, err)
+		assert.NoError(t, s.authService.RevokeSession(ctx, user.ID, second.SessionID))
+		_, _, err = s.authService.ValidateToken(ctx, tokens[1])
+		assert.ErrorIs(t, err, apperrors.ErrTokenBlacklisted)
+
+		// Revocar las demás deja viva solo la actual
+		revoked, err := s.authService.RevokeOtherSessions(ctx, user.ID, current.SessionID)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, revoked)
+
+		_, _, err = s.authService.ValidateToken(ctx, tokens[0])
+		assert.NoError(t, err)
+		_, _, err = s.authService.ValidateToken(ctx, tokens[2])
+		assert.Error(t, err)
+		_, _, err = s.authService.ValidateToken(ctx, otherToken)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Session Lifetime", func(t *testing.T) {
+		svc := NewAuthService(
+			repositories.NewUserRepository(s.db),
+			repositories.NewSessionRepository(s.db),
+			&config.Config{
+				JWTSecret:          "test-secret",
+				JWTExpiration:      15 * time.Minute,
+				SessionIdleTimeout: 10 * time.Minute,
+				SessionMaxLifetime: 8 * time.Hour,
+				SessionSliding:     true,
+			},
+		)
+		_, err := svc.Register(ctx, "lifeuser", "lifepass", "user")
+		assert.NoError(t, err)
+
+		login := func() (string, *models.Session) {
+			token, err := svc.Login(ctx, "lifeuser", "lifepass", "test-agent", "127.0.0.1")
+			assert.NoError(t, err)
+			claims, err := svc.Authenticate(ctx, token)
+			assert.NoError(t, err)
+			var session models.Session
+			assert.NoError(t, s.db.First(&session, claims.SessionID).Error)
+			return token, &session
+		}
+
+		// Con renovación deslizante el JWT dura la vida máxima de la sesión
+		token, session := login()
+		parsed, err := svc.parseToken(token)
+		assert.NoError(t, err)
+		exp, err := parsed.GetExpirationTime()
+		assert.NoError(t, err)
+		assert.WithinDuration(t, session.CreatedAt.Add(8*time.Hour), exp.Time, time.Minute)
+
+		// La actividad extiende ExpiresAt
+		s.db.Model(session).Update("expires_at", time.Now().Add(5*time.Minute))
+		_, err = svc.Authenticate(ctx, token)
+		assert.NoError(t, err)
+		var extended models.Session
+		assert.NoError(t, s.db.First(&extended, session.ID).Error)
+		assert.WithinDuration(t, time.Now().Add(15*time.Minute), extended.ExpiresAt, time.Minute)
+
+		// Inactividad
+		s.db.Model(session).Update("last_activity", time.Now().Add(-11*time.Minute))
+		_, err = svc.Authenticate(ctx, token)
+		assert.ErrorIs(t, err, apperrors.ErrSessionIdleExpired)
+		_, err = svc.Authenticate(ctx, token)
+		assert.ErrorIs(t, err, apperrors.ErrTokenInvalid)
+
+		// Vida máxima
+		token, session = login()
+		s.db.Model(session).Update("created_at", time.Now().Add(-9*time.Hour))
+		_, err = svc.Authenticate(ctx, token)
+		assert.ErrorIs(t, err, apperrors.ErrSessionAbsoluteExpired)
+	})
+
+	t.Run("Session Limit Policies", func(t *testing.T) {
+		newService := func(policy string) *AuthService {
+			return NewAuthService(
+				repositories.NewUserRepository(s.db),
+				repositories.NewSessionRepository(s.db),
+				&config.Config{
+					JWTSecret:          "test-secret",
+					JWTExpiration:      15 * time.Minute,
+					MaxSessionsPerUser: 5,
+					MaxSessionsByRole:  map[string]int{"admin": 2},
+					SessionLimitPolicy: policy,
+				},
+			)
+		}
+
+		// Evict oldest: la sesión desalojada queda en la lista negra
+		svc := newService(SessionPolicyEvictOldest)
+		_, err := svc.Register(ctx, "limitadmin", "limitpass", "admin")
+		assert.NoError(t, err)
+		first, err := svc.Login(ctx, "limitadmin", "limitpass", "test-agent", "127.0.0.1")
+		assert.NoError(t, err)
+		_, err = svc.Login(ctx, "limitadmin", "limitpass", "test-agent", "127.0.0.1")
+		assert.NoError(t, err)
+		_, err = svc.Login(ctx, "limitadmin", "limitpass", "test-agent", "127.0.0.1")
+		assert.NoError(t, err)
+		_, _, err = svc.ValidateToken(ctx, first)
+		assert.ErrorIs(t, err, apperrors.ErrTokenBlacklisted)
+
+		// Reject
+		svc = newService(SessionPolicyReject)
+		_, err = svc.Login(ctx, "limitadmin", "limitpass", "test-agent", "127.0.0.1")
+		assert.ErrorIs(t, err, apperrors.ErrSessionLimitReached)
+
+		// Choose: el error trae las sesiones y se reintenta eligiendo una
+		svc = newService(SessionPolicyChoose)
+		_, err = svc.Login(ctx, "limitadmin", "limitpass", "test-agent", "127.0.0.1")
+		var limitErr *SessionLimitError
+		assert.ErrorAs(t, err, &limitErr)
+		assert.Equal(t, 2, limitErr.Limit)
+		assert.Len(t, limitErr.Sessions, 2)
+
+		victim := limitErr.Sessions[0]
+		_, err = svc.LoginWithOptions(ctx, "limitadmin", "limitpass", "test-agent", "127.0.0.1", LoginOptions{TerminateSessionID: victim.ID})
+		assert.NoError(t, err)
+		_, _, err = svc.ValidateToken(ctx, victim.Token)
+		assert.ErrorIs(t, err, apperrors.ErrTokenBlacklisted)
+
+		// No se puede elegir una sesión ajena
+		_, err = svc.LoginWithOptions(ctx, "limitadmin", "limitpass", "test-agent", "127.0.0.1", LoginOptions{TerminateSessionID: 999999})
+		assert.ErrorIs(t, err, apperrors.ErrSessionNotFound)
+	})
+
+	t.Run("Revocation Cache", func(t *testing.T) {
+		rc := cache.NewRevocationCache(
+			repositories.NewUserRepository(s.db),
+			repositories.NewSessionRepository(s.db),
+			cache.Options{ResyncInterval: time.Hour},
+		)
+		assert.NoError(t, rc.Resync(ctx))
+		s.authService.WithRevocationCache(rc)
+		defer s.authService.WithRevocationCache(nil)
+
+		_, err := s.authService.Register(ctx, "cacheuser", "cachepass", "user")
+		assert.NoError(t, err)
+		token, err := s.authService.Login(ctx, "cacheuser", "cachepass", "test-agent", "127.0.0.1")
+		assert.NoError(t, err)
+
+		_, _, err = s.authService.ValidateToken(ctx, token)
+		assert.NoError(t, err)
+
+		// El logout debe invalidar la sesión cacheada de inmediato
+		assert.NoError(t, s.authService.Logout(ctx, token))
+		_, _, err = s.authService.ValidateToken(ctx, token)
+		assert.ErrorIs(t, err, apperrors.ErrTokenBlacklisted)
+	})
+}
+
+func TestAuthServiceWithFakes(t *testing.T) {
+	ctx := context.Background()
+	users := repotest.NewUserStore()
+	sessions := repotest.NewSessionStore()
+	svc := NewAuthService(users, sessions, &config.Config{
+		JWTSecret:     "test-secret",
+		JWTExpiration: 15 * time.Minute,
+	})
+
+	_, err := svc.Register(ctx, "fake", "fakepass", "user")
+	assert.NoError(t, err)
+	_, err = svc.Register(ctx, "fake", "fakepass", "user")
+	assert.ErrorIs(t, err, apperrors.ErrUserExists)
+
+	token, err := svc.Login(ctx, "fake", "fakepass", "test-agent", "127.0.0.1")
+	assert.NoError(t, err)
+
+	_, role, err := svc.ValidateToken(ctx, token)
+	assert.NoError(t, err)
+	assert.Equal(t, "user", role)
+
+	assert.NoError(t, svc.Logout(ctx, token))
+	_, _, err = svc.ValidateToken(ctx, token)
+	assert.ErrorIs(t, err, apperrors.ErrTokenBlacklisted)
+
+	users.Err = errors.New("base caída")
+	_, err = svc.Login(ctx, "fake", "fakepass", "test-agent", "127.0.0.1")
+	assert.Error(t, err)
+}
+
+type recordingNotifier struct {
+	events []devices.NewDeviceEvent
+}
+
+func (n *recordingNotifier) NotifyNewDevice(ctx context.Context, event devices.NewDeviceEvent) error {
+	n.events = append(n.events, event)
+	return nil
+}
+
+func TestDeviceRecognition(t *testing.T) {
+	ctx := context.Background()
+	sessions := repotest.NewSessionStore()
+	notifier := &recordingNotifier{}
+	svc := NewAuthService(repotest.NewUserStore(), sessions, &config.Config{
+		JWTSecret:     "test-secret",
+		JWTExpiration: 15 * time.Minute,
+	}).WithDeviceRecognition(repotest.NewDeviceStore(), notifier)
+
+	user, err := svc.Register(ctx, "device", "devicepass", "user")
+	require.NoError(t, err)
+
+	login := func(userAgent, ip, deviceID string) models.Session {
+		token, err := svc.LoginWithOptions(ctx, "device", "devicepass", userAgent, ip, LoginOptions{DeviceID: deviceID})
+		require.NoError(t, err)
+		session, err := sessions.GetActiveSessionByToken(ctx, token)
+		require.NoError(t, err)
+		return *session
+	}
+
+	// El primer dispositivo de la cuenta no dispara avisos
+	first := login("Firefox", "198.51.100.10", "")
+	assert.False(t, first.NewDevice)
+	assert.NotEmpty(t, first.DeviceFingerprint)
+
+	// Misma red y navegador: conocido
+	assert.False(t, login("Firefox", "198.51.100.99", "").NewDevice)
+
+	// Otro navegador
+	other := login("Chrome", "198.51.100.10", "")
+	assert.True(t, other.NewDevice)
+	require.Len(t, notifier.events, 1)
+	assert.Equal(t, user.ID, notifier.events[0].UserID)
+	assert.Equal(t, other.ID, notifier.events[0].SessionID)
+	assert.Equal(t, "Chrome", notifier.events[0].UserAgent)
+
+	// Con identificador de dispositivo la red no importa
+	assert.True(t, login("Safari", "203.0.113.1", "phone-1").NewDevice)
+	assert.False(t, login("Safari", "192.0.2.50", "phone-1").NewDevice)
+	assert.Len(t, notifier.events, 2)
+}
+
+type fakeLocator map[string]geoip.Location
+
+func (f fakeLocator) Lookup(ip string) (geoip.Location, bool) {
+	loc, ok := f[ip]
+	return loc, ok
+}
+
+func TestGeoIPEnrichment(t *testing.T) {
+	ctx := context.Background()
+	sessions := repotest.NewSessionStore()
+	locator := fakeLocator{
+		"198.51.100.7": {Country: "AR", City: "Buenos Aires", ASN: 64500, Latitude: -34.6, Longitude: -58.4, HasCoordinates: true},
+		"203.0.113.1":  {Country: "JP", City: "Tokyo", Latitude: 35.7, Longitude: 139.7, HasCoordinates: true},
+		"198.51.100.8": {Country: "AR", City: "La Plata", Latitude: -34.92, Longitude: -57.95, HasCoordinates: true, AccuracyKm: 50},
+	}
+	var travels []geoip.Travel
+	svc := NewAuthService(repotest.NewUserStore(), sessions, &config.Config{
+		JWTSecret:     "test-secret",
+		JWTExpiration: 15 * time.Minute,
+	}).WithEventLog(repotest.NewAuthEventStore()).WithGeoIP(locator).WithImpossibleTravelHook(1000, func(ctx context.Context, travel geoip.Travel) {
+		travels = append(travels, travel)
+	})
+
+	_, err := svc.Register(ctx, "traveler", "travelpass", "user")
+	require.NoError(t, err)
+
+	token, err := svc.Login(ctx, "traveler", "travelpass", "test-agent", "198.51.100.7")
+	require.NoError(t, err)
+	session, err := sessions.GetActiveSessionByToken(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, "AR", session.Country)
+	assert.Equal(t, "Buenos Aires", session.City)
+	assert.Equal(t, uint(64500), session.ASN)
+	require.NotNil(t, session.Latitude)
+	assert.Empty(t, travels)
+
+	// Una IP desconocida no aporta ubicación ni dispara el hook
+	token, err = svc.Login(ctx, "traveler", "travelpass", "test-agent", "192.0.2.1")
+	require.NoError(t, err)
+	session, err = sessions.GetActiveSessionByToken(ctx, token)
+	require.NoError(t, err)
+	assert.Empty(t, session.Country)
+	assert.Nil(t, session.Latitude)
+	assert.Empty(t, travels)
+
+	// Tokio segundos después de Buenos Aires
+	_, err = svc.Login(ctx, "traveler", "travelpass", "test-agent", "198.51.100.7")
+	require.NoError(t, err)
+	token, err = svc.Login(ctx, "traveler", "travelpass", "test-agent", "203.0.113.1")
+	require.NoError(t, err)
+	require.Len(t, travels, 1)
+	assert.Equal(t, "AR", travels[0].Previous.Location.Country)
+	assert.Equal(t, "JP", travels[0].Current.Location.Country)
+
+	// Cerrar la sesión no borra el login anterior
+	require.NoError(t, svc.Logout(ctx, token))
+	_, err = svc.Login(ctx, "traveler", "travelpass", "test-agent", "198.51.100.7")
+	require.NoError(t, err)
+	require.Len(t, travels, 2)
+	assert.Equal(t, "JP", travels[1].Previous.Location.Country)
+
+	// Una ciudad vecina dentro del radio de precisión no es un viaje
+	_, err = svc.Login(ctx, "traveler", "travelpass", "test-agent", "198.51.100.8")
+	require.NoError(t, err)
+	assert.Len(t, travels, 2)
+}
+
+func TestAuthEventLog(t *testing.T) {
+	ctx := context.Background()
+	events := repotest.NewAuthEventStore()
+	svc := NewAuthService(repotest.NewUserStore(), repotest.NewSessionStore(), &config.Config{
+		JWTSecret:     "test-secret",
+		JWTExpiration: 15 * time.Minute,
+	}).WithEventLog(events)
+
+	user, err := svc.Register(ctx, "audited", "auditpass", "user")
+	require.NoError(t, err)
+
+	_, err = svc.Login(ctx, "ghost", "whatever", "test-agent", "198.51.100.1")
+	assert.Error(t, err)
+	_, err = svc.Login(ctx, "audited", "wrongpass", "test-agent", "198.51.100.2")
+	assert.Error(t, err)
+	token, err := svc.Login(ctx, "audited", "auditpass", "test-agent", "198.51.100.3")
+	require.NoError(t, err)
+	require.NoError(t, svc.Logout(ctx, token))
+
+	history, err := svc.LoginHistory(ctx, user.ID, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.True(t, history[0].Success)
+	assert.Equal(t, LoginMethodPassword, history[0].Method)
+	assert.NotNil(t, history[0].SessionID)
+	assert.Equal(t, "198.51.100.3", history[0].IP)
+	assert.False(t, history[1].Success)
+	assert.Equal(t, ReasonInvalidPassword, history[1].Reason)
+
+	// El intento con un usuario inexistente queda registrado sin user_id
+	failed := false
+	unknown, err := svc.QueryAuthEvents(ctx, repositories.AuthEventFilter{Username: "ghost", Success: &failed})
+	require.NoError(t, err)
+	require.Len(t, unknown, 1)
+	assert.Nil(t, unknown[0].UserID)
+	assert.Equal(t, ReasonUserNotFound, unknown[0].Reason)
+
+	logouts, err := svc.QueryAuthEvents(ctx, repositories.AuthEventFilter{UserID: user.ID, Type: models.AuthEventLogout})
+	require.NoError(t, err)
+	assert.Len(t, logouts, 1)
+
+	// Paginación hacia atrás
+	page, err := svc.LoginHistory(ctx, user.ID, history[0].ID, 10)
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	assert.Equal(t, history[1].ID, page[0].ID)
+}
+
+func TestAccountLockout(t *testing.T) {
+	ctx := context.Background()
+	lockouts := repotest.NewLockoutStore()
+	events := repotest.NewAuthEventStore()
+	svc := NewAuthService(repotest.NewUserStore(), repotest.NewSessionStore(), &config.Config{
+		JWTSecret:     "test-secret",
+		JWTExpiration: 15 * time.Minute,
+	}).WithEventLog(events).WithLockout(lockouts, LockoutPolicy{
+		UserThreshold: 3,
+		IPThreshold:   5,
+		BaseDuration:  time.Minute,
+		MaxDuration:   time.Hour,
+		Window:        15 * time.Minute,
+	})
+
+	_, err := svc.Register(ctx, "victim", "rightpass", "user")
+	require.NoError(t, err)
+
+	// Las fallas por debajo del umbral no bloquean y un login correcto las olvida
+	for i := 0; i < 2; i++ {
+		_, err = svc.Login(ctx, "victim", "wrongpass", "test-agent", "198.51.100.1")
+		assert.ErrorIs(t, err, apperrors.ErrInvalidCredentials)
+	}
+	_, err = svc.Login(ctx, "victim", "rightpass", "test-agent", "198.51.100.2")
+	require.NoError(t, err)
+
+	// Al llegar al umbral se bloquea incluso con la contraseña correcta
+	for i := 0; i < 3; i++ {
+		_, err = svc.Login(ctx, "victim", "wrongpass", "test-agent", "198.51.100.3")
+		assert.ErrorIs(t, err, apperrors.ErrInvalidCredentials)
+	}
+	_, err = svc.Login(ctx, "victim", "rightpass", "test-agent", "198.51.100.4")
+	var lockedErr *LockedError
+	require.ErrorAs(t, err, &lockedErr)
+	assert.ErrorIs(t, err, apperrors.ErrAccountLocked)
+	assert.InDelta(t, time.Minute.Seconds(), lockedErr.RetryAfter.Seconds(), 1)
+
+	failed := false
+	locked, err := svc.QueryAuthEvents(ctx, repositories.AuthEventFilter{Username: "victim", Success: &failed, Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, ReasonAccountLocked, locked[0].Reason)
+
+	// El admin lo desbloquea
+	require.NoError(t, svc.UnlockAccount(ctx, "victim"))
+	_, err = svc.Login(ctx, "victim", "rightpass", "test-agent", "198.51.100.4")
+	require.NoError(t, err)
+
+	// Por IP cuentan también los usuarios inexistentes
+	for i := 0; i < 5; i++ {
+		_, err = svc.Login(ctx, fmt.Sprintf("nobody%d", i), "pass", "test-agent", "203.0.113.9")
+		assert.ErrorIs(t, err, apperrors.ErrInvalidCredentials)
+	}
+	_, err = svc.Login(ctx, "victim", "rightpass", "test-agent", "203.0.113.9")
+	assert.ErrorIs(t, err, apperrors.ErrAccountLocked)
+	require.NoError(t, svc.UnlockIP(ctx, "203.0.113.9"))
+	_, err = svc.Login(ctx, "victim", "rightpass", "test-agent", "203.0.113.9")
+	assert.NoError(t, err)
+}
+
+func TestLockDuration(t *testing.T) {
+	policy := LockoutPolicy{BaseDuration: time.Minute, MaxDuration: 10 * time.Minute}
+	assert.Zero(t, policy.lockDuration(2, 3))
+	assert.Equal(t, time.Minute, policy.lockDuration(3, 3))
+	assert.Equal(t, 2*time.Minute, policy.lockDuration(4, 3))
+	assert.Equal(t, 8*time.Minute, policy.lockDuration(6, 3))
+	assert.Equal(t, 10*time.Minute, policy.lockDuration(50, 3))
+	assert.Zero(t, policy.lockDuration(50, 0))
+}
+
+type recordingRegistrationNotifier struct {
+	attempts []RegistrationAttempt
+}
+
+func (n *recordingRegistrationNotifier) NotifyRegistrationAttempt(ctx context.Context, attempt RegistrationAttempt) error {
+	n.attempts = append(n.attempts, attempt)
+	return nil
+}
+
+func TestUsernameEnumeration(t *testing.T) {
+	ctx := context.Background()
+	events := repotest.NewAuthEventStore()
+	notifier := &recordingRegistrationNotifier{}
+	svc := NewAuthService(repotest.NewUserStore(), repotest.NewSessionStore(), &config.Config{
+		JWTSecret:     "test-secret",
+		JWTExpiration: 15 * time.Minute,
+	}).WithEventLog(events).WithEnumerationSafeRegistration(notifier)
+
+	// El registro responde igual exista o no el usuario
+	user, err := svc.Register(ctx, "alice", "alicepass", "user")
+	require.NoError(t, err)
+	require.NotNil(t, user)
+	again, err := svc.Register(ctx, "alice", "otherpass", "user")
+	require.NoError(t, err)
+	assert.Nil(t, again)
+	require.Len(t, notifier.attempts, 1)
+	assert.Equal(t, user.ID, notifier.attempts[0].UserID)
+
+	// El intento no pisó la contraseña original
+	_, err = svc.Login(ctx, "alice", "alicepass", "test-agent", "127.0.0.1")
+	require.NoError(t, err)
+
+	// Usuario inexistente y contraseña incorrecta dan el mismo error, pero
+	// el log de eventos conserva el motivo real
+	_, errUnknown := svc.Login(ctx, "bob", "bobpassword", "test-agent", "127.0.0.1")
+	_, errWrong := svc.Login(ctx, "alice", "wrongpass", "test-agent", "127.0.0.1")
+	assert.Equal(t, apperrors.ErrInvalidCredentials, errUnknown)
+	assert.Equal(t, apperrors.ErrInvalidCredentials, errWrong)
+
+	failed := false
+	logged, err := svc.QueryAuthEvents(ctx, repositories.AuthEventFilter{Success: &failed})
+	require.NoError(t, err)
+	require.Len(t, logged, 2)
+	assert.Equal(t, ReasonInvalidPassword, logged[0].Reason)
+	assert.Equal(t, ReasonUserNotFound, logged[1].Reason)
+}
+
+func TestTOTPMFA(t *testing.T) {
+	ctx := context.Background()
+	events := repotest.NewAuthEventStore()
+	svc := NewAuthService(repotest.NewUserStore(), repotest.NewSessionStore(), &config.Config{
+		JWTSecret:     "test-secret",
+		JWTExpiration: 15 * time.Minute,
+	}).WithEventLog(events).WithMFA(repotest.NewMFAStore(), MFAPolicy{RequiredRoles: []string{"admin"}})
+
+	codeAt := func(secret string, offset time.Duration) string {
+		code, err := mfa.TOTPCode(secret, time.Now().Add(offset))
+		require.NoError(t, err)
+		return code
+	}
+
+	// Un usuario común sin TOTP entra sólo con la contraseña
+	user, err := svc.Register(ctx, "alice", "alicepass", "user")
+	require.NoError(t, err)
+	_, err = svc.Login(ctx, "alice", "alicepass", "test-agent", "127.0.0.1")
+	require.NoError(t, err)
+
+	// Enrolamiento voluntario
+	key, err := svc.EnrollTOTP(ctx, user.ID, user.Username)
+	require.NoError(t, err)
+	_, err = svc.ConfirmTOTP(ctx, user.ID, "000000")
+	assert.ErrorIs(t, err, apperrors.ErrInvalidMFACode)
+	recovery, err := svc.ConfirmTOTP(ctx, user.ID, codeAt(key.Secret, -30*time.Second))
+	require.NoError(t, err)
+	assert.Len(t, recovery, mfa.RecoveryCodeCount)
+	_, err = svc.EnrollTOTP(ctx, user.ID, user.Username)
+	assert.ErrorIs(t, err, apperrors.ErrMFAAlreadyEnabled)
+
+	// Ahora el login pide el segundo factor
+	_, err = svc.Login(ctx, "alice", "alicepass", "test-agent", "127.0.0.1")
+	var mfaErr *MFARequiredError
+	require.ErrorAs(t, err, &mfaErr)
+	assert.False(t, mfaErr.Enroll)
+
+	// Un challenge no sirve como token de acceso
+	_, _, err = svc.ValidateToken(ctx, mfaErr.Challenge)
+	assert.Error(t, err)
+
+	_, err = svc.CompleteMFALogin(ctx, mfaErr.Challenge, "000000", "", "test-agent", "127.0.0.1", LoginOptions{})
+	assert.ErrorIs(t, err, apperrors.ErrInvalidMFACode)
+
+	result, err := svc.CompleteMFALogin(ctx, mfaErr.Challenge, codeAt(key.Secret, 0), "", "test-agent", "127.0.0.1", LoginOptions{})
+	require.NoError(t, err)
+	_, _, err = svc.ValidateToken(ctx, result.Token)
+	require.NoError(t, err)
+
+	// El challenge es de un solo uso
+	_, err = svc.CompleteMFALogin(ctx, mfaErr.Challenge, codeAt(key.Secret, 30*time.Second), "", "test-agent", "127.0.0.1", LoginOptions{})
+	assert.ErrorIs(t, err, apperrors.ErrMFAChallengeInvalid)
+
+	// El mismo código TOTP no sirve dos veces, un código de recuperación sí
+	// una vez
+	_, err = svc.Login(ctx, "alice", "alicepass", "test-agent", "127.0.0.1")
+	require.ErrorAs(t, err, &mfaErr)
+	_, err = svc.CompleteMFALogin(ctx, mfaErr.Challenge, codeAt(key.Secret, 0), "", "test-agent", "127.0.0.1", LoginOptions{})
+	assert.ErrorIs(t, err, apperrors.ErrInvalidMFACode)
+	_, err = svc.CompleteMFALogin(ctx, mfaErr.Challenge, "", recovery[0], "test-agent", "127.0.0.1", LoginOptions{})
+	require.NoError(t, err)
+
+	_, err = svc.Login(ctx, "alice", "alicepass", "test-agent", "127.0.0.1")
+	require.ErrorAs(t, err, &mfaErr)
+	_, err = svc.CompleteMFALogin(ctx, mfaErr.Challenge, "", recovery[0], "test-agent", "127.0.0.1", LoginOptions{})
+	assert.ErrorIs(t, err, apperrors.ErrInvalidMFACode)
+
+	status, err := svc.MFAStatus(ctx, user.ID, user.Role)
+	require.NoError(t, err)
+	assert.True(t, status.Enabled)
+	assert.False(t, status.Required)
+	assert.Equal(t, mfa.RecoveryCodeCount-1, status.RecoveryCodesRemaining)
+
+	// Un admin sin TOTP debe enrolarse antes de entrar
+	admin, err := svc.Register(ctx, "root", "rootpass", "admin")
+	require.NoError(t, err)
+	_, err = svc.Login(ctx, "root", "rootpass", "test-agent", "127.0.0.1")
+	require.ErrorAs(t, err, &mfaErr)
+	assert.True(t, mfaErr.Enroll)
+
+	adminKey, err := svc.EnrollTOTPWithChallenge(ctx, mfaErr.Challenge)
+	require.NoError(t, err)
+	_, err = svc.CompleteMFALogin(ctx, mfaErr.Challenge, "", "whatever", "test-agent", "127.0.0.1", LoginOptions{})
+	assert.ErrorIs(t, err, apperrors.ErrInvalidMFACode)
+	result, err = svc.CompleteMFALogin(ctx, mfaErr.Challenge, codeAt(adminKey.Secret, 0), "", "test-agent", "127.0.0.1", LoginOptions{})
+	require.NoError(t, err)
+	assert.NotEmpty(t, result.Token)
+	assert.Len(t, result.RecoveryCodes, mfa.RecoveryCodeCount)
+
+	status, err = svc.MFAStatus(ctx, admin.ID, admin.Role)
+	require.NoError(t, err)
+	assert.True(t, status.Enabled)
+	assert.True(t, status.Required)
+
+	// El log distingue el paso intermedio y marca los logins con MFA
+	logged, err := svc.QueryAuthEvents(ctx, repositories.AuthEventFilter{Username: "root"})
+	require.NoError(t, err)
+	require.NotEmpty(t, logged)
+	assert.True(t, logged[0].Success)
+	assert.True(t, logged[0].MFA)
+	assert.Equal(t, ReasonMFARequired, logged[len(logged)-1].Reason)
+}
+
+func TestPasskeys(t *testing.T) {
+	ctx := context.Background()
+	wa, err := webauthn.New(&webauthn.Config{
+		RPID:          "auth.example.com",
+		RPDisplayName: "JWT Auth API",
+		RPOrigins:     []string{"https://auth.example.com"},
+	})
+	require.NoError(t, err)
+	events := repotest.NewAuthEventStore()
+	passkeys := repotest.NewWebAuthnStore()
+	svc := NewAuthService(repotest.NewUserStore(), repotest.NewSessionStore(), &config.Config{
+		JWTSecret:     "test-secret",
+		JWTExpiration: 15 * time.Minute,
+	}).WithEventLog(events).WithMFA(repotest.NewMFAStore(), MFAPolicy{}).WithWebAuthn(wa, passkeys)
+
+	user, err := svc.Register(ctx, "alice", "alicepass", "user")
+	require.NoError(t, err)
+	authenticator := newSoftAuthenticator(t, "auth.example.com", "https://auth.example.com")
+
+	// Registro
+	ceremony, err := svc.BeginPasskeyRegistration(ctx, user.ID)
+	require.NoError(t, err)
+	credential, err := svc.FinishPasskeyRegistration(ctx, user.ID, ceremony.Token, "laptop", authenticator.create(ceremony.Options))
+	require.NoError(t, err)
+	assert.Equal(t, "laptop", credential.Name)
+
+	// La ceremonia es de un solo uso y de un solo usuario
+	_, err = svc.FinishPasskeyRegistration(ctx, user.ID, ceremony.Token, "again", authenticator.create(ceremony.Options))
+	assert.ErrorIs(t, err, apperrors.ErrPasskeyInvalid)
+	other, err := svc.Register(ctx, "bob", "bobpassword", "user")
+	require.NoError(t, err)
+	ceremony, err = svc.BeginPasskeyRegistration(ctx, user.ID)
+	require.NoError(t, err)
+	_, err = svc.FinishPasskeyRegistration(ctx, other.ID, ceremony.Token, "stolen", authenticator.create(ceremony.Options))
+	assert.ErrorIs(t, err, apperrors.ErrPasskeyInvalid)
+
+	// Login sin contraseña: la passkey verificó al usuario, cuenta como MFA
+	ceremony, err = svc.BeginPasskeyLogin(ctx)
+	require.NoError(t, err)
+	token, err := svc.FinishPasskeyLogin(ctx, ceremony.Token, authenticator.get(ceremony.Options), "test-agent", "127.0.0.1", LoginOptions{})
+	require.NoError(t, err)
+	userID, _, err := svc.ValidateToken(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, userID)
+
+	history, err := svc.LoginHistory(ctx, user.ID, 0, 10)
+	require.NoError(t, err)
+	require.NotEmpty(t, history)
+	assert.Equal(t, LoginMethodPasskey, history[0].Method)
+	assert.True(t, history[0].MFA)
+
+	// Con una passkey registrada, la contraseña sola ya no alcanza
+	_, err = svc.Login(ctx, "alice", "alicepass", "test-agent", "127.0.0.1")
+	var mfaErr *MFARequiredError
+	require.ErrorAs(t, err, &mfaErr)
+	assert.Equal(t, []string{SecondFactorPasskey}, mfaErr.Methods)
+
+	ceremony, err = svc.BeginPasskeySecondFactor(ctx, mfaErr.Challenge)
+	require.NoError(t, err)
+	result, err := svc.FinishPasskeySecondFactor(ctx, mfaErr.Challenge, ceremony.Token, authenticator.get(ceremony.Options), "test-agent", "127.0.0.1", LoginOptions{})
+	require.NoError(t, err)
+	_, _, err = svc.ValidateToken(ctx, result.Token)
+	require.NoError(t, err)
+
+	// Un contador que no avanza delata un clon: la passkey queda inutilizable
+	ceremony, err = svc.BeginPasskeyLogin(ctx)
+	require.NoError(t, err)
+	authenticator.counter = 0
+	_, err = svc.FinishPasskeyLogin(ctx, ceremony.Token, authenticator.get(ceremony.Options), "test-agent", "127.0.0.1", LoginOptions{})
+	assert.ErrorIs(t, err, apperrors.ErrPasskeyInvalid)
+
+	ceremony, err = svc.BeginPasskeyLogin(ctx)
+	require.NoError(t, err)
+	authenticator.counter = 100
+	_, err = svc.FinishPasskeyLogin(ctx, ceremony.Token, authenticator.get(ceremony.Options), "test-agent", "127.0.0.1", LoginOptions{})
+	assert.ErrorIs(t, err, apperrors.ErrPasskeyInvalid)
+
+	stored, err := svc.ListPasskeys(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, stored, 1)
+	assert.True(t, stored[0].CloneWarning)
+
+	// Borrarla es de su dueño
+	assert.ErrorIs(t, svc.DeletePasskey(ctx, other.ID, stored[0].ID), apperrors.ErrPasskeyNotFound)
+	require.NoError(t, svc.DeletePasskey(ctx, user.ID, stored[0].ID))
+	_, err = svc.Login(ctx, "alice", "alicepass", "test-agent", "127.0.0.1")
+	require.NoError(t, err)
+}
+
+// linkToken saca el token del último link enviado a to
+func linkToken(t *testing.T, mailer *mail.MemoryMailer, to string) string {
+	msg, ok := mailer.Last(to)
+	require.True(t, ok, "no se envió correo a %s", to)
+	link := regexp.MustCompile(`https?://\S+`).FindString(msg.Body)
+	u, err := url.Parse(link)
+	require.NoError(t, err)
+	return u.Query().Get("token")
+}
+
+func TestEmailVerification(t *testing.T) {
+	ctx := context.Background()
+	mailer := mail.NewMemoryMailer()
+	svc := NewAuthService(repotest.NewUserStore(), repotest.NewSessionStore(), &config.Config{
+		JWTSecret:     "test-secret",
+		JWTExpiration: 15 * time.Minute,
+	}).WithEmailVerification(EmailVerification{
+		Mailer:  mailer,
+		LinkURL: "https://app.example.com/verify?source=mail",
+		TTL:     time.Hour,
+		Policy:  EmailPolicyBlock,
+	})
+
+	// Con la política activa el email es obligatorio y se normaliza
+	_, err := svc.Register(ctx, "alice", "alicepass", "user")
+	assert.ErrorIs(t, err, apperrors.ErrInvalidEmail)
+	_, err = svc.RegisterWithEmail(ctx, "alice", "alicepass", "user", "Alice <alice@example.com>")
+	assert.ErrorIs(t, err, apperrors.ErrInvalidEmail)
+	user, err := svc.RegisterWithEmail(ctx, "alice", "alicepass", "user", " Alice@Example.com ")
+	require.NoError(t, err)
+	require.NotNil(t, user.Email)
+	assert.Equal(t, "alice@example.com", *user.Email)
+	_, err = svc.RegisterWithEmail(ctx, "alice2", "alicepass", "user", "alice@example.com")
+	assert.ErrorIs(t, err, apperrors.ErrEmailTaken)
+
+	svc.WaitMail()
+	msg, ok := mailer.Last("alice@example.com")
+	require.True(t, ok)
+	assert.Contains(t, msg.Body, "https://app.example.com/verify?source=mail&token=")
+
+	// Sin verificar no entra; con la contraseña mal no se entera del motivo
+	_, err = svc.Login(ctx, "alice", "alicepass", "test-agent", "127.0.0.1")
+	assert.ErrorIs(t, err, apperrors.ErrEmailNotVerified)
+	_, err = svc.Login(ctx, "alice", "wrong", "test-agent", "127.0.0.1")
+	assert.ErrorIs(t, err, apperrors.ErrInvalidCredentials)
+
+	token := linkToken(t, mailer, "alice@example.com")
+	assert.ErrorIs(t, svc.VerifyEmail(ctx, token+"x"), apperrors.ErrVerificationLinkInvalid)
+	require.NoError(t, svc.VerifyEmail(ctx, token))
+	assert.ErrorIs(t, svc.VerifyEmail(ctx, token), apperrors.ErrVerificationLinkInvalid, "el link es de un solo uso")
+
+	_, err = svc.Login(ctx, "alice", "alicepass", "test-agent", "127.0.0.1")
+	require.NoError(t, err)
+	email, verified, err := svc.EmailStatus(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "alice@example.com", email)
+	assert.True(t, verified)
+
+	// Cambiar de email vuelve a pedir verificación, y un link pendiente del
+	// email anterior deja de servir
+	require.NoError(t, svc.ChangeEmail(ctx, user.ID, "alice@work.example.com"))
+	_, verified, err = svc.EmailStatus(ctx, user.ID)
+	require.NoError(t, err)
+	assert.False(t, verified)
+	assert.ErrorIs(t, svc.RequireVerifiedEmail(ctx, user.ID), apperrors.ErrEmailNotVerified)
+
+	pending := linkToken(t, mailer, "alice@work.example.com")
+	require.NoError(t, svc.ChangeEmail(ctx, user.ID, "alice@home.example.com"))
+	assert.ErrorIs(t, svc.VerifyEmail(ctx, pending), apperrors.ErrVerificationLinkInvalid)
+
+	require.NoError(t, svc.ResendEmailVerification(ctx, user.ID))
+	require.NoError(t, svc.VerifyEmail(ctx, linkToken(t, mailer, "alice@home.example.com")))
+	assert.NoError(t, svc.RequireVerifiedEmail(ctx, user.ID))
+
+	// Un error del mailer no deshace el alta
+	mailer.Err = errors.New("smtp down")
+	_, err = svc.RegisterWithEmail(ctx, "bob", "bobpassword", "user", "bob@example.com")
+	require.NoError(t, err)
+	svc.WaitMail()
+	mailer.Err = nil
+}
+
+// blockingMailer no termina de enviar hasta que se cierra release
+type blockingMailer struct {
+	release chan struct{}
+	sent    chan mail.Message
+}
+
+func (m *blockingMailer) Send(ctx context.Context, msg mail.Message) error {
+	<-m.release
+	m.sent <- msg
+	return nil
+}
+
+func TestRegistrationDoesNotWaitForMailer(t *testing.T) {
+	ctx := context.Background()
+	mailer := &blockingMailer{release: make(chan struct{}), sent: make(chan mail.Message, 1)}
+	svc := NewAuthService(repotest.NewUserStore(), repotest.NewSessionStore(), &config.Config{
+		JWTSecret:     "test-secret",
+		JWTExpiration: 15 * time.Minute,
+	}).WithEmailVerification(EmailVerification{
+		Mailer:  mailer,
+		LinkURL: "https://app.example.com/verify",
+		TTL:     time.Hour,
+	})
+
+	// El alta responde aunque el mailer siga colgado: si esperara al envío,
+	// una cuenta nueva tardaría más que una ya existente
+	done := make(chan error, 1)
+	go func() {
+		_, err := svc.RegisterWithEmail(ctx, "alice", "alicepass", "user", "alice@example.com")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("el registro esperó al mailer")
+	}
+
+	close(mailer.release)
+	svc.WaitMail()
+	select {
+	case msg := <-mailer.sent:
+		assert.Equal(t, "alice@example.com", msg.To)
+	default:
+		t.Fatal("WaitMail volvió antes de terminar el envío")
+	}
+}
+
+func TestRequestEmailVerification(t *testing.T) {
+	ctx := context.Background()
+	mailer := mail.NewMemoryMailer()
+	users := repotest.NewUserStore()
+	cfg := &config.Config{
+		JWTSecret:     "test-secret",
+		JWTExpiration: 15 * time.Minute,
+	}
+
+	// Una cuenta creada antes de que existiera el email
+	legacy, err := NewAuthService(users, repotest.NewSessionStore(), cfg).Register(ctx, "legacy", "legacypass", "user")
+	require.NoError(t, err)
+
+	svc := NewAuthService(users, repotest.NewSessionStore(), cfg).
+		WithLockout(repotest.NewLockoutStore(), LockoutPolicy{UserThreshold: 3, Window: time.Hour, BaseDuration: time.Minute, MaxDuration: time.Hour}).
+		WithEmailVerification(EmailVerification{
+			Mailer:  mailer,
+			LinkURL: "https://app.example.com/verify",
+			TTL:     time.Hour,
+			Policy:  EmailPolicyBlock,
+		})
+	_, err = svc.Login(ctx, "legacy", "legacypass", "test-agent", "127.0.0.1")
+	assert.ErrorIs(t, err, apperrors.ErrEmailNotVerified)
+
+	// Sin la contraseña correcta la respuesta es la misma que para un
+	// usuario inexistente y no se envía nada
+	require.NoError(t, svc.RequestEmailVerification(ctx, "legacy", "wrong", "legacy@example.com", "127.0.0.1"))
+	require.NoError(t, svc.RequestEmailVerification(ctx, "ghost", "ghostpass", "ghost@example.com", "127.0.0.1"))
+	assert.Empty(t, mailer.Messages())
+
+	// Sin email hay que indicar uno; con la contraseña se agrega y se envía
+	// el link
+	assert.ErrorIs(t, svc.RequestEmailVerification(ctx, "legacy", "legacypass", "", "127.0.0.1"), apperrors.ErrEmailMissing)
+	require.NoError(t, svc.RequestEmailVerification(ctx, "legacy", "legacypass", "Legacy@Example.com", "127.0.0.1"))
+	first := linkToken(t, mailer, "legacy@example.com")
+
+	// Un link perdido se puede pedir de nuevo sin indicar el email
+	require.NoError(t, svc.RequestEmailVerification(ctx, "legacy", "legacypass", "", "127.0.0.1"))
+	require.NoError(t, svc.VerifyEmail(ctx, linkToken(t, mailer, "legacy@example.com")))
+	require.NoError(t, svc.VerifyEmail(ctx, first), "ambos links son del mismo email")
+	_, err = svc.Login(ctx, "legacy", "legacypass", "test-agent", "127.0.0.1")
+	require.NoError(t, err)
+
+	// Con el email ya verificado no se reemplaza por este camino
+	sent := len(mailer.Messages())
+	require.NoError(t, svc.RequestEmailVerification(ctx, "legacy", "legacypass", "other@example.com", "127.0.0.1"))
+	assert.Len(t, mailer.Messages(), sent)
+	email, _, err := svc.EmailStatus(ctx, legacy.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "legacy@example.com", email)
+
+	// Las contraseñas equivocadas cuentan para el bloqueo
+	for i := 0; i < 2; i++ {
+		require.NoError(t, svc.RequestEmailVerification(ctx, "ghost", "ghostpass", "", "127.0.0.1"))
+	}
+	assert.ErrorIs(t, svc.RequestEmailVerification(ctx, "ghost", "ghostpass", "", "127.0.0.1"), apperrors.ErrAccountLocked)
+}
+
+func TestPurposeTokenReplay(t *testing.T) {
+	ctx := context.Background()
+	svc := NewAuthService(repotest.NewUserStore(), repotest.NewSessionStore(), &config.Config{
+		JWTSecret:     "test-secret",
+		JWTExpiration: 15 * time.Minute,
+	})
+
+	// Dos requests con el mismo link pasan la validación antes de que
+	// cualquiera lo consuma; el segundo en consumirlo recibe el error del
+	// link, no un error interno
+	token, _, err := svc.signPurposeToken(purposeMagicLink, jwt.MapClaims{"user_id": 1}, time.Minute)
+	require.NoError(t, err)
+	_, first, err := svc.parsePurposeToken(ctx, purposeMagicLink, token, apperrors.ErrMagicLinkInvalid)
+	require.NoError(t, err)
+	_, second, err := svc.parsePurposeToken(ctx, purposeMagicLink, token, apperrors.ErrMagicLinkInvalid)
+	require.NoError(t, err)
+
+	require.NoError(t, svc.consumePurposeToken(ctx, first, apperrors.ErrMagicLinkInvalid))
+	assert.ErrorIs(t, svc.consumePurposeToken(ctx, second, apperrors.ErrMagicLinkInvalid), apperrors.ErrMagicLinkInvalid)
+}
+
+func TestPasswordReset(t *testing.T) {
+	ctx := context.Background()
+	mailer := mail.NewMemoryMailer()
+	users := repotest.NewUserStore()
+	resets := repotest.NewPasswordResetStore()
+	events := repotest.NewAuthEventStore()
+	cfg := &config.Config{
+		JWTSecret:     "test-secret",
+		JWTExpiration: 15 * time.Minute,
+	}
+	svc := NewAuthService(users, repotest.NewSessionStore(), cfg).
+		WithEventLog(events).
+		WithPasswordReset(resets, PasswordReset{
+			Mailer:  mailer,
+			LinkURL: "https://app.example.com/reset",
+			TTL:     time.Hour,
+		})
+
+	user, err := svc.RegisterWithEmail(ctx, "alice", "alicepass", "user", "alice@example.com")
+	require.NoError(t, err)
+	token, err := svc.Login(ctx, "alice", "alicepass", "test-agent", "127.0.0.1")
+	require.NoError(t, err)
+
+	// Un email desconocido responde igual y no envía nada
+	require.NoError(t, svc.RequestPasswordReset(ctx, "ghost@example.com"))
+	svc.WaitMail()
+	assert.Empty(t, mailer.Messages())
+
+	// Un error del mailer tampoco llega a la respuesta
+	mailer.Err = errors.New("smtp down")
+	require.NoError(t, svc.RequestPasswordReset(ctx, "alice@example.com"))
+	svc.WaitMail()
+	mailer.Err = nil
+
+	require.NoError(t, svc.RequestPasswordReset(ctx, "Alice@Example.com"))
+	svc.WaitMail()
+	stale := linkToken(t, mailer, "alice@example.com")
+	require.NoError(t, svc.RequestPasswordReset(ctx, "alice@example.com"))
+	svc.WaitMail()
+	reset := linkToken(t, mailer, "alice@example.com")
+	assert.ErrorIs(t, svc.ResetPassword(ctx, stale, "newpassword", "test-agent", "127.0.0.1"), apperrors.ErrResetTokenInvalid,
+		"un link nuevo invalida el anterior")
+
+	assert.ErrorIs(t, svc.ResetPassword(ctx, reset, "short", "test-agent", "127.0.0.1"), apperrors.ErrWeakPassword)
+	assert.ErrorIs(t, svc.ResetPassword(ctx, reset+"x", "newpassword", "test-agent", "127.0.0.1"), apperrors.ErrResetTokenInvalid)
+
+	// Una falla de la base no hace pasar el link por vencido ni lo gasta
+	users.Err = errors.New("base caída")
+	err = svc.ResetPassword(ctx, reset, "newpassword", "test-agent", "127.0.0.1")
+	assert.ErrorIs(t, err, users.Err)
+	assert.NotErrorIs(t, err, apperrors.ErrResetTokenInvalid)
+	users.Err = nil
+
+	require.NoError(t, svc.ResetPassword(ctx, reset, "newpassword", "test-agent", "127.0.0.1"))
+	assert.ErrorIs(t, svc.ResetPassword(ctx, reset, "otherpassword", "test-agent", "127.0.0.1"), apperrors.ErrResetTokenInvalid,
+		"el link es de un solo uso")
+
+	// Las sesiones abiertas antes del cambio quedan revocadas
+	_, _, err = svc.ValidateToken(ctx, token)
+	assert.Error(t, err)
+	_, err = svc.Login(ctx, "alice", "alicepass", "test-agent", "127.0.0.1")
+	assert.ErrorIs(t, err, apperrors.ErrInvalidCredentials)
+	_, err = svc.Login(ctx, "alice", "newpassword", "test-agent", "127.0.0.1")
+	require.NoError(t, err)
+
+	recorded, err := svc.QueryAuthEvents(ctx, repositories.AuthEventFilter{UserID: user.ID, Type: models.AuthEventPasswordReset})
+	require.NoError(t, err)
+	assert.Len(t, recorded, 1)
+
+	// Un link vencido no sirve
+	expired := NewAuthService(users, repotest.NewSessionStore(), cfg).
+		WithPasswordReset(resets, PasswordReset{Mailer: mailer, LinkURL: "https://app.example.com/reset", TTL: -time.Minute})
+	require.NoError(t, expired.RequestPasswordReset(ctx, "alice@example.com"))
+	expired.WaitMail()
+	assert.ErrorIs(t, expired.ResetPassword(ctx, linkToken(t, mailer, "alice@example.com"), "thirdpassword", "test-agent", "127.0.0.1"),
+		apperrors.ErrResetTokenInvalid)
+
+	// Sin configurar, la recuperación no está disponible
+	disabled := NewAuthService(users, repotest.NewSessionStore(), cfg)
+	assert.ErrorIs(t, disabled.RequestPasswordReset(ctx, "alice@example.com"), apperrors.ErrPasswordResetDisabled)
+}
+
+func TestChangePassword(t *testing.T) {
+	ctx := context.Background()
+	events := repotest.NewAuthEventStore()
+	svc := NewAuthService(repotest.NewUserStore(), repotest.NewSessionStore(), &config.Config{
+		JWTSecret:     "test-secret",
+		JWTExpiration: 15 * time.Minute,
+	}).WithEventLog(events)
+
+	user, err := svc.Register(ctx, "alice", "alicepass", "user")
+	require.NoError(t, err)
+	current, err := svc.Login(ctx, "alice", "alicepass", "laptop", "127.0.0.1")
+	require.NoError(t, err)
+	other, err := svc.Login(ctx, "alice", "alicepass", "phone", "127.0.0.1")
+	require.NoError(t, err)
+	claims, err := svc.Authenticate(ctx, current)
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, svc.ChangePassword(ctx, user.ID, claims.SessionID, "wrong", "newpassword", "laptop", "127.0.0.1"),
+		apperrors.ErrCurrentPasswordInvalid)
+	assert.ErrorIs(t, svc.ChangePassword(ctx, user.ID, claims.SessionID, "alicepass", "", "laptop", "127.0.0.1"),
+		apperrors.ErrWeakPassword)
+	assert.ErrorIs(t, svc.ChangePassword(ctx, user.ID, claims.SessionID, "alicepass", "short", "laptop", "127.0.0.1"),
+		apperrors.ErrWeakPassword)
+	_, err = svc.Authenticate(ctx, other)
+	require.NoError(t, err, "un intento fallido no cierra nada")
+
+	require.NoError(t, svc.ChangePassword(ctx, user.ID, claims.SessionID, "alicepass", "newpassword", "laptop", "127.0.0.1"))
+
+	// La sesión desde la que se cambió sigue; las otras no
+	_, err = svc.Authenticate(ctx, current)
+	assert.NoError(t, err)
+	_, err = svc.Authenticate(ctx, other)
+	assert.Error(t, err)
+
+	_, err = svc.Login(ctx, "alice", "alicepass", "laptop", "127.0.0.1")
+	assert.ErrorIs(t, err, apperrors.ErrInvalidCredentials)
+	_, err = svc.Login(ctx, "alice", "newpassword", "laptop", "127.0.0.1")
+	require.NoError(t, err)
+
+	recorded, err := svc.QueryAuthEvents(ctx, repositories.AuthEventFilter{UserID: user.ID, Type: models.AuthEventPasswordChange})
+	require.NoError(t, err)
+	assert.Len(t, recorded, 1)
+}
+
+// fakeBreached cuenta las contraseñas de un mapa
+type fakeBreached map[string]int
+
+func (f fakeBreached) Count(ctx context.Context, password string) (int, error) {
+	return f[password], nil
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	ctx := context.Background()
+	mailer := mail.NewMemoryMailer()
+	svc := NewAuthService(repotest.NewUserStore(), repotest.NewSessionStore(), &config.Config{
+		JWTSecret:     "test-secret",
+		JWTExpiration: 15 * time.Minute,
+	}).WithPasswordPolicy(PasswordPolicy{
+		MinLength:        10,
+		MaxBytes:         72,
+		RequiredClasses:  []string{PasswordClassLower, PasswordClassUpper, PasswordClassDigit, PasswordClassSymbol},
+		DisallowUsername: true,
+		Breached:         fakeBreached{"Password123!": 42, "Rare-Passw0rd": 1},
+		BreachedMinCount: 2,
+	}).WithPasswordReset(repotest.NewPasswordResetStore(), PasswordReset{
+		Mailer:  mailer,
+		LinkURL: "https://app.example.com/reset",
+		TTL:     time.Hour,
+	})
+
+	rules := func(err error) []string {
+		var policyErr *PasswordPolicyError
+		require.ErrorAs(t, err, &policyErr)
+		assert.ErrorIs(t, err, apperrors.ErrWeakPassword)
+		var names []string
+		for _, v := range policyErr.Violations {
+			names = append(names, v.Rule)
+		}
+		return names
+	}
+
+	// Se informan todas las reglas incumplidas juntas
+	_, err := svc.Register(ctx, "alice", "", "user")
+	assert.Equal(t, []string{PasswordRuleMinLength, PasswordRuleLowercase, PasswordRuleUppercase, PasswordRuleDigit, PasswordRuleSymbol}, rules(err))
+	_, err = svc.Register(ctx, "alice", "my-ALICE-pass1", "user")
+	assert.Equal(t, []string{PasswordRuleContainsUsername}, rules(err))
+	_, err = svc.Register(ctx, "alice", strings.Repeat("aA1!", 19), "user")
+	assert.Equal(t, []string{PasswordRuleMaxLength}, rules(err))
+	_, err = svc.Register(ctx, "alice", "Password123!", "user")
+	assert.Equal(t, []string{PasswordRuleBreached}, rules(err))
+
+	// Por debajo del umbral de apariciones se acepta
+	user, err := svc.RegisterWithEmail(ctx, "alice", "Rare-Passw0rd", "user", "alice@example.com")
+	require.NoError(t, err)
+
+	token, err := svc.Login(ctx, "alice", "Rare-Passw0rd", "test-agent", "127.0.0.1")
+	require.NoError(t, err)
+	claims, err := svc.Authenticate(ctx, token)
+	require.NoError(t, err)
+	err = svc.ChangePassword(ctx, user.ID, claims.SessionID, "Rare-Passw0rd", "alice-Passw0rd!", "test-agent", "127.0.0.1")
+	assert.Equal(t, []string{PasswordRuleContainsUsername}, rules(err))
+
+	// Una contraseña rechazada no gasta el link de recuperación
+	require.NoError(t, svc.RequestPasswordReset(ctx, "alice@example.com"))
+	svc.WaitMail()
+	reset := linkToken(t, mailer, "alice@example.com")
+	err = svc.ResetPassword(ctx, reset, "Password123!", "test-agent", "127.0.0.1")
+	assert.Equal(t, []string{PasswordRuleBreached}, rules(err))
+	require.NoError(t, svc.ResetPassword(ctx, reset, "Brand-new-Passw0rd", "test-agent", "127.0.0.1"))
+
+	// Sin política configurada rige la de por defecto
+	defaults := NewAuthService(repotest.NewUserStore(), repotest.NewSessionStore(), &config.Config{})
+	_, err = defaults.Register(ctx, "bob", "", "user")
+	assert.Equal(t, []string{PasswordRuleMinLength}, rules(err))
+}
+
+func TestPasswordRehashOnLogin(t *testing.T) {
+	ctx := context.Background()
+	users := repotest.NewUserStore()
+	svc := NewAuthService(users, repotest.NewSessionStore(), &config.Config{
+		JWTSecret:     "test-secret",
+		JWTExpiration: 15 * time.Minute,
+	})
+
+	// Usuario con un hash de bcrypt en Modular Crypt Format, de antes de
+	// passhash
+	legacy, err := bcrypt.GenerateFromPassword([]byte("alicepass"), bcrypt.MinCost)
+	require.NoError(t, err)
+	require.NoError(t, users.CreateUser(ctx, &models.User{Username: "alice", Password: string(legacy), Role: "user"}))
+	stored, err := users.FindUserByUsername(ctx, "alice")
+	require.NoError(t, err)
+
+	svc.WithPasswordHasher(passhash.NewArgon2id(passhash.Argon2idParams{Memory: 64, Iterations: 1, Parallelism: 1}))
+
+	// Un login fallido no toca el hash
+	_, err = svc.Login(ctx, "alice", "wrongpass", "test-agent", "127.0.0.1")
+	assert.ErrorIs(t, err, apperrors.ErrInvalidCredentials)
+	stored, err = users.FindUserByUsername(ctx, "alice")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(stored.Password, "$2a$"))
+
+	_, err = svc.Login(ctx, "alice", "alicepass", "test-agent", "127.0.0.1")
+	require.NoError(t, err)
+	stored, err = users.FindUserByUsername(ctx, "alice")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(stored.Password, "$argon2id$v=19$m=64,t=1,p=1$"), stored.Password)
+	upgraded := stored.Password
+
+	// Con los parámetros al día no se vuelve a hashear
+	_, err = svc.Login(ctx, "alice", "alicepass", "test-agent", "127.0.0.1")
+	require.NoError(t, err)
+	stored, err = users.FindUserByUsername(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, upgraded, stored.Password)
+
+	// Subir el costo vuelve a regenerarlo
+	svc.WithPasswordHasher(passhash.NewArgon2id(passhash.Argon2idParams{Memory: 128, Iterations: 1, Parallelism: 1}))
+	_, err = svc.Login(ctx, "alice", "alicepass", "test-agent", "127.0.0.1")
+	require.NoError(t, err)
+	stored, err = users.FindUserByUsername(ctx, "alice")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(stored.Password, "$argon2id$v=19$m=128,t=1,p=1$"), stored.Password)
+
+	// Las contraseñas nuevas ya salen con el hasher configurado
+	_, err = svc.Register(ctx, "bob", "bobpassword", "user")
+	require.NoError(t, err)
+	stored, err = users.FindUserByUsername(ctx, "bob")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(stored.Password, "$argon2id$"))
+}
+
+func TestEqualizeTimingWithLegacyHashes(t *testing.T) {
+	ctx := context.Background()
+	cheap := passhash.NewArgon2id(passhash.Argon2idParams{Memory: 64, Iterations: 1, Parallelism: 1})
+
+	// Con hashes de bcrypt en la base, en PHC o en Modular Crypt Format, un
+	// usuario inexistente tarda lo que bcrypt y no lo que el argon2id barato
+	users := repotest.NewUserStore()
+	_, err := NewAuthService(users, repotest.NewSessionStore(), &config.Config{}).
+		WithPasswordHasher(passhash.NewBcrypt(bcrypt.DefaultCost)).
+		Register(ctx, "alice", "alicepass", "user")
+	require.NoError(t, err)
+	svc := NewAuthService(users, repotest.NewSessionStore(), &config.Config{}).WithPasswordHasher(cheap)
+	svc.equalizeTiming(ctx, "whatever")
+	assert.True(t, strings.HasPrefix(svc.dummyHash, "$bcrypt$"), svc.dummyHash)
+
+	users = repotest.NewUserStore()
+	legacy, err := bcrypt.GenerateFromPassword([]byte("alicepass"), bcrypt.DefaultCost)
+	require.NoError(t, err)
+	require.NoError(t, users.CreateUser(ctx, &models.User{Username: "alice", Password: string(legacy), Role: "user"}))
+	svc = NewAuthService(users, repotest.NewSessionStore(), &config.Config{}).WithPasswordHasher(cheap)
+	svc.equalizeTiming(ctx, "whatever")
+	assert.True(t, strings.HasPrefix(svc.dummyHash, "$bcrypt$"), svc.dummyHash)
+
+	// Sin hashes de bcrypt alcanza con el hasher actual
+	users = repotest.NewUserStore()
+	svc = NewAuthService(users, repotest.NewSessionStore(), &config.Config{}).WithPasswordHasher(cheap)
+	_, err = svc.Register(ctx, "bob", "bobpassword", "user")
+	require.NoError(t, err)
+	svc.equalizeTiming(ctx, "whatever")
+	assert.True(t, strings.HasPrefix(svc.dummyHash, "$argon2id$"), svc.dummyHash)
+}
+
+func TestMagicLink(t *testing.T) {
+	ctx := context.Background()
+	mailer := mail.NewMemoryMailer()
+	events := repotest.NewAuthEventStore()
+	svc := NewAuthService(repotest.NewUserStore(), repotest.NewSessionStore(), &config.Config{
+		JWTSecret:     "test-secret",
+		JWTExpiration: 15 * time.Minute,
+	}).WithEventLog(events).WithMagicLink(MagicLink{
+		Mailer:  mailer,
+		LinkURL: "https://app.example.com/login/magic",
+		TTL:     15 * time.Minute,
+	})
+
+	user, err := svc.RegisterWithEmail(ctx, "alice", "alicepass", "user", "alice@example.com")
+	require.NoError(t, err)
+
+	// Un email desconocido responde igual y no envía nada
+	binding, err := svc.RequestMagicLink(ctx, "ghost@example.com")
+	require.NoError(t, err)
+	svc.WaitMail()
+	assert.Empty(t, binding)
+	assert.Empty(t, mailer.Messages())
+
+	// Un error del mailer tampoco llega a la respuesta
+	mailer.Err = errors.New("smtp down")
+	_, err = svc.RequestMagicLink(ctx, "alice@example.com")
+	require.NoError(t, err)
+	svc.WaitMail()
+	mailer.Err = nil
+
+	binding, err = svc.RequestMagicLink(ctx, "Alice@Example.com")
+	require.NoError(t, err)
+	svc.WaitMail()
+	assert.Empty(t, binding, "sin BindDevice no hay secreto de navegador")
+	link := linkToken(t, mailer, "alice@example.com")
+
+	_, err = svc.FinishMagicLink(ctx, link+"x", "", "test-agent", "127.0.0.1", LoginOptions{})
+	assert.ErrorIs(t, err, apperrors.ErrMagicLinkInvalid)
+	token, err := svc.FinishMagicLink(ctx, link, "", "test-agent", "127.0.0.1", LoginOptions{})
+	require.NoError(t, err)
+	claims, err := svc.Authenticate(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, claims.UserID)
+	_, err = svc.FinishMagicLink(ctx, link, "", "test-agent", "127.0.0.1", LoginOptions{})
+	assert.ErrorIs(t, err, apperrors.ErrMagicLinkInvalid, "el link es de un solo uso")
+
+	// Abrir el link verificó el email
+	_, verified, err := svc.EmailStatus(ctx, user.ID)
+	require.NoError(t, err)
+	assert.True(t, verified)
+
+	history, err := svc.LoginHistory(ctx, user.ID, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.True(t, history[0].Success)
+	assert.Equal(t, LoginMethodMagicLink, history[0].Method)
+	assert.NotNil(t, history[0].SessionID)
+
+	// Los links inválidos quedan registrados sin usuario
+	failed := false
+	rejected, err := svc.QueryAuthEvents(ctx, repositories.AuthEventFilter{Success: &failed})
+	require.NoError(t, err)
+	require.Len(t, rejected, 2)
+	assert.Equal(t, ReasonInvalidMagicLink, rejected[0].Reason)
+	assert.Equal(t, LoginMethodMagicLink, rejected[0].Method)
+
+	// Un token de otro propósito no sirve como link de login
+	_, err = svc.FinishMagicLink(ctx, token, "", "test-agent", "127.0.0.1", LoginOptions{})
+	assert.ErrorIs(t, err, apperrors.ErrMagicLinkInvalid)
+
+	// Con BindDevice el link sólo sirve con el secreto del navegador que lo
+	// pidió, y un intento desde otro no lo gasta
+	svc.WithMagicLink(MagicLink{Mailer: mailer, LinkURL: "https://app.example.com/login/magic", TTL: 15 * time.Minute, BindDevice: true})
+	unknown, err := svc.RequestMagicLink(ctx, "ghost@example.com")
+	require.NoError(t, err)
+	svc.WaitMail()
+	assert.NotEmpty(t, unknown, "la respuesta no delata si el email existe")
+	binding, err = svc.RequestMagicLink(ctx, "alice@example.com")
+	require.NoError(t, err)
+	svc.WaitMail()
+	require.NotEmpty(t, binding)
+	link = linkToken(t, mailer, "alice@example.com")
+	_, err = svc.FinishMagicLink(ctx, link, "", "test-agent", "127.0.0.1", LoginOptions{})
+	assert.ErrorIs(t, err, apperrors.ErrMagicLinkInvalid)
+	_, err = svc.FinishMagicLink(ctx, link, unknown, "test-agent", "127.0.0.1", LoginOptions{})
+	assert.ErrorIs(t, err, apperrors.ErrMagicLinkInvalid)
+	_, err = svc.FinishMagicLink(ctx, link, binding, "test-agent", "127.0.0.1", LoginOptions{})
+	require.NoError(t, err)
+
+	// Un link pendiente deja de servir si el usuario cambia de email
+	binding, err = svc.RequestMagicLink(ctx, "alice@example.com")
+	require.NoError(t, err)
+	svc.WaitMail()
+	link = linkToken(t, mailer, "alice@example.com")
+	require.NoError(t, svc.ChangeEmail(ctx, user.ID, "alice@work.example.com"))
+	_, err = svc.FinishMagicLink(ctx, link, binding, "test-agent", "127.0.0.1", LoginOptions{})
+	assert.ErrorIs(t, err, apperrors.ErrMagicLinkInvalid)
+
+	// Sin configurar, el login por link no está disponible
+	disabled := NewAuthService(repotest.NewUserStore(), repotest.NewSessionStore(), &config.Config{JWTSecret: "test-secret"})
+	_, err = disabled.RequestMagicLink(ctx, "alice@example.com")
+	assert.ErrorIs(t, err, apperrors.ErrMagicLinkDisabled)
+}
+
+func TestMagicLinkSecondFactor(t *testing.T) {
+	ctx := context.Background()
+	mailer := mail.NewMemoryMailer()
+	svc := NewAuthService(repotest.NewUserStore(), repotest.NewSessionStore(), &config.Config{
+		JWTSecret:     "test-secret",
+		JWTExpiration: 15 * time.Minute,
+	}).WithMFA(repotest.NewMFAStore(), MFAPolicy{RequiredRoles: []string{"admin"}}).WithMagicLink(MagicLink{
+		Mailer:  mailer,
+		LinkURL: "https://app.example.com/login/magic",
+		TTL:     15 * time.Minute,
+	})
+
+	// Como en Login, un rol que exige segundo factor recibe el desafío
+	_, err := svc.RegisterWithEmail(ctx, "root", "rootpassword", "admin", "root@example.com")
+	require.NoError(t, err)
+	_, err = svc.RequestMagicLink(ctx, "root@example.com")
+	require.NoError(t, err)
+	svc.WaitMail()
+	_, err = svc.FinishMagicLink(ctx, linkToken(t, mailer, "root@example.com"), "", "test-agent", "127.0.0.1", LoginOptions{})
+	var mfaErr *MFARequiredError
+	require.ErrorAs(t, err, &mfaErr)
+	assert.True(t, mfaErr.Enroll)
 }
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/stretchr/testify/require"
+)
+
+// softAuthenticator es un autenticador WebAuthn en memoria para las pruebas:
+// una clave ECDSA P-256, atestación "none" y un contador de firmas que las
+// pruebas pueden retroceder para simular un clon
+type softAuthenticator struct {
+	t       *testing.T
+	rpID    string
+	origin  string
+	id      []byte
+	key     *ecdsa.PrivateKey
+	handle  protocol.URLEncodedBase64
+	counter uint32
+}
+
+func newSoftAuthenticator(t *testing.T, rpID, origin string) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	id := make([]byte, 16)
+	_, err = rand.Read(id)
+	require.NoError(t, err)
+	return &softAuthenticator{t: t, rpID: rpID, origin: origin, id: id, key: key}
+}
+
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttestedData = 0x40
+)
+
+// authData arma los datos del autenticador: hash del RP ID, flags, contador
+// y, al registrar, la credencial con su clave pública en COSE
+func (a *softAuthenticator) authData(flags byte, attested []byte) []byte {
+	rpHash := sha256.Sum256([]byte(a.rpID))
+	data := append(rpHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.counter)
+	return append(data, attested...)
+}
+
+func (a *softAuthenticator) clientData(kind string, challenge protocol.URLEncodedBase64) []byte {
+	data, err := json.Marshal(map[string]string{
+		"type":      kind,
+		"challenge": base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":    a.origin,
+	})
+	require.NoError(a.t, err)
+	return data
+}
+
+// create responde las opciones de registro como navigator.credentials.create
+func (a *softAuthenticator) create(options interface{}) []byte {
+	creation, ok := options.(*protocol.CredentialCreation)
+	require.True(a.t, ok)
+	a.handle = creation.Response.User.ID.(protocol.URLEncodedBase64)
+
+	coseKey, err := webauthncbor.Marshal(map[int]interface{}{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: a.key.X.FillBytes(make([]byte, 32)),
+		-3: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	require.NoError(a.t, err)
+
+	attested := make([]byte, 16) // AAGUID vacío
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.id)))
+	attested = append(attested, a.id...)
+	attested = append(attested, coseKey...)
+
+	attestation, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authData(flagUserPresent|flagUserVerified|flagAttestedData, attested),
+	})
+	require.NoError(a.t, err)
+
+	return a.marshal(map[string]interface{}{
+		"clientDataJSON":    protocol.URLEncodedBase64(a.clientData("webauthn.create", creation.Response.Challenge)),
+		"attestationObject": protocol.URLEncodedBase64(attestation),
+		"transports":        []string{"internal"},
+	})
+}
+
+// get responde las opciones de login como navigator.credentials.get; cada
+// firma avanza el contador
+func (a *softAuthenticator) get(options interface{}) []byte {
+	assertion, ok := options.(*protocol.CredentialAssertion)
+	require.True(a.t, ok)
+
+	a.counter++
+	authData := a.authData(flagUserPresent|flagUserVerified, nil)
+	clientData := a.clientData("webauthn.get", assertion.Response.Challenge)
+	clientHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	require.NoError(a.t, err)
+
+	return a.marshal(map[string]interface{}{
+		"clientDataJSON":    protocol.URLEncodedBase64(clientData),
+		"authenticatorData": protocol.URLEncodedBase64(authData),
+		"signature":         protocol.URLEncodedBase64(signature),
+		"userHandle":        protocol.URLEncodedBase64(a.handle),
+	})
+}
+
+func (a *softAuthenticator) marshal(response map[string]interface{}) []byte {
+	data, err := json.Marshal(map[string]interface{}{
+		"id":       base64.RawURLEncoding.EncodeToString(a.id),
+		"rawId":    protocol.URLEncodedBase64(a.id),
+		"type":     "public-key",
+		"response": response,
+	})
+	require.NoError(a.t, err)
+	return data
+}
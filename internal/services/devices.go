@@ -0,0 +1,72 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/ramiroschettino/jwt-auth-api/internal/devices"
+	"github.com/ramiroschettino/jwt-auth-api/internal/models"
+	"github.com/ramiroschettino/jwt-auth-api/internal/repositories"
+)
+
+// WithDeviceRecognition hace que Login recuerde los dispositivos de cada
+// usuario, marque las sesiones iniciadas desde uno desconocido y avise por
+// notifier. El primer dispositivo de una cuenta no se considera nuevo.
+//
+// El aviso se envía dentro del request de login: un notifier lento (mail,
+// webhook) debería encolar el evento en lugar de entregarlo en el momento.
+func (s *AuthService) WithDeviceRecognition(store repositories.DeviceStore, notifier devices.Notifier) *AuthService {
+	s.devices = store
+	s.deviceNotifier = notifier
+	return s
+}
+
+// recognizeDevice registra el dispositivo del login y devuelve su huella y si
+// es nuevo para el usuario. Un fallo del store no impide el login: la sesión
+// se crea sin marcar y se registra el error.
+func (s *AuthService) recognizeDevice(ctx context.Context, user *models.User, userAgent, ip, deviceID string) (string, bool) {
+	fingerprint := devices.Fingerprint(userAgent, ip, deviceID)
+	if s.devices == nil {
+		return fingerprint, false
+	}
+
+	known, err := s.devices.CountDevices(ctx, user.ID)
+	if err != nil {
+		log.Printf("Error al consultar los dispositivos del usuario %d: %v", user.ID, err)
+		return fingerprint, false
+	}
+
+	isNew, err := s.devices.TouchDevice(ctx, &models.Device{
+		UserID:      user.ID,
+		Fingerprint: fingerprint,
+		UserAgent:   userAgent,
+		IP:          ip,
+		LastSeenAt:  time.Now(),
+	})
+	if err != nil {
+		log.Printf("Error al registrar el dispositivo del usuario %d: %v", user.ID, err)
+		return fingerprint, false
+	}
+	return fingerprint, isNew && known > 0
+}
+
+func (s *AuthService) notifyNewDevice(ctx context.Context, user *models.User, session *models.Session) {
+	if s.deviceNotifier == nil {
+		return
+	}
+	event := devices.NewDeviceEvent{
+		UserID:      user.ID,
+		Username:    user.Username,
+		SessionID:   session.ID,
+		Fingerprint: session.DeviceFingerprint,
+		UserAgent:   session.UserAgent,
+		IP:          session.IP,
+		Country:     session.Country,
+		City:        session.City,
+		At:          session.CreatedAt,
+	}
+	if err := s.deviceNotifier.NotifyNewDevice(ctx, event); err != nil {
+		log.Printf("Error al notificar el nuevo dispositivo del usuario %d: %v", user.ID, err)
+	}
+}
@@ -0,0 +1,321 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	apperrors "github.com/ramiroschettino/jwt-auth-api/internal/errors"
+	mailer "github.com/ramiroschettino/jwt-auth-api/internal/mail"
+	"github.com/ramiroschettino/jwt-auth-api/internal/models"
+)
+
+// Políticas para cuentas sin email verificado
+const (
+	// EmailPolicyOff no restringe nada; el email es opcional
+	EmailPolicyOff = "off"
+	// EmailPolicyRestrict deja entrar pero las rutas marcadas con
+	// RequireVerifiedEmail responden 403 hasta verificar
+	EmailPolicyRestrict = "restrict"
+	// EmailPolicyBlock rechaza el login hasta verificar
+	EmailPolicyBlock = "block"
+)
+
+// maxEmailLength es el largo máximo de una dirección según RFC 5321
+const maxEmailLength = 254
+
+// EmailVerification configura el envío de links de verificación
+type EmailVerification struct {
+	Mailer mailer.Mailer
+	// LinkURL es la página que recibe el token como ?token=... y lo envía a
+	// POST /email/verify
+	LinkURL string
+	TTL     time.Duration
+	Policy  string
+}
+
+// WithEmailVerification envía un link de verificación cada vez que un
+// usuario registra o cambia su email, y aplica la política indicada a las
+// cuentas sin verificar
+func (s *AuthService) WithEmailVerification(cfg EmailVerification) *AuthService {
+	if cfg.Policy == "" {
+		cfg.Policy = EmailPolicyOff
+	}
+	s.emailVerification = &cfg
+	return s
+}
+
+func (s *AuthService) emailPolicy() string {
+	if s.emailVerification == nil {
+		return EmailPolicyOff
+	}
+	return s.emailVerification.Policy
+}
+
+// normalizeEmail valida una dirección simple (sin nombre) y la pasa a
+// minúsculas
+func normalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" || len(email) > maxEmailLength {
+		return "", apperrors.ErrInvalidEmail
+	}
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email || addr.Name != "" {
+		return "", apperrors.ErrInvalidEmail
+	}
+	return email, nil
+}
+
+// EmailStatus devuelve el email del usuario ("" si no tiene) y si está
+// verificado
+func (s *AuthService) EmailStatus(ctx context.Context, userID uint) (string, bool, error) {
+	user, err := s.userRepo.FindUserByID(ctx, userID)
+	if err != nil {
+		return "", false, err
+	}
+	if user.Email == nil {
+		return "", false, nil
+	}
+	return *user.Email, user.EmailVerifiedAt != nil, nil
+}
+
+// ChangeEmail reemplaza el email del usuario; queda sin verificar y se envía
+// el link a la dirección nueva
+func (s *AuthService) ChangeEmail(ctx context.Context, userID uint, email string) error {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return err
+	}
+	user, err := s.userRepo.FindUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return s.replaceEmail(ctx, user, email)
+}
+
+// replaceEmail guarda email ya normalizado como dirección sin verificar del
+// usuario y envía el link; si es la que ya tiene sólo reenvía el link
+func (s *AuthService) replaceEmail(ctx context.Context, user *models.User, email string) error {
+	if user.Email != nil && *user.Email == email {
+		if user.EmailVerifiedAt == nil {
+			return s.sendEmailVerification(ctx, user)
+		}
+		return nil
+	}
+
+	taken, err := s.userRepo.IsEmailTaken(ctx, email)
+	if err != nil {
+		return apperrors.WrapError(err, "failed to check email")
+	}
+	if taken {
+		return apperrors.ErrEmailTaken
+	}
+	if err := s.userRepo.UpdateEmail(ctx, user.ID, email); err != nil {
+		return apperrors.WrapError(err, "failed to update email")
+	}
+	user.Email = &email
+	user.EmailVerifiedAt = nil
+	return s.sendEmailVerification(ctx, user)
+}
+
+// ResendEmailVerification vuelve a enviar el link; si el email ya está
+// verificado no hace nada
+func (s *AuthService) ResendEmailVerification(ctx context.Context, userID uint) error {
+	user, err := s.userRepo.FindUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.Email == nil {
+		return apperrors.ErrEmailMissing
+	}
+	if user.EmailVerifiedAt != nil {
+		return nil
+	}
+	return s.sendEmailVerification(ctx, user)
+}
+
+// RequestEmailVerification reenvía el link de verificación sin sesión, para
+// quien no puede entrar con la política block porque el link venció, se
+// perdió o la cuenta es anterior al email. Pide la contraseña y devuelve nil
+// igual si el usuario no existe o la contraseña no coincide, así la respuesta
+// no revela qué usuarios hay; los intentos fallidos cuentan para el bloqueo
+// como un login. email, si no está vacío, reemplaza a una dirección todavía
+// sin verificar o se agrega a una cuenta que no tiene.
+func (s *AuthService) RequestEmailVerification(ctx context.Context, username, password, email, ip string) error {
+	if s.emailVerification == nil {
+		return apperrors.ErrEmailVerificationDisabled
+	}
+	if email != "" {
+		var err error
+		if email, err = normalizeEmail(email); err != nil {
+			return err
+		}
+	}
+	if err := s.checkLockout(ctx, username, ip); err != nil {
+		return err
+	}
+
+	user, err := s.userRepo.FindUserByUsername(ctx, username)
+	if err != nil {
+		if apperrors.IsContextError(err) {
+			return err
+		}
+		s.equalizeTiming(ctx, password)
+		s.registerFailure(ctx, username, ip)
+		return nil
+	}
+	if !s.verifyPassword(user, password) {
+		s.registerFailure(ctx, username, ip)
+		return nil
+	}
+	s.clearFailures(ctx, username)
+
+	if user.Email != nil && user.EmailVerifiedAt != nil {
+		return nil
+	}
+	if email != "" {
+		return s.replaceEmail(ctx, user, email)
+	}
+	if user.Email == nil {
+		return apperrors.ErrEmailMissing
+	}
+	return s.sendEmailVerification(ctx, user)
+}
+
+// VerifyEmail consume el token de un link de verificación. El link deja de
+// servir si el usuario cambió de email después de recibirlo.
+func (s *AuthService) VerifyEmail(ctx context.Context, token string) error {
+	claims, verification, err := s.parsePurposeToken(ctx, purposeEmailVerify, token, apperrors.ErrVerificationLinkInvalid)
+	if err != nil {
+		return err
+	}
+	userID, _ := claims["user_id"].(float64)
+	email, _ := claims["email"].(string)
+	if userID == 0 || email == "" {
+		return apperrors.ErrVerificationLinkInvalid
+	}
+
+	ok, err := s.userRepo.MarkEmailVerified(ctx, uint(userID), email, time.Now())
+	if err != nil {
+		return apperrors.WrapError(err, "failed to verify email")
+	}
+	if !ok {
+		return apperrors.ErrVerificationLinkInvalid
+	}
+	return s.consumePurposeToken(ctx, verification, apperrors.ErrVerificationLinkInvalid)
+}
+
+// RequireVerifiedEmail devuelve ErrEmailNotVerified si la política restringe
+// las cuentas sin verificar y la del usuario lo está
+func (s *AuthService) RequireVerifiedEmail(ctx context.Context, userID uint) error {
+	if s.emailPolicy() == EmailPolicyOff {
+		return nil
+	}
+	user, err := s.userRepo.FindUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return checkEmailVerified(user)
+}
+
+// checkLoginEmail corta el login de una cuenta sin verificar si la política
+// es block. Se llama después de validar la contraseña para no revelar nada a
+// quien no la conoce.
+func (s *AuthService) checkLoginEmail(user *models.User) error {
+	if s.emailPolicy() != EmailPolicyBlock {
+		return nil
+	}
+	return checkEmailVerified(user)
+}
+
+func checkEmailVerified(user *models.User) error {
+	if user.Email == nil || user.EmailVerifiedAt == nil {
+		return apperrors.ErrEmailNotVerified
+	}
+	return nil
+}
+
+// sendEmailVerification firma un link de un solo uso para el email actual
+// del usuario y lo envía
+func (s *AuthService) sendEmailVerification(ctx context.Context, user *models.User) error {
+	if s.emailVerification == nil || user.Email == nil {
+		return nil
+	}
+	cfg := s.emailVerification
+
+	token, expiresAt, err := s.signPurposeToken(purposeEmailVerify, jwt.MapClaims{
+		"user_id": user.ID,
+		"email":   *user.Email,
+	}, cfg.TTL)
+	if err != nil {
+		return apperrors.WrapError(err, "failed to sign verification link")
+	}
+	link, err := linkWithToken(cfg.LinkURL, token)
+	if err != nil {
+		return err
+	}
+
+	err = cfg.Mailer.Send(ctx, mailer.Message{
+		To:      *user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nConfirm your email address by opening this link:\n\n%s\n\nThe link expires on %s and can be used once. If you did not request it, ignore this message.\n",
+			user.Username, link, expiresAt.UTC().Format(time.RFC1123)),
+	})
+	if err != nil {
+		return apperrors.WrapError(err, "failed to send verification email")
+	}
+	return nil
+}
+
+// linkWithToken agrega token=... a la query de base
+func linkWithToken(base, token string) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", apperrors.WrapError(err, "invalid link URL")
+	}
+	query := u.Query()
+	query.Set("token", token)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// inBackground corre fn fuera del request con un contexto sin cancelación.
+// Se usa para el trabajo que sólo existe si la cuenta existe (buscar tokens,
+// enviar el correo), así ni la demora ni un error del mailer llegan a la
+// respuesta y revelan qué cuentas hay; los errores van al log.
+func (s *AuthService) inBackground(ctx context.Context, fn func(ctx context.Context)) {
+	ctx = context.WithoutCancel(ctx)
+	s.mailTasks.Add(1)
+	go func() {
+		defer s.mailTasks.Done()
+		fn(ctx)
+	}()
+}
+
+// WaitMail espera los correos que se están enviando en segundo plano; se
+// llama al apagar el servidor
+func (s *AuthService) WaitMail() {
+	s.mailTasks.Wait()
+}
+
+// sendRegistrationEmail envía en segundo plano el link de un alta recién
+// creada: con el registro seguro un alta repetida no manda nada, así que el
+// envío no puede sumarse a la respuesta. Un error no deshace el registro:
+// queda en el log y el usuario puede pedir otro link.
+func (s *AuthService) sendRegistrationEmail(ctx context.Context, user *models.User) {
+	if s.emailVerification == nil || user.Email == nil {
+		return
+	}
+	// Copia: quien llamó se queda con user y puede modificarlo
+	created := *user
+	s.inBackground(ctx, func(ctx context.Context) {
+		if err := s.sendEmailVerification(ctx, &created); err != nil {
+			log.Printf("Error al enviar la verificación de email del usuario %d: %v", created.ID, err)
+		}
+	})
+}
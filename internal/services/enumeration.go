@@ -0,0 +1,77 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	apperrors "github.com/ramiroschettino/jwt-auth-api/internal/errors"
+)
+
+// publicLoginError oculta si falló el usuario o la contraseña. El motivo real
+// ya quedó en el log de eventos.
+func publicLoginError(err error) error {
+	if errors.Is(err, apperrors.ErrUserNotFound) || errors.Is(err, apperrors.ErrInvalidPassword) {
+		return apperrors.ErrInvalidCredentials
+	}
+	return err
+}
+
+// RegistrationAttempt describe un intento de registro con un usuario que ya
+// existe
+type RegistrationAttempt struct {
+	UserID   uint
+	Username string
+	At       time.Time
+}
+
+// RegistrationNotifier avisa al dueño de la cuenta, por fuera de la respuesta
+// HTTP, que alguien intentó registrarse con su usuario
+type RegistrationNotifier interface {
+	NotifyRegistrationAttempt(ctx context.Context, attempt RegistrationAttempt) error
+}
+
+// LogRegistrationNotifier escribe el aviso en el log estándar; pensado para
+// desarrollo
+type LogRegistrationNotifier struct{}
+
+func (LogRegistrationNotifier) NotifyRegistrationAttempt(ctx context.Context, attempt RegistrationAttempt) error {
+	log.Printf("Intento de registro con el usuario existente %s (id %d)", attempt.Username, attempt.UserID)
+	return nil
+}
+
+// WithEnumerationSafeRegistration hace que Register no revele si el usuario
+// ya existe: en ese caso no devuelve error ni usuario y avisa al dueño por
+// notifier (que puede ser nil)
+func (s *AuthService) WithEnumerationSafeRegistration(notifier RegistrationNotifier) *AuthService {
+	s.safeRegistration = true
+	s.registrationNotifier = notifier
+	return s
+}
+
+// EnumerationSafeRegistration indica si Register oculta los usuarios
+// existentes, para que el handler responda siempre lo mismo
+func (s *AuthService) EnumerationSafeRegistration() bool {
+	return s.safeRegistration
+}
+
+// registrationTaken responde a un registro con un usuario existente en modo
+// seguro. Hashea la contraseña igual que un alta real para no delatarse por
+// el tiempo de respuesta.
+func (s *AuthService) registrationTaken(ctx context.Context, username, password string) {
+	s.passwordHasher().Hash(password)
+
+	if s.registrationNotifier == nil {
+		return
+	}
+	user, err := s.userRepo.FindUserByUsername(ctx, username)
+	if err != nil {
+		log.Printf("Error al buscar el usuario %q para avisar del intento de registro: %v", username, err)
+		return
+	}
+	attempt := RegistrationAttempt{UserID: user.ID, Username: user.Username, At: time.Now()}
+	if err := s.registrationNotifier.NotifyRegistrationAttempt(context.WithoutCancel(ctx), attempt); err != nil {
+		log.Printf("Error al avisar del intento de registro al usuario %d: %v", user.ID, err)
+	}
+}
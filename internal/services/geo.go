@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"log"
+
+	"github.com/ramiroschettino/jwt-auth-api/internal/geoip"
+	"github.com/ramiroschettino/jwt-auth-api/internal/models"
+	"github.com/ramiroschettino/jwt-auth-api/internal/repositories"
+)
+
+// TravelHook recibe los logins consecutivos de un usuario que habrían
+// requerido viajar más rápido de lo posible. Se ejecuta dentro del login y
+// no lo bloquea: decidir qué hacer (avisar, revocar, pedir MFA) queda a
+// cargo del hook.
+type TravelHook func(ctx context.Context, travel geoip.Travel)
+
+// WithGeoIP hace que Login anote en cada sesión el país, ciudad y ASN de la IP
+func (s *AuthService) WithGeoIP(locator geoip.Locator) *AuthService {
+	s.geo = locator
+	return s
+}
+
+// WithImpossibleTravelHook compara cada login con el login exitoso anterior
+// del usuario y llama a hook si el desplazamiento entre ambos supera
+// maxSpeedKmh. Requiere WithGeoIP con una base City y WithEventLog, que es de
+// donde sale el login anterior.
+func (s *AuthService) WithImpossibleTravelHook(maxSpeedKmh float64, hook TravelHook) *AuthService {
+	s.travelMaxSpeed = maxSpeedKmh
+	s.travelHook = hook
+	return s
+}
+
+// locate completa la ubicación de la sesión según su IP
+func (s *AuthService) locate(session *models.Session) {
+	if s.geo == nil {
+		return
+	}
+	loc, ok := s.geo.Lookup(session.IP)
+	if !ok {
+		return
+	}
+	session.Country = loc.Country
+	session.City = loc.City
+	session.ASN = loc.ASN
+	session.ASOrg = loc.ASOrg
+	if loc.HasCoordinates {
+		session.Latitude = &loc.Latitude
+		session.Longitude = &loc.Longitude
+	}
+}
+
+// locateEvent completa la ubicación de un evento de login o de cambio de
+// contraseña según su IP
+func (s *AuthService) locateEvent(event *models.AuthEvent) {
+	if s.geo == nil {
+		return
+	}
+	if loc, ok := s.geo.Lookup(event.IP); ok {
+		event.Country = loc.Country
+		event.City = loc.City
+		event.ASN = loc.ASN
+		if loc.HasCoordinates {
+			event.Latitude = &loc.Latitude
+			event.Longitude = &loc.Longitude
+			event.AccuracyKm = loc.AccuracyKm
+		}
+	}
+}
+
+// previousLogin devuelve el último login exitoso del usuario, que es contra
+// el que se compara el login nuevo. Se busca en el log de eventos y no en las
+// sesiones activas, para que un logout no borre el punto de comparación.
+func (s *AuthService) previousLogin(ctx context.Context, userID uint) *geoip.Login {
+	if s.geo == nil || s.travelHook == nil || s.events == nil {
+		return nil
+	}
+	success := true
+	events, err := s.events.FindEvents(ctx, repositories.AuthEventFilter{
+		UserID:  userID,
+		Type:    models.AuthEventLogin,
+		Success: &success,
+		Limit:   1,
+	})
+	if err != nil {
+		log.Printf("Error al buscar el login anterior del usuario %d: %v", userID, err)
+		return nil
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	login := eventLogin(&events[0])
+	return &login
+}
+
+func (s *AuthService) checkTravel(ctx context.Context, previous *geoip.Login, current *models.Session) {
+	if previous == nil || s.travelHook == nil {
+		return
+	}
+	// La sesión no guarda la precisión de la ubicación: se vuelve a buscar
+	login := geoip.Login{IP: current.IP, At: current.CreatedAt}
+	if loc, ok := s.geo.Lookup(current.IP); ok {
+		login.Location = loc
+	}
+	travel, ok := geoip.CheckTravel(current.UserID, *previous, login, s.travelMaxSpeed)
+	if ok {
+		s.travelHook(ctx, travel)
+	}
+}
+
+func eventLogin(event *models.AuthEvent) geoip.Login {
+	login := geoip.Login{
+		IP: event.IP,
+		At: event.CreatedAt,
+		Location: geoip.Location{
+			Country:    event.Country,
+			City:       event.City,
+			ASN:        event.ASN,
+			AccuracyKm: event.AccuracyKm,
+		},
+	}
+	if event.Latitude != nil && event.Longitude != nil {
+		login.Location.Latitude = *event.Latitude
+		login.Location.Longitude = *event.Longitude
+		login.Location.HasCoordinates = true
+	}
+	return login
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	apperrors "github.com/ramiroschettino/jwt-auth-api/internal/errors"
+	"github.com/ramiroschettino/jwt-auth-api/internal/repositories"
+)
+
+// LockoutPolicy define cuándo y por cuánto tiempo se bloquean los logins
+// tras intentos fallidos. Al llegar al umbral la clave se bloquea por
+// BaseDuration, y cada falla posterior duplica el bloqueo hasta MaxDuration.
+// Las fallas se olvidan tras Window sin nuevos intentos fallidos.
+type LockoutPolicy struct {
+	// UserThreshold es la cantidad de fallas por usuario que dispara el
+	// bloqueo (0 = no se bloquea por usuario)
+	UserThreshold int
+	// IPThreshold es lo mismo por IP de origen; suele ser mayor porque una
+	// IP puede ser compartida (0 = no se bloquea por IP)
+	IPThreshold  int
+	BaseDuration time.Duration
+	MaxDuration  time.Duration
+	Window       time.Duration
+}
+
+// LockedError se devuelve cuando el usuario o la IP están bloqueados;
+// RetryAfter es cuánto falta para poder reintentar
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("%s (%s)", apperrors.ErrAccountLocked.Error(), e.RetryAfter.Round(time.Second))
+}
+
+func (e *LockedError) Unwrap() error {
+	return apperrors.ErrAccountLocked
+}
+
+// WithLockout activa el bloqueo por intentos fallidos de login
+func (s *AuthService) WithLockout(store repositories.LockoutStore, policy LockoutPolicy) *AuthService {
+	s.lockouts = store
+	s.lockoutPolicy = policy
+	return s
+}
+
+// UnlockAccount borra las fallas y el bloqueo de un usuario
+func (s *AuthService) UnlockAccount(ctx context.Context, username string) error {
+	if s.lockouts == nil {
+		return nil
+	}
+	return s.lockouts.ResetFailures(ctx, userLockKey(username))
+}
+
+// UnlockIP borra las fallas y el bloqueo de una IP
+func (s *AuthService) UnlockIP(ctx context.Context, ip string) error {
+	if s.lockouts == nil {
+		return nil
+	}
+	return s.lockouts.ResetFailures(ctx, ipLockKey(ip))
+}
+
+func userLockKey(username string) string { return "user:" + username }
+func ipLockKey(ip string) string         { return "ip:" + ip }
+
+// checkLockout devuelve un *LockedError si el usuario o la IP siguen
+// bloqueados; se consulta antes de verificar la contraseña
+func (s *AuthService) checkLockout(ctx context.Context, username, ip string) error {
+	if s.lockouts == nil {
+		return nil
+	}
+
+	var retryAfter time.Duration
+	for _, key := range []string{userLockKey(username), ipLockKey(ip)} {
+		failure, err := s.lockouts.GetFailure(ctx, key)
+		if err != nil {
+			return fmt.Errorf("error al consultar bloqueos: %w", err)
+		}
+		if failure == nil {
+			continue
+		}
+		if wait := time.Until(failure.LockedUntil); wait > retryAfter {
+			retryAfter = wait
+		}
+	}
+	if retryAfter > 0 {
+		return &LockedError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// registerFailure suma la falla al usuario y a la IP y los bloquea si
+// llegaron al umbral. Se cuenta también para usuarios inexistentes, así el
+// bloqueo no revela qué cuentas existen.
+func (s *AuthService) registerFailure(ctx context.Context, username, ip string) {
+	if s.lockouts == nil {
+		return
+	}
+
+	// Sin cancelación: un cliente que corta la conexión no debe evitar que
+	// se le cuente el intento
+	ctx = context.WithoutCancel(ctx)
+	now := time.Now()
+	policy := s.lockoutPolicy
+	keys := []struct {
+		key       string
+		threshold int
+	}{
+		{userLockKey(username), policy.UserThreshold},
+		{ipLockKey(ip), policy.IPThreshold},
+	}
+	for _, k := range keys {
+		if k.threshold <= 0 {
+			continue
+		}
+		failures, err := s.lockouts.RegisterFailure(ctx, k.key, now, now.Add(-policy.Window))
+		if err != nil {
+			log.Printf("Error al registrar el login fallido de %s: %v", k.key, err)
+			continue
+		}
+		if d := policy.lockDuration(failures, k.threshold); d > 0 {
+			if err := s.lockouts.LockUntil(ctx, k.key, now.Add(d)); err != nil {
+				log.Printf("Error al bloquear %s: %v", k.key, err)
+			}
+		}
+	}
+}
+
+// clearFailures olvida las fallas del usuario tras un login correcto. Las de
+// la IP se mantienen: si no, un atacante podría reiniciarlas entrando con
+// una cuenta propia entre intentos.
+func (s *AuthService) clearFailures(ctx context.Context, username string) {
+	if s.lockouts == nil || s.lockoutPolicy.UserThreshold <= 0 {
+		return
+	}
+	if err := s.lockouts.ResetFailures(ctx, userLockKey(username)); err != nil {
+		log.Printf("Error al reiniciar las fallas de %s: %v", username, err)
+	}
+}
+
+// lockDuration devuelve el bloqueo que corresponde a la cantidad de fallas
+func (p LockoutPolicy) lockDuration(failures, threshold int) time.Duration {
+	if threshold <= 0 || failures < threshold {
+		return 0
+	}
+	d := p.BaseDuration
+	for i := threshold; i < failures && d < p.MaxDuration; i++ {
+		d *= 2
+	}
+	if p.MaxDuration > 0 && d > p.MaxDuration {
+		d = p.MaxDuration
+	}
+	return d
+}
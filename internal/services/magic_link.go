@@ -0,0 +1,186 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	apperrors "github.com/ramiroschettino/jwt-auth-api/internal/errors"
+	mailer "github.com/ramiroschettino/jwt-auth-api/internal/mail"
+)
+
+// MagicLink configura el login sin contraseña por un link enviado por email
+type MagicLink struct {
+	Mailer mailer.Mailer
+	// LinkURL es la página que recibe el token como ?token=... y lo envía a
+	// POST /login/magic/verify
+	LinkURL string
+	TTL     time.Duration
+	// BindDevice hace que el link sólo sirva en el navegador que lo pidió:
+	// RequestMagicLink devuelve un secreto que el handler guarda en una
+	// cookie y FinishMagicLink exige de vuelta
+	BindDevice bool
+}
+
+// WithMagicLink habilita el login por link de un solo uso enviado por email
+func (s *AuthService) WithMagicLink(cfg MagicLink) *AuthService {
+	s.magicLink = &cfg
+	return s
+}
+
+// MagicLinkTTL es la vida de los links de login, para que el handler sepa
+// cuánto debe durar la cookie del navegador
+func (s *AuthService) MagicLinkTTL() time.Duration {
+	if s.magicLink == nil {
+		return 0
+	}
+	return s.magicLink.TTL
+}
+
+// RequestMagicLink envía un link de login al usuario con ese email. Como en
+// RequestPasswordReset, la búsqueda y el envío corren en segundo plano para
+// que la respuesta no revele qué emails están registrados. Con BindDevice
+// devuelve el secreto del navegador, también cuando el email no existe.
+func (s *AuthService) RequestMagicLink(ctx context.Context, email string) (string, error) {
+	if s.magicLink == nil {
+		return "", apperrors.ErrMagicLinkDisabled
+	}
+	cfg := s.magicLink
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return "", err
+	}
+
+	var binding string
+	if cfg.BindDevice {
+		if binding, err = newOpaqueToken(); err != nil {
+			return "", err
+		}
+	}
+
+	s.inBackground(ctx, func(ctx context.Context) {
+		if err := s.sendMagicLink(ctx, cfg, email, binding); err != nil {
+			log.Printf("Error al enviar el link de login: %v", err)
+		}
+	})
+	return binding, nil
+}
+
+// sendMagicLink firma un link para la cuenta con ese email, si existe, y lo
+// envía
+func (s *AuthService) sendMagicLink(ctx context.Context, cfg *MagicLink, email, binding string) error {
+	user, err := s.userRepo.FindUserByEmail(ctx, email)
+	if err != nil {
+		if apperrors.IsContextError(err) {
+			return err
+		}
+		return nil
+	}
+
+	claims := jwt.MapClaims{
+		"user_id": user.ID,
+		"email":   email,
+	}
+	if binding != "" {
+		claims["device"] = hashOpaqueToken(binding)
+	}
+	token, expiresAt, err := s.signPurposeToken(purposeMagicLink, claims, cfg.TTL)
+	if err != nil {
+		return apperrors.WrapError(err, "failed to sign login link")
+	}
+	link, err := linkWithToken(cfg.LinkURL, token)
+	if err != nil {
+		return err
+	}
+
+	note := ""
+	if binding != "" {
+		note = " It only works in the browser where you requested it."
+	}
+	err = cfg.Mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Your login link",
+		Body: fmt.Sprintf("Hi %s,\n\nOpen this link to log in:\n\n%s\n\nThe link expires on %s and can be used once.%s If you did not request it, ignore this message.\n",
+			user.Username, link, expiresAt.UTC().Format(time.RFC1123), note),
+	})
+	if err != nil {
+		return apperrors.WrapError(err, "failed to send login link")
+	}
+	return nil
+}
+
+// FinishMagicLink consume el token del link y abre la sesión igual que
+// Login: aplica el bloqueo, la política de email, el segundo factor y el
+// límite de sesiones. binding es el secreto de la cookie del navegador; si
+// no coincide el link no se consume y puede abrirse en el navegador correcto.
+func (s *AuthService) FinishMagicLink(ctx context.Context, token, binding, userAgent, ip string, opts LoginOptions) (string, error) {
+	attempt := &loginAttempt{
+		userAgent: userAgent,
+		ip:        ip,
+		method:    LoginMethodMagicLink,
+	}
+	jwtToken, err := s.magicLinkLogin(ctx, attempt, token, binding, opts)
+	s.recordLogin(ctx, attempt, err)
+	return jwtToken, err
+}
+
+func (s *AuthService) magicLinkLogin(ctx context.Context, attempt *loginAttempt, token, binding string, opts LoginOptions) (string, error) {
+	if s.magicLink == nil {
+		return "", apperrors.ErrMagicLinkDisabled
+	}
+	claims, link, err := s.parsePurposeToken(ctx, purposeMagicLink, token, apperrors.ErrMagicLinkInvalid)
+	if err != nil {
+		return "", err
+	}
+	userID, _ := claims["user_id"].(float64)
+	email, _ := claims["email"].(string)
+	if userID == 0 || email == "" {
+		return "", apperrors.ErrMagicLinkInvalid
+	}
+	if device, ok := claims["device"].(string); ok {
+		if binding == "" || subtle.ConstantTimeCompare([]byte(hashOpaqueToken(binding)), []byte(device)) != 1 {
+			return "", apperrors.ErrMagicLinkInvalid
+		}
+	}
+
+	user, err := s.userRepo.FindUserByID(ctx, uint(userID))
+	if err != nil {
+		if apperrors.IsContextError(err) {
+			return "", err
+		}
+		return "", apperrors.ErrMagicLinkInvalid
+	}
+	attempt.user = user
+	attempt.username = user.Username
+	// El link deja de servir si el usuario cambió de email después de pedirlo
+	if user.Email == nil || *user.Email != email {
+		return "", apperrors.ErrMagicLinkInvalid
+	}
+
+	if err := s.checkLockout(ctx, attempt.username, attempt.ip); err != nil {
+		return "", err
+	}
+	if err := s.consumePurposeToken(ctx, link, apperrors.ErrMagicLinkInvalid); err != nil {
+		return "", err
+	}
+
+	// Abrir el link prueba que el usuario controla el email
+	if user.EmailVerifiedAt == nil {
+		now := time.Now()
+		if _, err := s.userRepo.MarkEmailVerified(ctx, user.ID, email, now); err != nil {
+			return "", apperrors.WrapError(err, "failed to verify email")
+		}
+		user.EmailVerifiedAt = &now
+	}
+	if err := s.checkLoginEmail(user); err != nil {
+		return "", err
+	}
+	if err := s.requireSecondFactor(ctx, user); err != nil {
+		return "", err
+	}
+
+	return s.createSession(ctx, attempt, opts)
+}
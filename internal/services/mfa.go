@@ -0,0 +1,421 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	apperrors "github.com/ramiroschettino/jwt-auth-api/internal/errors"
+	"github.com/ramiroschettino/jwt-auth-api/internal/mfa"
+	"github.com/ramiroschettino/jwt-auth-api/internal/models"
+	"github.com/ramiroschettino/jwt-auth-api/internal/repositories"
+)
+
+const (
+	defaultMFAIssuer       = "JWT Auth API"
+	defaultMFAChallengeTTL = 5 * time.Minute
+)
+
+// MFAPolicy define cómo se pide el segundo factor
+type MFAPolicy struct {
+	// Issuer es el nombre con el que aparece la cuenta en la app de
+	// autenticación
+	Issuer string
+	// RequiredRoles son los roles que no pueden entrar sin segundo factor;
+	// si todavía no lo configuraron, el login los lleva a enrolarse
+	RequiredRoles []string
+	// ChallengeTTL es cuánto dura el challenge entre la contraseña y el código
+	ChallengeTTL time.Duration
+}
+
+// Segundos factores que puede ofrecer el login
+const (
+	SecondFactorTOTP    = "totp"
+	SecondFactorPasskey = "passkey"
+)
+
+// MFARequiredError se devuelve cuando la contraseña es correcta pero falta el
+// segundo factor. Challenge se presenta en CompleteMFALogin junto con el
+// código, o en FinishPasskeySecondFactor; Methods son los factores que tiene
+// el usuario. Con Enroll todavía no tiene ninguno y debe configurar TOTP
+// primero con EnrollTOTPWithChallenge.
+type MFARequiredError struct {
+	Challenge string
+	Enroll    bool
+	Methods   []string
+	ExpiresAt time.Time
+}
+
+func (e *MFARequiredError) Error() string {
+	return apperrors.ErrMFARequired.Error()
+}
+
+func (e *MFARequiredError) Unwrap() error {
+	return apperrors.ErrMFARequired
+}
+
+// MFALoginResult es el resultado de completar el login con segundo factor.
+// RecoveryCodes sólo viene cuando el login terminó un enrolamiento.
+type MFALoginResult struct {
+	Token         string
+	RecoveryCodes []string
+}
+
+// MFAStatus resume la configuración de segundo factor de un usuario
+type MFAStatus struct {
+	Enabled                bool
+	Required               bool
+	Methods                []string
+	RecoveryCodesRemaining int
+}
+
+// mfaChallenge son los datos firmados en el challenge
+type mfaChallenge struct {
+	userID   uint
+	username string
+	enroll   bool
+	token    *signedToken
+}
+
+// WithMFA habilita el segundo factor TOTP
+func (s *AuthService) WithMFA(store repositories.MFAStore, policy MFAPolicy) *AuthService {
+	if policy.Issuer == "" {
+		policy.Issuer = defaultMFAIssuer
+	}
+	if policy.ChallengeTTL <= 0 {
+		policy.ChallengeTTL = defaultMFAChallengeTTL
+	}
+	s.mfa = store
+	s.mfaPolicy = policy
+	return s
+}
+
+func (s *AuthService) mfaRequiredFor(role string) bool {
+	for _, required := range s.mfaPolicy.RequiredRoles {
+		if required == role {
+			return true
+		}
+	}
+	return false
+}
+
+// MFAStatus indica qué segundos factores tiene el usuario y cuántos códigos
+// de recuperación le quedan
+func (s *AuthService) MFAStatus(ctx context.Context, userID uint, role string) (*MFAStatus, error) {
+	methods, err := s.secondFactors(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	status := &MFAStatus{
+		Enabled:  len(methods) > 0,
+		Required: s.mfaRequiredFor(role),
+		Methods:  methods,
+	}
+	if s.mfa != nil && status.Enabled {
+		if status.RecoveryCodesRemaining, err = s.mfa.CountRecoveryCodes(ctx, userID); err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+// EnrollTOTP genera un secreto nuevo sin confirmar para el usuario. Si ya
+// había uno sin confirmar lo reemplaza; si había uno confirmado falla.
+func (s *AuthService) EnrollTOTP(ctx context.Context, userID uint, username string) (*mfa.TOTPKey, error) {
+	if s.mfa == nil {
+		return nil, apperrors.ErrMFANotEnrolled
+	}
+	current, err := s.mfa.GetTOTP(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if current != nil && current.ConfirmedAt != nil {
+		return nil, apperrors.ErrMFAAlreadyEnabled
+	}
+
+	key, err := mfa.GenerateTOTP(s.mfaPolicy.Issuer, username)
+	if err != nil {
+		return nil, apperrors.WrapError(err, "failed to generate TOTP secret")
+	}
+	if err := s.mfa.SaveTOTP(ctx, &models.TOTPSecret{
+		UserID:    userID,
+		Secret:    key.Secret,
+		CreatedAt: time.Now(),
+	}); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// ConfirmTOTP activa el secreto pendiente con un código válido y devuelve
+// los códigos de recuperación, que no vuelven a mostrarse
+func (s *AuthService) ConfirmTOTP(ctx context.Context, userID uint, code string) ([]string, error) {
+	secret, err := s.pendingTOTP(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.verifyTOTP(ctx, secret, code); err != nil {
+		return nil, err
+	}
+	return s.activateTOTP(ctx, userID)
+}
+
+// RegenerateRecoveryCodes reemplaza los códigos de recuperación; pide un
+// código TOTP para que una sesión robada no pueda quedarse con ellos
+func (s *AuthService) RegenerateRecoveryCodes(ctx context.Context, userID uint, code string) ([]string, error) {
+	secret, err := s.confirmedTOTP(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.verifyTOTP(ctx, secret, code); err != nil {
+		return nil, err
+	}
+	return s.newRecoveryCodes(ctx, userID)
+}
+
+// EnrollTOTPWithChallenge es EnrollTOTP para un usuario que todavía no tiene
+// sesión porque su rol exige segundo factor y el login lo frenó
+func (s *AuthService) EnrollTOTPWithChallenge(ctx context.Context, challengeToken string) (*mfa.TOTPKey, error) {
+	challenge, err := s.parseChallenge(ctx, challengeToken)
+	if err != nil {
+		return nil, err
+	}
+	if !challenge.enroll {
+		return nil, apperrors.ErrMFAAlreadyEnabled
+	}
+	return s.EnrollTOTP(ctx, challenge.userID, challenge.username)
+}
+
+// CompleteMFALogin termina un login que devolvió MFARequiredError. Acepta un
+// código TOTP o, fuera del enrolamiento, un código de recuperación.
+func (s *AuthService) CompleteMFALogin(ctx context.Context, challengeToken, code, recoveryCode, userAgent, ip string, opts LoginOptions) (*MFALoginResult, error) {
+	attempt := &loginAttempt{
+		userAgent: userAgent,
+		ip:        ip,
+		method:    LoginMethodPassword,
+		mfa:       true,
+	}
+	result, err := s.mfaLogin(ctx, attempt, challengeToken, opts, func(challenge *mfaChallenge, user *models.User) ([]string, error) {
+		if !challenge.enroll {
+			return nil, s.verifySecondFactor(ctx, user.ID, code, recoveryCode)
+		}
+		secret, err := s.pendingTOTP(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.verifyTOTP(ctx, secret, code); err != nil {
+			return nil, err
+		}
+		return s.activateTOTP(ctx, user.ID)
+	})
+	s.recordLogin(ctx, attempt, err)
+	return result, err
+}
+
+// mfaLogin valida el challenge, verifica el segundo factor con verify y abre
+// la sesión. verify devuelve los códigos de recuperación si el paso terminó
+// un enrolamiento.
+func (s *AuthService) mfaLogin(ctx context.Context, attempt *loginAttempt, challengeToken string, opts LoginOptions, verify func(challenge *mfaChallenge, user *models.User) ([]string, error)) (*MFALoginResult, error) {
+	challenge, err := s.parseChallenge(ctx, challengeToken)
+	if err != nil {
+		return nil, err
+	}
+	attempt.username = challenge.username
+
+	if err := s.checkLockout(ctx, attempt.username, attempt.ip); err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.FindUserByUsername(ctx, challenge.username)
+	if err != nil {
+		if apperrors.IsContextError(err) {
+			return nil, err
+		}
+		return nil, apperrors.ErrMFAChallengeInvalid
+	}
+	if user.ID != challenge.userID {
+		return nil, apperrors.ErrMFAChallengeInvalid
+	}
+	attempt.user = user
+
+	result := &MFALoginResult{}
+	if result.RecoveryCodes, err = verify(challenge, user); err != nil {
+		if errors.Is(err, apperrors.ErrInvalidMFACode) || errors.Is(err, apperrors.ErrPasskeyInvalid) {
+			s.registerFailure(ctx, attempt.username, attempt.ip)
+		}
+		return nil, err
+	}
+	s.clearFailures(ctx, attempt.username)
+
+	// El challenge se consume antes de abrir la sesión: si otro request lo
+	// usó primero, éste no debe dejar una sesión viva
+	if err := s.consumePurposeToken(ctx, challenge.token, apperrors.ErrMFAChallengeInvalid); err != nil {
+		return nil, err
+	}
+	if result.Token, err = s.createSession(ctx, attempt, opts); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// requireSecondFactor corta el login por contraseña si el usuario tiene un
+// segundo factor (TOTP confirmado o passkey) o si su rol lo exige
+func (s *AuthService) requireSecondFactor(ctx context.Context, user *models.User) error {
+	if s.mfa == nil && s.webauthn == nil {
+		return nil
+	}
+	methods, err := s.secondFactors(ctx, user.ID)
+	if err != nil {
+		return apperrors.WrapError(err, "failed to check MFA")
+	}
+	enroll := len(methods) == 0
+	if enroll && !s.mfaRequiredFor(user.Role) {
+		return nil
+	}
+
+	challenge, expiresAt, err := s.issueChallenge(user, enroll)
+	if err != nil {
+		return apperrors.WrapError(err, "failed to issue MFA challenge")
+	}
+	return &MFARequiredError{Challenge: challenge, Enroll: enroll, Methods: methods, ExpiresAt: expiresAt}
+}
+
+// secondFactors lista los segundos factores que tiene configurados el usuario
+func (s *AuthService) secondFactors(ctx context.Context, userID uint) ([]string, error) {
+	var methods []string
+	if s.mfa != nil {
+		secret, err := s.mfa.GetTOTP(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if secret != nil && secret.ConfirmedAt != nil {
+			methods = append(methods, SecondFactorTOTP)
+		}
+	}
+	if s.webauthn != nil {
+		credentials, err := s.passkeys.FindCredentialsByUser(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if len(credentials) > 0 {
+			methods = append(methods, SecondFactorPasskey)
+		}
+	}
+	return methods, nil
+}
+
+func (s *AuthService) verifySecondFactor(ctx context.Context, userID uint, code, recoveryCode string) error {
+	if recoveryCode != "" {
+		if s.mfa == nil {
+			return apperrors.ErrInvalidMFACode
+		}
+		used, err := s.mfa.UseRecoveryCode(ctx, userID, mfa.HashRecoveryCode(recoveryCode), time.Now())
+		if err != nil {
+			return err
+		}
+		if !used {
+			return apperrors.ErrInvalidMFACode
+		}
+		return nil
+	}
+
+	secret, err := s.confirmedTOTP(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return s.verifyTOTP(ctx, secret, code)
+}
+
+// verifyTOTP acepta el código una sola vez: el paso de tiempo en que
+// coincidió queda marcado como usado
+func (s *AuthService) verifyTOTP(ctx context.Context, secret *models.TOTPSecret, code string) error {
+	step, ok := mfa.VerifyTOTP(secret.Secret, code, time.Now())
+	if !ok {
+		return apperrors.ErrInvalidMFACode
+	}
+	fresh, err := s.mfa.UseTOTPStep(ctx, secret.UserID, step)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return apperrors.ErrInvalidMFACode
+	}
+	return nil
+}
+
+func (s *AuthService) pendingTOTP(ctx context.Context, userID uint) (*models.TOTPSecret, error) {
+	if s.mfa == nil {
+		return nil, apperrors.ErrMFANotEnrolled
+	}
+	secret, err := s.mfa.GetTOTP(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil {
+		return nil, apperrors.ErrMFANotEnrolled
+	}
+	if secret.ConfirmedAt != nil {
+		return nil, apperrors.ErrMFAAlreadyEnabled
+	}
+	return secret, nil
+}
+
+func (s *AuthService) confirmedTOTP(ctx context.Context, userID uint) (*models.TOTPSecret, error) {
+	if s.mfa == nil {
+		return nil, apperrors.ErrMFANotEnrolled
+	}
+	secret, err := s.mfa.GetTOTP(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.ConfirmedAt == nil {
+		return nil, apperrors.ErrMFANotEnrolled
+	}
+	return secret, nil
+}
+
+func (s *AuthService) activateTOTP(ctx context.Context, userID uint) ([]string, error) {
+	if err := s.mfa.ConfirmTOTP(ctx, userID, time.Now()); err != nil {
+		return nil, err
+	}
+	return s.newRecoveryCodes(ctx, userID)
+}
+
+func (s *AuthService) newRecoveryCodes(ctx context.Context, userID uint) ([]string, error) {
+	codes, hashes, err := mfa.GenerateRecoveryCodes(mfa.RecoveryCodeCount)
+	if err != nil {
+		return nil, apperrors.WrapError(err, "failed to generate recovery codes")
+	}
+	if err := s.mfa.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s *AuthService) issueChallenge(user *models.User, enroll bool) (string, time.Time, error) {
+	return s.signPurposeToken(purposeMFAChallenge, jwt.MapClaims{
+		"user_id":  user.ID,
+		"username": user.Username,
+		"enroll":   enroll,
+	}, s.mfaPolicy.ChallengeTTL)
+}
+
+func (s *AuthService) parseChallenge(ctx context.Context, tokenStr string) (*mfaChallenge, error) {
+	claims, token, err := s.parsePurposeToken(ctx, purposeMFAChallenge, tokenStr, apperrors.ErrMFAChallengeInvalid)
+	if err != nil {
+		return nil, err
+	}
+	userID, okID := claims["user_id"].(float64)
+	username, okName := claims["username"].(string)
+	enroll, _ := claims["enroll"].(bool)
+	if !okID || !okName {
+		return nil, apperrors.ErrMFAChallengeInvalid
+	}
+	return &mfaChallenge{
+		userID:   uint(userID),
+		username: username,
+		enroll:   enroll,
+		token:    token,
+	}, nil
+}
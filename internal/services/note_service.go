@@ -1,30 +1,32 @@
 package services
 
 import (
+	"context"
+
 	"github.com/ramiroschettino/jwt-auth-api/internal/models"
 	"github.com/ramiroschettino/jwt-auth-api/internal/repositories"
 )
 
 type NoteService struct {
-	noteRepo *repositories.NoteRepository
+	noteRepo repositories.NoteStore
 }
 
-func NewNoteService(noteRepo *repositories.NoteRepository) *NoteService {
+func NewNoteService(noteRepo repositories.NoteStore) *NoteService {
 	return &NoteService{noteRepo: noteRepo}
 }
 
-func (s *NoteService) CreateNote(title, content string, userID uint) (*models.Note, error) {
+func (s *NoteService) CreateNote(ctx context.Context, title, content string, userID uint) (*models.Note, error) {
 	note := &models.Note{
 		Title:   title,
 		Content: content,
 		UserID:  userID,
 	}
-	if err := s.noteRepo.CreateNote(note); err != nil {
+	if err := s.noteRepo.CreateNote(ctx, note); err != nil {
 		return nil, err
 	}
 	return note, nil
 }
 
-func (s *NoteService) GetNotesByUserID(userID uint) ([]models.Note, error) {
-	return s.noteRepo.FindNotesByUserID(userID)
+func (s *NoteService) GetNotesByUserID(ctx context.Context, userID uint) ([]models.Note, error) {
+	return s.noteRepo.FindNotesByUserID(ctx, userID)
 }
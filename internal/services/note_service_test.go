@@ -1,11 +1,14 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"testing"
 
 	"github.com/glebarez/sqlite"
 	"github.com/ramiroschettino/jwt-auth-api/internal/models"
 	"github.com/ramiroschettino/jwt-auth-api/internal/repositories"
+	"github.com/ramiroschettino/jwt-auth-api/internal/repositories/repotest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 	"gorm.io/gorm"
@@ -44,9 +47,10 @@ func TestNoteService(t *testing.T) {
 
 func (s *NoteServiceTestSuite) TestNoteService() {
 	t := s.T()
+	ctx := context.Background()
 
 	t.Run("CreateNote", func(t *testing.T) {
-		note, err := s.noteService.CreateNote("Test Note", "Test Content", s.testUser.ID)
+		note, err := s.noteService.CreateNote(ctx, "Test Note", "Test Content", s.testUser.ID)
 		assert.NoError(t, err)
 		assert.NotNil(t, note)
 		assert.Equal(t, "Test Note", note.Title)
@@ -60,13 +64,31 @@ func (s *NoteServiceTestSuite) TestNoteService() {
 	})
 
 	t.Run("GetNotesByUserID", func(t *testing.T) {
-		_, err := s.noteService.CreateNote("Another Note", "More Content", s.testUser.ID)
+		_, err := s.noteService.CreateNote(ctx, "Another Note", "More Content", s.testUser.ID)
 		assert.NoError(t, err)
 
-		notes, err := s.noteService.GetNotesByUserID(s.testUser.ID)
+		notes, err := s.noteService.GetNotesByUserID(ctx, s.testUser.ID)
 		assert.NoError(t, err)
 		assert.Len(t, notes, 2)
 		assert.Equal(t, "Test Note", notes[0].Title)
 		assert.Equal(t, "Another Note", notes[1].Title)
 	})
 }
+
+func TestNoteServiceWithFakes(t *testing.T) {
+	ctx := context.Background()
+	notes := repotest.NewNoteStore()
+	svc := NewNoteService(notes)
+
+	note, err := svc.CreateNote(ctx, "Fake", "Contenido", 7)
+	assert.NoError(t, err)
+	assert.NotZero(t, note.ID)
+
+	list, err := svc.GetNotesByUserID(ctx, 7)
+	assert.NoError(t, err)
+	assert.Len(t, list, 1)
+
+	notes.Err = errors.New("base caída")
+	_, err = svc.CreateNote(ctx, "Otra", "", 7)
+	assert.Error(t, err)
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	apperrors "github.com/ramiroschettino/jwt-auth-api/internal/errors"
+)
+
+// Reglas de la política de contraseñas, tal como se informan al cliente
+const (
+	PasswordRuleMinLength        = "min_length"
+	PasswordRuleMaxLength        = "max_length"
+	PasswordRuleLowercase        = "lowercase"
+	PasswordRuleUppercase        = "uppercase"
+	PasswordRuleDigit            = "digit"
+	PasswordRuleSymbol           = "symbol"
+	PasswordRuleContainsUsername = "contains_username"
+	PasswordRuleBreached         = "breached"
+)
+
+// Clases de caracteres que se pueden exigir en RequiredClasses
+const (
+	PasswordClassLower  = "lower"
+	PasswordClassUpper  = "upper"
+	PasswordClassDigit  = "digit"
+	PasswordClassSymbol = "symbol"
+)
+
+// bcryptMaxBytes es lo que bcrypt llega a mirar de una contraseña; el resto
+// se ignora sin aviso
+const bcryptMaxBytes = 72
+
+// minUsernameMatch es el largo mínimo de usuario que se busca dentro de la
+// contraseña; con menos casi cualquier contraseña lo contendría
+const minUsernameMatch = 3
+
+// BreachedPasswordChecker cuenta en cuántas filtraciones aparece una
+// contraseña (ver breached.Corpus)
+type BreachedPasswordChecker interface {
+	Count(ctx context.Context, password string) (int, error)
+}
+
+// PasswordPolicy define qué contraseñas nuevas se aceptan en el registro, el
+// cambio y la recuperación de contraseña
+type PasswordPolicy struct {
+	// MinLength se cuenta en caracteres, no en bytes
+	MinLength int
+	// MaxBytes corta contraseñas que el hash truncaría (0 = sin límite)
+	MaxBytes int
+	// RequiredClasses son las clases de PasswordClass* que deben aparecer
+	RequiredClasses []string
+	// DisallowUsername rechaza contraseñas que contienen el usuario, sin
+	// distinguir mayúsculas
+	DisallowUsername bool
+	// Breached, si no es nil, rechaza contraseñas que aparecen al menos
+	// BreachedMinCount veces (1 si es 0)
+	Breached         BreachedPasswordChecker
+	BreachedMinCount int
+}
+
+// DefaultPasswordPolicy es la que se aplica si no se llama a
+// WithPasswordPolicy
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{MinLength: 8, MaxBytes: bcryptMaxBytes}
+}
+
+// PasswordViolation es una regla que la contraseña no cumple
+type PasswordViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicyError lista todas las reglas incumplidas, no sólo la primera,
+// para que el cliente pueda mostrarlas juntas
+type PasswordPolicyError struct {
+	Violations []PasswordViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		messages = append(messages, v.Message)
+	}
+	return fmt.Sprintf("%s: %s", apperrors.ErrWeakPassword.Error(), strings.Join(messages, "; "))
+}
+
+func (e *PasswordPolicyError) Unwrap() error {
+	return apperrors.ErrWeakPassword
+}
+
+// WithPasswordPolicy reemplaza la política por defecto
+func (s *AuthService) WithPasswordPolicy(policy PasswordPolicy) *AuthService {
+	s.passwordPolicy = &policy
+	return s
+}
+
+// checkPassword valida una contraseña nueva de username contra la política.
+// Devuelve *PasswordPolicyError si incumple alguna regla.
+func (s *AuthService) checkPassword(ctx context.Context, username, password string) error {
+	policy := DefaultPasswordPolicy()
+	if s.passwordPolicy != nil {
+		policy = *s.passwordPolicy
+	}
+
+	var violations []PasswordViolation
+	add := func(rule, format string, args ...interface{}) {
+		violations = append(violations, PasswordViolation{Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if utf8.RuneCountInString(password) < policy.MinLength {
+		add(PasswordRuleMinLength, "must have at least %d characters", policy.MinLength)
+	}
+	if policy.MaxBytes > 0 && len(password) > policy.MaxBytes {
+		add(PasswordRuleMaxLength, "must have at most %d bytes", policy.MaxBytes)
+	}
+
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	for _, class := range policy.RequiredClasses {
+		switch class {
+		case PasswordClassLower:
+			if !lower {
+				add(PasswordRuleLowercase, "must contain a lowercase letter")
+			}
+		case PasswordClassUpper:
+			if !upper {
+				add(PasswordRuleUppercase, "must contain an uppercase letter")
+			}
+		case PasswordClassDigit:
+			if !digit {
+				add(PasswordRuleDigit, "must contain a digit")
+			}
+		case PasswordClassSymbol:
+			if !symbol {
+				add(PasswordRuleSymbol, "must contain a symbol")
+			}
+		}
+	}
+
+	if policy.DisallowUsername && utf8.RuneCountInString(username) >= minUsernameMatch &&
+		strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		add(PasswordRuleContainsUsername, "must not contain the username")
+	}
+
+	if policy.Breached != nil && password != "" {
+		count, err := policy.Breached.Count(ctx, password)
+		if err != nil {
+			return apperrors.WrapError(err, "failed to check breached passwords")
+		}
+		minCount := policy.BreachedMinCount
+		if minCount <= 0 {
+			minCount = 1
+		}
+		if count >= minCount {
+			add(PasswordRuleBreached, "appears in a known data breach")
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	apperrors "github.com/ramiroschettino/jwt-auth-api/internal/errors"
+	mailer "github.com/ramiroschettino/jwt-auth-api/internal/mail"
+	"github.com/ramiroschettino/jwt-auth-api/internal/models"
+	"github.com/ramiroschettino/jwt-auth-api/internal/repositories"
+)
+
+// PasswordReset configura el envío de links de recuperación de contraseña
+type PasswordReset struct {
+	Mailer mailer.Mailer
+	// LinkURL es la página que recibe el token como ?token=... y lo envía a
+	// POST /password/reset junto con la contraseña nueva
+	LinkURL string
+	TTL     time.Duration
+}
+
+// WithPasswordReset habilita la recuperación de contraseña por email. Los
+// tokens son aleatorios y en store sólo queda su hash.
+func (s *AuthService) WithPasswordReset(store repositories.PasswordResetStore, cfg PasswordReset) *AuthService {
+	s.passwordResets = store
+	s.passwordReset = &cfg
+	return s
+}
+
+// RequestPasswordReset envía un link de recuperación al usuario con ese
+// email. Todo lo que depende de que la cuenta exista corre en segundo plano,
+// así la respuesta es la misma, y tarda lo mismo, haya o no una cuenta.
+func (s *AuthService) RequestPasswordReset(ctx context.Context, email string) error {
+	if s.passwordReset == nil {
+		return apperrors.ErrPasswordResetDisabled
+	}
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return err
+	}
+
+	s.inBackground(ctx, func(ctx context.Context) {
+		if err := s.sendPasswordReset(ctx, email); err != nil {
+			log.Printf("Error al enviar el link de recuperación de contraseña: %v", err)
+		}
+	})
+	return nil
+}
+
+// sendPasswordReset genera un link nuevo para la cuenta con ese email, si
+// existe, y lo envía
+func (s *AuthService) sendPasswordReset(ctx context.Context, email string) error {
+	user, err := s.userRepo.FindUserByEmail(ctx, email)
+	if err != nil {
+		if apperrors.IsContextError(err) {
+			return err
+		}
+		return nil
+	}
+
+	// Un link nuevo invalida los anteriores
+	if err := s.passwordResets.DeleteUserResetTokens(ctx, user.ID); err != nil {
+		return apperrors.WrapError(err, "failed to delete reset tokens")
+	}
+	token, err := newOpaqueToken()
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(s.passwordReset.TTL)
+	if err := s.passwordResets.CreateResetToken(ctx, &models.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: hashOpaqueToken(token),
+		ExpiresAt: expiresAt,
+	}); err != nil {
+		return apperrors.WrapError(err, "failed to store reset token")
+	}
+
+	link, err := linkWithToken(s.passwordReset.LinkURL, token)
+	if err != nil {
+		return err
+	}
+	err = s.passwordReset.Mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password of your account. To choose a new one, open this link:\n\n%s\n\nThe link expires on %s and can be used once. If you did not request it, ignore this message; your password has not changed.\n",
+			user.Username, link, expiresAt.UTC().Format(time.RFC1123)),
+	})
+	if err != nil {
+		return apperrors.WrapError(err, "failed to send reset email")
+	}
+	return nil
+}
+
+// ResetPassword consume el token de un link de recuperación, cambia la
+// contraseña y cierra todas las sesiones del usuario. Una contraseña que no
+// cumple la política no consume el token, para poder reintentar.
+func (s *AuthService) ResetPassword(ctx context.Context, token, password, userAgent, ip string) error {
+	if s.passwordReset == nil {
+		return apperrors.ErrPasswordResetDisabled
+	}
+	if token == "" {
+		return apperrors.ErrResetTokenInvalid
+	}
+	tokenHash := hashOpaqueToken(token)
+
+	reset, err := s.passwordResets.FindResetToken(ctx, tokenHash, time.Now())
+	if err != nil {
+		return apperrors.WrapError(err, "failed to find reset token")
+	}
+	if reset == nil {
+		return apperrors.ErrResetTokenInvalid
+	}
+	// Sólo un usuario borrado invalida el link; una falla de la base no
+	// debería hacerlo parecer vencido
+	user, err := s.userRepo.FindUserByID(ctx, reset.UserID)
+	if errors.Is(err, apperrors.ErrUserNotFound) {
+		return apperrors.ErrResetTokenInvalid
+	}
+	if err != nil {
+		return apperrors.WrapError(err, "failed to find user")
+	}
+	if err := s.checkPassword(ctx, user.Username, password); err != nil {
+		return err
+	}
+
+	reset, err = s.passwordResets.ConsumeResetToken(ctx, tokenHash, time.Now())
+	if err != nil {
+		return apperrors.WrapError(err, "failed to consume reset token")
+	}
+	if reset == nil {
+		return apperrors.ErrResetTokenInvalid
+	}
+
+	if err := s.setPassword(ctx, user.ID, password); err != nil {
+		return err
+	}
+	if err := s.passwordResets.DeleteUserResetTokens(ctx, user.ID); err != nil {
+		return apperrors.WrapError(err, "failed to delete reset tokens")
+	}
+	if err := s.revokeAllSessions(ctx, user.ID); err != nil {
+		return err
+	}
+	// Quien recupera la cuenta no debería seguir bloqueado por los intentos
+	// fallidos que lo llevaron a pedir el link
+	s.clearFailures(ctx, user.Username)
+
+	s.recordPasswordEvent(ctx, user, models.AuthEventPasswordReset, userAgent, ip)
+	return nil
+}
+
+// revokeAllSessions cierra todas las sesiones del usuario y pone sus tokens
+// en la lista negra. El store no conoce la caché de revocaciones, así que
+// los JTI se marcan acá.
+func (s *AuthService) revokeAllSessions(ctx context.Context, userID uint) error {
+	sessions, err := s.sessionRepo.GetActiveSessionsByUserID(ctx, userID)
+	if err != nil {
+		return apperrors.WrapError(err, "failed to list sessions")
+	}
+	if err := s.sessionRepo.DeactivateUserSessionsAndBlacklist(ctx, userID, s.userRepo); err != nil {
+		return apperrors.WrapError(err, "failed to revoke sessions")
+	}
+	for _, session := range sessions {
+		s.revokeCached(session.JTI)
+	}
+	return nil
+}
+
+// newOpaqueToken genera 256 bits aleatorios en base64 URL-safe
+func newOpaqueToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", apperrors.WrapError(err, "failed to generate random token")
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// hashOpaqueToken es lo que se guarda y se compara en lugar del token.
+// Alcanza con SHA-256 sin sal: el token ya tiene entropía suficiente.
+func hashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
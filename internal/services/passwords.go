@@ -0,0 +1,188 @@
+package services
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	apperrors "github.com/ramiroschettino/jwt-auth-api/internal/errors"
+	"github.com/ramiroschettino/jwt-auth-api/internal/models"
+	"github.com/ramiroschettino/jwt-auth-api/internal/passhash"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordHasher genera y verifica los hashes de contraseña guardados (ver
+// passhash). Verify debe aceptar hashes de cualquier algoritmo soportado, no
+// sólo del propio, y NeedsRehash indica si conviene regenerarlo.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(password, encoded string) (bool, error)
+	NeedsRehash(encoded string) bool
+}
+
+// WithPasswordHasher cambia el algoritmo de las contraseñas nuevas; por
+// defecto es argon2id con passhash.DefaultArgon2idParams, lo mismo que usa
+// el servidor sin PASSWORD_HASH. Los hashes existentes se regeneran con el
+// nuevo en el próximo login correcto de cada usuario.
+func (s *AuthService) WithPasswordHasher(hasher PasswordHasher) *AuthService {
+	s.hasher = hasher
+	s.dummyHashOnce = sync.Once{}
+	return s
+}
+
+func (s *AuthService) passwordHasher() PasswordHasher {
+	if s.hasher == nil {
+		return passhash.NewArgon2id(passhash.DefaultArgon2idParams())
+	}
+	return s.hasher
+}
+
+// verifyPassword compara password con el hash del usuario. Un hash mal
+// formado cuenta como contraseña incorrecta y queda en el log.
+func (s *AuthService) verifyPassword(user *models.User, password string) bool {
+	ok, err := s.passwordHasher().Verify(password, user.Password)
+	if err != nil {
+		log.Printf("Error al verificar la contraseña del usuario %d: %v", user.ID, err)
+		return false
+	}
+	return ok
+}
+
+// rehashPassword regenera el hash del usuario con el algoritmo y los
+// parámetros actuales si quedó desactualizado. Se llama con la contraseña ya
+// verificada; un error no corta el login, sólo se registra.
+func (s *AuthService) rehashPassword(ctx context.Context, user *models.User, password string) {
+	hasher := s.passwordHasher()
+	if !hasher.NeedsRehash(user.Password) {
+		return
+	}
+	hash, err := hasher.Hash(password)
+	if err == nil {
+		err = s.userRepo.UpdatePassword(ctx, user.ID, hash)
+	}
+	if err != nil {
+		log.Printf("Error al actualizar el hash de la contraseña del usuario %d: %v", user.ID, err)
+		return
+	}
+	user.Password = hash
+}
+
+// bcryptPrefixes son los comienzos de los hashes de bcrypt: en PHC y en el
+// Modular Crypt Format ($2a$, $2b$, $2y$) de antes de passhash
+var bcryptPrefixes = []string{"$bcrypt$", "$2"}
+
+// equalizeTiming verifica password contra un hash descartable, para que un
+// usuario inexistente tarde lo mismo en rechazarse que una contraseña
+// incorrecta. Mientras queden hashes de bcrypt sin regenerar conviven dos
+// costos de verificación; se usa el del algoritmo más lento de los que hay
+// en la base, así un usuario inexistente nunca responde más rápido.
+func (s *AuthService) equalizeTiming(ctx context.Context, password string) {
+	s.dummyHashOnce.Do(func() {
+		s.dummyHash = s.slowestDummyHash(context.WithoutCancel(ctx))
+	})
+	s.passwordHasher().Verify(password, s.dummyHash)
+}
+
+// slowestDummyHash genera un hash descartable con el hasher actual y, si la
+// base todavía tiene hashes de bcrypt, otro con bcrypt; devuelve el que más
+// tarda en verificarse
+func (s *AuthService) slowestDummyHash(ctx context.Context) string {
+	hashers := []PasswordHasher{s.passwordHasher()}
+	if s.hasBcryptHashes(ctx) {
+		hashers = append(hashers, passhash.NewBcrypt(bcrypt.DefaultCost))
+		if s.Cfg != nil && s.Cfg.BcryptCost > 0 && s.Cfg.BcryptCost != bcrypt.DefaultCost {
+			hashers = append(hashers, passhash.NewBcrypt(s.Cfg.BcryptCost))
+		}
+	}
+
+	var slowest string
+	var slowestTime time.Duration = -1
+	for _, hasher := range hashers {
+		hash, err := hasher.Hash("dummy-password")
+		if err != nil {
+			continue
+		}
+		start := time.Now()
+		hasher.Verify("wrong-password", hash)
+		if elapsed := time.Since(start); elapsed > slowestTime {
+			slowest, slowestTime = hash, elapsed
+		}
+	}
+	return slowest
+}
+
+// hasBcryptHashes indica si queda alguna contraseña guardada con bcrypt
+func (s *AuthService) hasBcryptHashes(ctx context.Context) bool {
+	for _, prefix := range bcryptPrefixes {
+		found, err := s.userRepo.HasPasswordHashPrefix(ctx, prefix)
+		if err != nil {
+			// Ante la duda se mide también bcrypt: es peor responder más
+			// rápido que un usuario real que más lento
+			log.Printf("Error al buscar hashes de bcrypt: %v", err)
+			return true
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+// ChangePassword cambia la contraseña del usuario autenticado si current es
+// la actual. Cierra todas sus otras sesiones y revoca sus tokens; la sesión
+// currentSessionID sigue válida.
+func (s *AuthService) ChangePassword(ctx context.Context, userID, currentSessionID uint, current, password, userAgent, ip string) error {
+	user, err := s.userRepo.FindUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !s.verifyPassword(user, current) {
+		return apperrors.ErrCurrentPasswordInvalid
+	}
+	if err := s.checkPassword(ctx, user.Username, password); err != nil {
+		return err
+	}
+
+	if err := s.setPassword(ctx, user.ID, password); err != nil {
+		return err
+	}
+	if _, err := s.RevokeOtherSessions(ctx, user.ID, currentSessionID); err != nil {
+		return err
+	}
+	// Un link de recuperación pedido antes ya no debería poder pisar la
+	// contraseña nueva
+	if s.passwordResets != nil {
+		if err := s.passwordResets.DeleteUserResetTokens(ctx, user.ID); err != nil {
+			return apperrors.WrapError(err, "failed to delete reset tokens")
+		}
+	}
+
+	s.recordPasswordEvent(ctx, user, models.AuthEventPasswordChange, userAgent, ip)
+	return nil
+}
+
+// setPassword guarda el hash de la contraseña nueva
+func (s *AuthService) setPassword(ctx context.Context, userID uint, password string) error {
+	hashedPassword, err := s.passwordHasher().Hash(password)
+	if err != nil {
+		return apperrors.WrapError(err, "failed to hash password")
+	}
+	if err := s.userRepo.UpdatePassword(ctx, userID, hashedPassword); err != nil {
+		return apperrors.WrapError(err, "failed to update password")
+	}
+	return nil
+}
+
+func (s *AuthService) recordPasswordEvent(ctx context.Context, user *models.User, eventType, userAgent, ip string) {
+	event := &models.AuthEvent{
+		UserID:    &user.ID,
+		Username:  user.Username,
+		Type:      eventType,
+		Success:   true,
+		IP:        ip,
+		UserAgent: userAgent,
+	}
+	s.locateEvent(event)
+	s.recordEvent(ctx, event)
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	apperrors "github.com/ramiroschettino/jwt-auth-api/internal/errors"
+	"github.com/ramiroschettino/jwt-auth-api/internal/models"
+)
+
+// Políticas ante un login que supera el límite de sesiones simultáneas
+const (
+	// SessionPolicyEvictOldest cierra la sesión más antigua
+	SessionPolicyEvictOldest = "evict_oldest"
+	// SessionPolicyReject rechaza el nuevo login
+	SessionPolicyReject = "reject"
+	// SessionPolicyChoose rechaza el login devolviendo las sesiones activas
+	// para que el usuario reintente indicando cuál cerrar
+	SessionPolicyChoose = "choose"
+)
+
+// SessionLimitError se devuelve cuando se alcanzó el límite de sesiones y la
+// política no permite cerrar una automáticamente. Con SessionPolicyChoose
+// incluye las sesiones activas entre las que el usuario puede elegir.
+type SessionLimitError struct {
+	Limit    int
+	Policy   string
+	Sessions []models.Session
+}
+
+func (e *SessionLimitError) Error() string {
+	return fmt.Sprintf("%s (%d)", apperrors.ErrSessionLimitReached.Error(), e.Limit)
+}
+
+func (e *SessionLimitError) Unwrap() error {
+	return apperrors.ErrSessionLimitReached
+}
+
+// sessionLimit devuelve el límite de sesiones para el rol; 0 significa sin límite
+func (s *AuthService) sessionLimit(role string) int {
+	if limit, ok := s.Cfg.MaxSessionsByRole[role]; ok {
+		return limit
+	}
+	return s.Cfg.MaxSessionsPerUser
+}
+
+// enforceSessionLimit hace lugar para una nueva sesión del usuario según la
+// política configurada. Las sesiones cerradas se agregan a la lista negra.
+func (s *AuthService) enforceSessionLimit(ctx context.Context, user *models.User, terminateSessionID uint) error {
+	activeSessions, err := s.sessionRepo.GetActiveSessionsByUserID(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("error al obtener sesiones activas: %w", err)
+	}
+
+	// El usuario eligió qué sesión cerrar (ver SessionPolicyChoose)
+	if terminateSessionID != 0 {
+		idx := -1
+		for i := range activeSessions {
+			if activeSessions[i].ID == terminateSessionID {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			return apperrors.ErrSessionNotFound
+		}
+		if err := s.revokeSession(ctx, &activeSessions[idx]); err != nil {
+			return err
+		}
+		activeSessions = append(activeSessions[:idx], activeSessions[idx+1:]...)
+	}
+
+	limit := s.sessionLimit(user.Role)
+	if limit <= 0 || len(activeSessions) < limit {
+		return nil
+	}
+
+	switch s.Cfg.SessionLimitPolicy {
+	case SessionPolicyReject:
+		return &SessionLimitError{Limit: limit, Policy: SessionPolicyReject}
+	case SessionPolicyChoose:
+		return &SessionLimitError{Limit: limit, Policy: SessionPolicyChoose, Sessions: activeSessions}
+	}
+
+	// Cerrar las más antiguas hasta dejar lugar para la nueva
+	sort.Slice(activeSessions, func(i, j int) bool {
+		return activeSessions[i].CreatedAt.Before(activeSessions[j].CreatedAt)
+	})
+	for i := 0; i <= len(activeSessions)-limit; i++ {
+		if err := s.revokeSession(ctx, &activeSessions[i]); err != nil {
+			return fmt.Errorf("error al desactivar la sesión más antigua: %w", err)
+		}
+	}
+	return nil
+}
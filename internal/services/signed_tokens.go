@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	apperrors "github.com/ramiroschettino/jwt-auth-api/internal/errors"
+)
+
+// Propósitos de los tokens firmados de corta vida. Cada uno se firma con una
+// clave propia derivada del secreto JWT, así un token de un propósito nunca
+// pasa por otro ni por un token de acceso.
+const (
+	purposeMFAChallenge     = "mfa-challenge"
+	purposeWebAuthnCeremony = "webauthn-ceremony"
+	purposeEmailVerify      = "email-verification"
+	purposeMagicLink        = "magic-link"
+)
+
+// signedToken identifica un token firmado ya validado, para consumirlo
+type signedToken struct {
+	raw       string
+	jti       string
+	expiresAt time.Time
+}
+
+func (s *AuthService) purposeKey(purpose string) []byte {
+	mac := hmac.New(sha256.New, []byte(s.Cfg.JWTSecret))
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// signPurposeToken firma claims para purpose con vencimiento en ttl
+func (s *AuthService) signPurposeToken(purpose string, claims jwt.MapClaims, ttl time.Duration) (string, time.Time, error) {
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", time.Time{}, err
+	}
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+
+	claims["purpose"] = purpose
+	claims["exp"] = expiresAt.Unix()
+	claims["iat"] = now.Unix()
+	claims["jti"] = hex.EncodeToString(jti)
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.purposeKey(purpose))
+	return signed, expiresAt, err
+}
+
+// parsePurposeToken valida firma, vencimiento y propósito, y que el token no
+// se haya consumido. Cualquier falla de validación se informa como invalid.
+func (s *AuthService) parsePurposeToken(ctx context.Context, purpose, tokenStr string, invalid error) (jwt.MapClaims, *signedToken, error) {
+	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("método de firma inesperado: %v", token.Header["alg"])
+		}
+		return s.purposeKey(purpose), nil
+	}, jwt.WithExpirationRequired())
+	if err != nil || !token.Valid {
+		return nil, nil, invalid
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["purpose"] != purpose {
+		return nil, nil, invalid
+	}
+	jti, okJTI := claims["jti"].(string)
+	exp, errExp := claims.GetExpirationTime()
+	if !okJTI || errExp != nil {
+		return nil, nil, invalid
+	}
+
+	revoked, err := s.userRepo.IsTokenRevoked(ctx, jti)
+	if err != nil {
+		return nil, nil, err
+	}
+	if revoked {
+		return nil, nil, invalid
+	}
+	return claims, &signedToken{raw: tokenStr, jti: jti, expiresAt: exp.Time}, nil
+}
+
+// consumePurposeToken invalida el token para que no vuelva a servir aunque
+// no haya vencido. Si otro request lo consumió después de que se validó,
+// devuelve invalid, como si ya hubiera estado usado.
+func (s *AuthService) consumePurposeToken(ctx context.Context, token *signedToken, invalid error) error {
+	consumed, err := s.userRepo.ConsumeToken(ctx, token.raw, token.jti, token.expiresAt)
+	if err != nil {
+		return apperrors.WrapError(err, "failed to invalidate single-use token")
+	}
+	if !consumed {
+		return invalid
+	}
+	return nil
+}
@@ -0,0 +1,421 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/golang-jwt/jwt/v5"
+	apperrors "github.com/ramiroschettino/jwt-auth-api/internal/errors"
+	"github.com/ramiroschettino/jwt-auth-api/internal/models"
+	"github.com/ramiroschettino/jwt-auth-api/internal/repositories"
+)
+
+// passkeyCeremonyTTL es cuánto hay para responder las opciones de una
+// ceremonia WebAuthn
+const passkeyCeremonyTTL = 5 * time.Minute
+
+// Tipos de ceremonia firmados en el token, para que las opciones de una no
+// sirvan para la otra
+const (
+	ceremonyRegistration = "registration"
+	ceremonyLogin        = "login"
+)
+
+// PasskeyCeremony son las opciones que el cliente pasa a
+// navigator.credentials y el token que las acompaña hasta la verificación.
+// El estado de la ceremonia viaja firmado en el token, no se guarda en el
+// servidor.
+type PasskeyCeremony struct {
+	Options interface{}
+	Token   string
+}
+
+// webauthnUser adapta un usuario y sus passkeys a webauthn.User
+type webauthnUser struct {
+	user        *models.User
+	credentials []models.WebAuthnCredential
+}
+
+func (u *webauthnUser) WebAuthnID() []byte          { return userHandle(u.user.ID) }
+func (u *webauthnUser) WebAuthnName() string        { return u.user.Username }
+func (u *webauthnUser) WebAuthnDisplayName() string { return u.user.Username }
+func (u *webauthnUser) WebAuthnIcon() string        { return "" }
+
+func (u *webauthnUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(u.credentials))
+	for _, c := range u.credentials {
+		var transports []protocol.AuthenticatorTransport
+		for _, t := range strings.Split(c.Transports, ",") {
+			if t != "" {
+				transports = append(transports, protocol.AuthenticatorTransport(t))
+			}
+		}
+		credentials = append(credentials, webauthn.Credential{
+			ID:              c.CredentialID,
+			PublicKey:       c.PublicKey,
+			AttestationType: c.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				UserVerified:   c.UserVerified,
+				BackupEligible: c.BackupEligible,
+				BackupState:    c.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:       c.AAGUID,
+				SignCount:    c.SignCount,
+				CloneWarning: c.CloneWarning,
+			},
+		})
+	}
+	return credentials
+}
+
+func (u *webauthnUser) descriptors() []protocol.CredentialDescriptor {
+	var descriptors []protocol.CredentialDescriptor
+	for _, c := range u.WebAuthnCredentials() {
+		descriptors = append(descriptors, c.Descriptor())
+	}
+	return descriptors
+}
+
+// userHandle es el identificador opaco del usuario ante el autenticador: su
+// id en 8 bytes, sin datos personales
+func userHandle(userID uint) []byte {
+	handle := make([]byte, 8)
+	binary.BigEndian.PutUint64(handle, uint64(userID))
+	return handle
+}
+
+// WithWebAuthn habilita el registro de passkeys y su uso como segundo factor
+// o como único método de login
+func (s *AuthService) WithWebAuthn(wa *webauthn.WebAuthn, store repositories.WebAuthnStore) *AuthService {
+	s.webauthn = wa
+	s.passkeys = store
+	return s
+}
+
+func (s *AuthService) loadWebAuthnUser(ctx context.Context, userID uint) (*webauthnUser, error) {
+	user, err := s.userRepo.FindUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	credentials, err := s.passkeys.FindCredentialsByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &webauthnUser{user: user, credentials: credentials}, nil
+}
+
+// ListPasskeys devuelve las passkeys del usuario
+func (s *AuthService) ListPasskeys(ctx context.Context, userID uint) ([]models.WebAuthnCredential, error) {
+	if s.webauthn == nil {
+		return nil, apperrors.ErrWebAuthnDisabled
+	}
+	return s.passkeys.FindCredentialsByUser(ctx, userID)
+}
+
+// DeletePasskey borra una passkey del usuario
+func (s *AuthService) DeletePasskey(ctx context.Context, userID, id uint) error {
+	if s.webauthn == nil {
+		return apperrors.ErrWebAuthnDisabled
+	}
+	deleted, err := s.passkeys.DeleteCredential(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return apperrors.ErrPasskeyNotFound
+	}
+	return nil
+}
+
+// BeginPasskeyRegistration arma las opciones para registrar una passkey
+// nueva, excluyendo las que el usuario ya tiene
+func (s *AuthService) BeginPasskeyRegistration(ctx context.Context, userID uint) (*PasskeyCeremony, error) {
+	if s.webauthn == nil {
+		return nil, apperrors.ErrWebAuthnDisabled
+	}
+	user, err := s.loadWebAuthnUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	creation, session, err := s.webauthn.BeginRegistration(user,
+		webauthn.WithExclusions(user.descriptors()),
+		webauthn.WithAuthenticatorSelection(protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementPreferred,
+			UserVerification: protocol.VerificationPreferred,
+		}),
+	)
+	if err != nil {
+		return nil, apperrors.WrapError(err, "failed to begin passkey registration")
+	}
+	return s.newCeremony(creation, session, ceremonyRegistration, userID)
+}
+
+// FinishPasskeyRegistration verifica la respuesta del autenticador y guarda
+// la passkey con el nombre elegido por el usuario
+func (s *AuthService) FinishPasskeyRegistration(ctx context.Context, userID uint, ceremonyToken, name string, response []byte) (*models.WebAuthnCredential, error) {
+	if s.webauthn == nil {
+		return nil, apperrors.ErrWebAuthnDisabled
+	}
+	session, ceremony, err := s.parseCeremony(ctx, ceremonyToken, ceremonyRegistration, userID)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(response))
+	if err != nil {
+		return nil, apperrors.WrapError(apperrors.ErrPasskeyInvalid, err.Error())
+	}
+	user, err := s.loadWebAuthnUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	credential, err := s.webauthn.CreateCredential(user, *session, parsed)
+	if err != nil {
+		return nil, apperrors.WrapError(apperrors.ErrPasskeyInvalid, err.Error())
+	}
+
+	transports := make([]string, 0, len(credential.Transport))
+	for _, t := range credential.Transport {
+		transports = append(transports, string(t))
+	}
+	stored := &models.WebAuthnCredential{
+		UserID:          userID,
+		Name:            name,
+		CredentialID:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transports:      strings.Join(transports, ","),
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		UserVerified:    credential.Flags.UserVerified,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+	}
+	if err := s.passkeys.CreateCredential(ctx, stored); err != nil {
+		return nil, err
+	}
+	if err := s.consumePurposeToken(ctx, ceremony, apperrors.ErrPasskeyInvalid); err != nil {
+		return nil, err
+	}
+	return stored, nil
+}
+
+// BeginPasskeyLogin arma las opciones de un login sin contraseña: el
+// autenticador elige la passkey (credencial descubrible) y debe verificar al
+// usuario
+func (s *AuthService) BeginPasskeyLogin(ctx context.Context) (*PasskeyCeremony, error) {
+	if s.webauthn == nil {
+		return nil, apperrors.ErrWebAuthnDisabled
+	}
+	assertion, session, err := s.webauthn.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		return nil, apperrors.WrapError(err, "failed to begin passkey login")
+	}
+	return s.newCeremony(assertion, session, ceremonyLogin, 0)
+}
+
+// FinishPasskeyLogin verifica la respuesta de un login sin contraseña y abre
+// la sesión como Login
+func (s *AuthService) FinishPasskeyLogin(ctx context.Context, ceremonyToken string, response []byte, userAgent, ip string, opts LoginOptions) (string, error) {
+	attempt := &loginAttempt{
+		userAgent: userAgent,
+		ip:        ip,
+		method:    LoginMethodPasskey,
+	}
+	token, err := s.passkeyLogin(ctx, attempt, ceremonyToken, response, opts)
+	s.recordLogin(ctx, attempt, err)
+	return token, err
+}
+
+func (s *AuthService) passkeyLogin(ctx context.Context, attempt *loginAttempt, ceremonyToken string, response []byte, opts LoginOptions) (string, error) {
+	if s.webauthn == nil {
+		return "", apperrors.ErrWebAuthnDisabled
+	}
+	session, ceremony, err := s.parseCeremony(ctx, ceremonyToken, ceremonyLogin, 0)
+	if err != nil {
+		return "", err
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(response))
+	if err != nil {
+		return "", apperrors.WrapError(apperrors.ErrPasskeyInvalid, err.Error())
+	}
+
+	var user *webauthnUser
+	credential, err := s.webauthn.ValidateDiscoverableLogin(func(rawID, handle []byte) (webauthn.User, error) {
+		if len(handle) != 8 {
+			return nil, apperrors.ErrPasskeyNotFound
+		}
+		loaded, err := s.loadWebAuthnUser(ctx, uint(binary.BigEndian.Uint64(handle)))
+		if err != nil {
+			return nil, err
+		}
+		user = loaded
+		return loaded, nil
+	}, *session, parsed)
+	if user != nil {
+		attempt.user = user.user
+		attempt.username = user.user.Username
+	}
+	if err != nil {
+		return "", apperrors.WrapError(apperrors.ErrPasskeyInvalid, err.Error())
+	}
+
+	// Una passkey no se adivina, pero un bloqueo vigente vale para todos los
+	// métodos de login
+	if err := s.checkLockout(ctx, attempt.username, attempt.ip); err != nil {
+		return "", err
+	}
+	if err := s.checkLoginEmail(user.user); err != nil {
+		return "", err
+	}
+	if err := s.recordPasskeyUse(ctx, user, credential); err != nil {
+		return "", err
+	}
+	// El autenticador verificó al usuario (PIN, biometría): cuenta como
+	// segundo factor
+	attempt.mfa = credential.Flags.UserVerified
+
+	// Como en mfaLogin, la ceremonia se consume antes de abrir la sesión
+	if err := s.consumePurposeToken(ctx, ceremony, apperrors.ErrPasskeyInvalid); err != nil {
+		return "", err
+	}
+	return s.createSession(ctx, attempt, opts)
+}
+
+// BeginPasskeySecondFactor arma las opciones para completar con una passkey
+// un login por contraseña que devolvió MFARequiredError
+func (s *AuthService) BeginPasskeySecondFactor(ctx context.Context, challengeToken string) (*PasskeyCeremony, error) {
+	if s.webauthn == nil {
+		return nil, apperrors.ErrWebAuthnDisabled
+	}
+	challenge, err := s.parseChallenge(ctx, challengeToken)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.loadWebAuthnUser(ctx, challenge.userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(user.credentials) == 0 {
+		return nil, apperrors.ErrPasskeyNotFound
+	}
+
+	assertion, session, err := s.webauthn.BeginLogin(user)
+	if err != nil {
+		return nil, apperrors.WrapError(err, "failed to begin passkey login")
+	}
+	return s.newCeremony(assertion, session, ceremonyLogin, challenge.userID)
+}
+
+// FinishPasskeySecondFactor es CompleteMFALogin con una passkey en lugar de
+// un código
+func (s *AuthService) FinishPasskeySecondFactor(ctx context.Context, challengeToken, ceremonyToken string, response []byte, userAgent, ip string, opts LoginOptions) (*MFALoginResult, error) {
+	attempt := &loginAttempt{
+		userAgent: userAgent,
+		ip:        ip,
+		method:    LoginMethodPassword,
+		mfa:       true,
+	}
+	result, err := s.mfaLogin(ctx, attempt, challengeToken, opts, func(challenge *mfaChallenge, user *models.User) ([]string, error) {
+		if s.webauthn == nil {
+			return nil, apperrors.ErrWebAuthnDisabled
+		}
+		session, ceremony, err := s.parseCeremony(ctx, ceremonyToken, ceremonyLogin, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(response))
+		if err != nil {
+			return nil, apperrors.WrapError(apperrors.ErrPasskeyInvalid, err.Error())
+		}
+		wuser, err := s.loadWebAuthnUser(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		credential, err := s.webauthn.ValidateLogin(wuser, *session, parsed)
+		if err != nil {
+			return nil, apperrors.WrapError(apperrors.ErrPasskeyInvalid, err.Error())
+		}
+		if err := s.recordPasskeyUse(ctx, wuser, credential); err != nil {
+			return nil, err
+		}
+		return nil, s.consumePurposeToken(ctx, ceremony, apperrors.ErrPasskeyInvalid)
+	})
+	s.recordLogin(ctx, attempt, err)
+	return result, err
+}
+
+// recordPasskeyUse guarda el contador de firmas. Si no avanzó, la passkey
+// pudo haberse clonado: queda marcada y deja de servir hasta que el usuario
+// la borre y registre otra.
+func (s *AuthService) recordPasskeyUse(ctx context.Context, user *webauthnUser, credential *webauthn.Credential) error {
+	var stored *models.WebAuthnCredential
+	for i := range user.credentials {
+		if bytes.Equal(user.credentials[i].CredentialID, credential.ID) {
+			stored = &user.credentials[i]
+			break
+		}
+	}
+	if stored == nil {
+		return apperrors.ErrPasskeyNotFound
+	}
+
+	now := time.Now()
+	stored.SignCount = credential.Authenticator.SignCount
+	stored.CloneWarning = stored.CloneWarning || credential.Authenticator.CloneWarning
+	stored.UserVerified = credential.Flags.UserVerified
+	stored.BackupState = credential.Flags.BackupState
+	stored.LastUsedAt = &now
+	if err := s.passkeys.UpdateCredentialUse(ctx, stored); err != nil {
+		return err
+	}
+	if stored.CloneWarning {
+		return apperrors.WrapError(apperrors.ErrPasskeyInvalid, "signature counter did not increase")
+	}
+	return nil
+}
+
+// newCeremony firma el estado de la ceremonia junto con su tipo y el usuario
+// al que pertenece (0 en el login sin contraseña)
+func (s *AuthService) newCeremony(options interface{}, session *webauthn.SessionData, kind string, userID uint) (*PasskeyCeremony, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return nil, err
+	}
+	token, _, err := s.signPurposeToken(purposeWebAuthnCeremony, jwt.MapClaims{
+		"kind":    kind,
+		"user_id": userID,
+		"session": string(data),
+	}, passkeyCeremonyTTL)
+	if err != nil {
+		return nil, apperrors.WrapError(err, "failed to sign passkey ceremony")
+	}
+	return &PasskeyCeremony{Options: options, Token: token}, nil
+}
+
+func (s *AuthService) parseCeremony(ctx context.Context, tokenStr, kind string, userID uint) (*webauthn.SessionData, *signedToken, error) {
+	claims, token, err := s.parsePurposeToken(ctx, purposeWebAuthnCeremony, tokenStr, apperrors.ErrPasskeyInvalid)
+	if err != nil {
+		return nil, nil, err
+	}
+	owner, _ := claims["user_id"].(float64)
+	data, _ := claims["session"].(string)
+	if claims["kind"] != kind || uint(owner) != userID {
+		return nil, nil, apperrors.ErrPasskeyInvalid
+	}
+
+	var session webauthn.SessionData
+	if err := json.Unmarshal([]byte(data), &session); err != nil {
+		return nil, nil, apperrors.ErrPasskeyInvalid
+	}
+	return &session, token, nil
+}